@@ -2,6 +2,7 @@ package db
 
 import (
 	"crypto/tls"
+	"database/sql"
 
 	"time"
 
@@ -24,7 +25,8 @@ type CKinfo struct {
 	Debug    bool
 }
 
-func NewCKLoc(ck *CKinfo) (driver.Conn, error) {
+// ckOptions 根据 CKinfo 生成连接参数
+func ckOptions(ck *CKinfo) *clickhouse.Options {
 
 	c := clickhouse.Options{
 		Addr: ck.HostPost,
@@ -56,12 +58,18 @@ func NewCKLoc(ck *CKinfo) (driver.Conn, error) {
 	}
 
 	if ck.Settings != nil {
+		c.Settings = clickhouse.Settings{}
 		for k, v := range ck.Settings {
 			c.Settings[k] = v
 		}
 	}
 
-	conn, err := clickhouse.Open(&c)
+	return &c
+}
+
+func NewCKLoc(ck *CKinfo) (driver.Conn, error) {
+
+	conn, err := clickhouse.Open(ckOptions(ck))
 
 	return conn, err
 
@@ -69,102 +77,54 @@ func NewCKLoc(ck *CKinfo) (driver.Conn, error) {
 
 func NewCK(ck *CKinfo) *CK {
 
-	c := clickhouse.Options{
-		Addr: ck.HostPost,
-		Auth: clickhouse.Auth{
-			Database: ck.Database,
-			Username: ck.User,
-			Password: ck.Pwd,
-		},
-
-		DialTimeout: time.Second * 30,
-		Compression: &clickhouse.Compression{
-			Method: clickhouse.CompressionLZ4,
-		},
-		Debug:                ck.Debug,
-		BlockBufferSize:      10,
-		MaxCompressionBuffer: 10240,
-		ClientInfo: clickhouse.ClientInfo{
-			Products: []struct {
-				Name    string
-				Version string
-			}{
-				{Name: "my-app", Version: "0.1"},
-			},
-		},
-	}
-	conn := clickhouse.OpenDB(&c)
+	conn := clickhouse.OpenDB(ckOptions(ck))
 
-	return &CK{DB{Con: conn}}
+	return &CK{DB{Con: conn, Dialect: query.ClickHouse}}
 }
+
+// Insert 方法从一个通道接收数据，每 1000 行或每 10 秒批量写入 ClickHouse，第一个写入失败的批次会中止写入。
+// 需要调整批次大小、并发、重试或获取写入结果时使用 InsertWith。
 func (m *CK) Insert(q query.SqlInsert) func(ch chan []any) error {
 
 	return func(ch chan []any) error {
-
-		num := 1000
-		res := make([][]any, 0, num)
-
-		commit := func() error {
-			if err := m.do(res, q); err != nil {
-				return err
-			}
-			res = res[:0]
-			return nil
-		}
-
-		for v := range ch {
-
-			if len(v) == 0 {
-				continue
-			}
-
-			res = append(res, v)
-
-			if len(res) == num {
-				err := commit()
-				if err != nil {
-					return err
-				}
-			}
-		}
-
-		if len(res) > 0 {
-			err := commit()
-			if err != nil {
-				return err
-			}
-		}
-		return nil
+		_, err := m.InsertWith(q, NewWriterConfig())(ch)
+		return err
 	}
 
 }
 
-func (m *CK) do(data [][]any, query query.SqlInsert) error {
-
-	query.AddValues()
-	stmt, _ := query.Build()
+// InsertWith 方法与 DB.InsertWith 相同，每批数据在一个事务中按行追加后一次性发送
+func (m *CK) InsertWith(q query.SqlInsert, cfg *WriterConfig) func(ch chan []any) (*WriteResult, error) {
+	return m.insertWith(q, cfg, m.do)
+}
 
-	defer query.Clear()
+func (m *CK) do(data [][]any, q query.SqlInsert) error {
 
-	tj, err := m.Con.Begin()
+	stmt, _ := buildInsert(q, nil)
 
-	if err != nil {
-		return err
+	if m.DryRun != nil {
+		for _, v := range data {
+			m.DryRun(stmt, v)
+		}
+		return nil
 	}
 
-	smt, err := tj.Prepare(stmt)
-	if err != nil {
-		return err
-	}
-	for _, v := range data {
+	return withTx(m.Con, func(tj *sql.Tx) error {
 
-		_, err = smt.Exec(v...)
+		smt, err := tj.Prepare(stmt)
 		if err != nil {
 			return err
 		}
-	}
+		defer smt.Close()
 
-	err = tj.Commit()
+		for _, v := range data {
 
-	return err
+			_, err = smt.Exec(v...)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
 }
@@ -2,7 +2,6 @@ package db
 
 import (
 	"database/sql"
-	"regexp"
 	"strings"
 	"time"
 
@@ -13,25 +12,27 @@ import (
 	_ "github.com/go-sql-driver/mysql"
 )
 
-// CountQuery 将一个 SQL 查询语句转换为计数查询语句。
+// CountQuery 将一个 SQL 查询语句转换为计数查询语句，见 query.CountQuery。
 // 参数:
 //
 //	baseQuery - 原始的 SQL 查询语句。
 //
 // 返回:
 //
-//	转换后的计数查询语句。
+//	转换后的计数查询语句，无法解析时将原语句包装为子查询。
 func CountQuery(baseQuery string) string {
 
-	query := strings.ToUpper(baseQuery)
-
-	re := regexp.MustCompile("SELECT.*FROM")
-
-	resultQuery := re.ReplaceAllString(query, "SELECT COUNT(1) c FROM")
+	res, err := query.CountQuery(baseQuery)
+	if err != nil {
+		return "SELECT count() FROM (" + strings.TrimRight(strings.TrimSpace(baseQuery), ";") + ") AS _t"
+	}
 
-	return strings.ToLower(resultQuery)
+	return res
 }
 
+// countQueryFor 参数名 query 会遮蔽包名的方法中使用
+var countQueryFor = query.CountQueryFor
+
 var (
 	ModifyFunTemp = array.ToAny[[]string]
 )
@@ -39,114 +40,81 @@ var (
 // MysqlDB 定义了一个与MySQL数据库交互的结构体。
 type DB struct {
 	Con *sql.DB
+	// Dialect 构建查询使用的方言，为 nil 时使用查询自身的设置
+	Dialect query.Dialect
+	// DryRun 不为 nil 时 Exec、UpdateBatch、Insert 不执行语句，而是将语句及参数传给 DryRun
+	DryRun func(stmt string, args []any)
+	// Loc 解析没有时区信息的时间时使用的时区，为 nil 时使用 UTC
+	Loc *time.Location
+
+	// shared 为 true 时连接由 Registry 管理，Close 不关闭底层连接
+	shared bool
 }
 
 // Close 关闭MysqlDB实例的底层数据库连接。
 // 当MysqlDB实例不再需要使用时，应调用此方法。
+// 通过 Registry 获取的共享连接不会被关闭，由 Registry.Close 统一关闭。
 func (m *DB) Close() {
+	if m.shared {
+		return
+	}
 	m.Con.Close()
 }
 
-// Insert 方法从一个通道接收数据，并批量插入到 MySQL 数据库中。
+// Insert 方法从一个通道接收数据，每 1000 行或每 10 秒批量插入到数据库中，第一个写入失败的批次会中止写入。
+// 需要调整批次大小、并发、重试或获取写入结果时使用 InsertWith。
 // 参数:
 //
-//	ch - 一个通道，用于接收待插入的数据。
-//	stop - 一个信号通道，用于控制插入操作的停止。
+//	q - 插入语句。
 //
 // 返回:
 //
-//	一个函数，接受一个 SqlInsert 类型的参数，执行数据库插入操作。
+//	一个函数，接受一个通道，执行数据库插入操作。
 func (m *DB) Insert(q query.SqlInsert) func(ch chan []any) error {
 
 	return func(ch chan []any) error {
-
-		num := 1000
-		res := make([][]any, 0, num)
-
-		ticker := time.NewTicker(time.Second * 10)
-		defer ticker.Stop()
-
-		commit := func() error {
-			if err := m.do(res, q); err != nil {
-				return err
-			}
-			res = res[:0]
-			return nil
-		}
-
-		for {
-			select {
-			case data, ok := <-ch:
-
-				if !ok {
-					goto last
-				}
-
-				if len(data) == 0 {
-					continue
-				}
-
-				res = append(res, data)
-
-				if len(res) == num {
-					err := commit()
-					if err != nil {
-						return err
-					}
-
-				}
-			case <-ticker.C:
-				if len(res) > 0 {
-					err := commit()
-					if err != nil {
-						return err
-					}
-				}
-			}
-		}
-	last:
-		if len(res) > 0 {
-			err := commit()
-			if err != nil {
-				return err
-			}
-		}
-		return nil
+		_, err := m.InsertWith(q, NewWriterConfig())(ch)
+		return err
 	}
 
 }
 
-func (m *DB) do(data [][]any, query query.SqlInsert) error {
+func (m *DB) do(data [][]any, q query.SqlInsert) error {
 
-	query.AddValues(data...)
-	stmt, args := query.Build()
+	stmt, args := buildInsert(q, data)
 
-	defer query.Clear()
+	if m.DryRun != nil {
+		m.DryRun(stmt, args)
+		return nil
+	}
 
-	tj, err := m.Con.Begin()
+	return withTx(m.Con, func(tj *sql.Tx) error {
 
-	defer func() {
+		smt, err := tj.Prepare(stmt)
 		if err != nil {
-			tj.Rollback()
+			return err
 		}
-	}()
+		defer smt.Close()
 
-	if err != nil {
+		_, err = smt.Exec(args...)
 		return err
-	}
+	})
+}
+
+// withTx 在事务中执行 fn，fn 返回错误时回滚，否则提交
+func withTx(con *sql.DB, fn func(tj *sql.Tx) error) error {
 
-	smt, err := tj.Prepare(stmt)
+	tj, err := con.Begin()
 	if err != nil {
 		return err
 	}
 
-	_, err = smt.Exec(args...)
-	if err != nil {
+	if err := fn(tj); err != nil {
+		tj.Rollback()
 		return err
 	}
-	err = tj.Commit()
 
-	return err
+	return tj.Commit()
 }
 
 // QueryOne 方法执行一个 SQL 查询语句，并返回查询结果的第一列数据。
@@ -159,7 +127,7 @@ func (m *DB) do(data [][]any, query query.SqlInsert) error {
 //	一个函数，无参数，返回查询结果的第一列数据和可能的错误。
 func (m *DB) QueryOne(query *query.SQLBuilder) func() ([]string, error) {
 
-	query_ := query.Build()
+	query_, args := query.BuildArgsFor(m.Dialect)
 
 	num, err := m.QueryCount(query)
 
@@ -171,7 +139,7 @@ func (m *DB) QueryOne(query *query.SQLBuilder) func() ([]string, error) {
 
 	return func() ([]string, error) {
 
-		rows, err := m.Con.Query(query_)
+		rows, err := m.Con.Query(query_, args...)
 
 		if err != nil {
 			return nil, err
@@ -204,7 +172,7 @@ func (m *DB) QueryOne(query *query.SQLBuilder) func() ([]string, error) {
 //	一个函数，无参数，返回查询结果的两列数据作为键值对的映射和可能的错误。
 func (m *DB) QueryTwo(query *query.SQLBuilder) func() (map[string]string, error) {
 
-	query_ := query.Build()
+	query_, args := query.BuildArgsFor(m.Dialect)
 
 	num, err := m.QueryCount(query)
 
@@ -215,7 +183,7 @@ func (m *DB) QueryTwo(query *query.SQLBuilder) func() (map[string]string, error)
 	}
 	return func() (map[string]string, error) {
 
-		rows, err := m.Con.Query(query_)
+		rows, err := m.Con.Query(query_, args...)
 
 		if err != nil {
 			return nil, err
@@ -248,7 +216,7 @@ func (m *DB) QueryTwo(query *query.SQLBuilder) func() (map[string]string, error)
 //	一个函数，无参数，返回查询结果的所有列数据和可能的错误。
 func (m *DB) QueryArr(query *query.SQLBuilder) func() ([][]string, error) {
 
-	query_ := query.Build()
+	query_, args := query.BuildArgsFor(m.Dialect)
 
 	num, err := m.QueryCount(query)
 
@@ -260,7 +228,7 @@ func (m *DB) QueryArr(query *query.SQLBuilder) func() ([][]string, error) {
 
 	return func() ([][]string, error) {
 
-		rows, err := m.Con.Query(query_)
+		rows, err := m.Con.Query(query_, args...)
 		if err != nil {
 			return nil, err
 		}
@@ -308,7 +276,7 @@ func (m *DB) QueryArr(query *query.SQLBuilder) func() ([][]string, error) {
 func (m *DB) QueryIter(query *query.SQLBuilder) func() (chan []string, chan error) {
 
 	return func() (chan []string, chan error) {
-		query_ := query.Build()
+		query_, args := query.BuildArgsFor(m.Dialect)
 		ch := make(chan []string, 100)
 		errs := make(chan error, 1)
 
@@ -316,19 +284,25 @@ func (m *DB) QueryIter(query *query.SQLBuilder) func() (chan []string, chan erro
 			defer close(ch)
 			defer close(errs)
 
-			rows, err := m.Con.Query(query_)
+			rows, err := m.Con.Query(query_, args...)
 			if err != nil {
 				errs <- err
 				return
 			}
 
+			defer rows.Close()
+
 			columns, err := rows.Columns()
 
 			if err != nil {
 				errs <- err
 				return
 			}
-			defer m.Con.Close()
+
+			// 非共享连接沿用原来的行为，读取结束后关闭
+			if !m.shared {
+				defer m.Con.Close()
+			}
 
 			lc := len(columns)
 			for rows.Next() {
@@ -366,8 +340,12 @@ func (m *DB) QueryIter(query *query.SQLBuilder) func() (chan []string, chan erro
 //	查询结果的行数和可能的错误。
 func (m *DB) QueryCount(query *query.SQLBuilder) (int, error) {
 
-	query_ := query.Build()
-	rows, err := m.Con.Query(CountQuery(query_))
+	query_, args := query.BuildArgsFor(m.Dialect)
+	count, err := countQueryFor(query_, m.Dialect)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := m.Con.Query(count, args...)
 	if err != nil {
 		return 0, err
 	}
@@ -389,7 +367,8 @@ func (m *DB) QueryField(query *query.SQLBuilder) ([]string, error) {
 
 	q := query.Copy()
 
-	rows, err := m.Con.Query(q.Eq("1", 2).Build())
+	query_, args := q.Eq("1", 2).BuildArgsFor(m.Dialect)
+	rows, err := m.Con.Query(query_, args...)
 	if err != nil {
 		return []string{}, err
 	}
@@ -410,7 +389,7 @@ func (m *DB) QueryField(query *query.SQLBuilder) ([]string, error) {
 //	查询结果的每一列数据是一个二维切片，其中每一行是一个一维切片，代表查询结果的一列数据。
 func (m *DB) QueryVector(query *query.SQLBuilder) func() ([][]string, error) {
 
-	query_ := query.Build()
+	query_, args := query.BuildArgsFor(m.Dialect)
 
 	num, err := m.QueryCount(query)
 
@@ -421,7 +400,7 @@ func (m *DB) QueryVector(query *query.SQLBuilder) func() ([][]string, error) {
 	}
 	return func() ([][]string, error) {
 
-		rows, err := m.Con.Query(query_)
+		rows, err := m.Con.Query(query_, args...)
 		if err != nil {
 			return nil, err
 		}
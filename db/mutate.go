@@ -0,0 +1,140 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/frankill/gotools/query"
+)
+
+// Exec 方法执行一条 UPDATE 或 DELETE 语句。
+// 参数:
+//
+//	q - UpdateBuilder 或 DeleteBuilder。
+//
+// 返回:
+//
+//	受影响的行数和可能的错误，DryRun 模式下行数为 0。
+func (m *DB) Exec(q query.Mutation) (int64, error) {
+
+	stmt, args := q.BuildArgsFor(m.Dialect)
+
+	if m.DryRun != nil {
+		m.DryRun(stmt, args)
+		return 0, nil
+	}
+
+	res, err := m.Con.Exec(stmt, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// UpdateBatch 方法从一个通道接收数据，按行执行 UPDATE 或 DELETE，每 1000 行或每 10 秒提交一次事务。
+// 每行数据依次对应 q 中 Columns、Keys 添加的按行绑定的列，例如按主键更新:
+//
+//	NewUpdateBuilder("t").Columns("name", "age").Keys("id") 对应的数据为 []any{name, age, id}
+//
+// ClickHouse 方言下每行会生成一次 mutation，开销较大，只适合少量数据。
+// 参数:
+//
+//	q - UpdateBuilder 或 DeleteBuilder。
+//
+// 返回:
+//
+//	一个函数，接受一个通道，执行更新操作。
+func (m *DB) UpdateBatch(q query.Mutation) func(ch chan []any) error {
+
+	return func(ch chan []any) error {
+
+		stmt, args := q.BuildArgsFor(m.Dialect)
+
+		num := 1000
+		res := make([][]any, 0, num)
+
+		ticker := time.NewTicker(time.Second * 10)
+		defer ticker.Stop()
+
+		commit := func() error {
+			if err := m.execBatch(stmt, args, res); err != nil {
+				return err
+			}
+			res = res[:0]
+			return nil
+		}
+
+		for {
+			select {
+			case data, ok := <-ch:
+
+				if !ok {
+					goto last
+				}
+
+				if len(data) == 0 {
+					continue
+				}
+
+				res = append(res, data)
+
+				if len(res) == num {
+					err := commit()
+					if err != nil {
+						return err
+					}
+				}
+			case <-ticker.C:
+				if len(res) > 0 {
+					err := commit()
+					if err != nil {
+						return err
+					}
+				}
+			}
+		}
+	last:
+		if len(res) > 0 {
+			err := commit()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func (m *DB) execBatch(stmt string, args []any, rows [][]any) error {
+
+	if m.DryRun != nil {
+		for _, row := range rows {
+			bound, err := query.BindRow(args, row)
+			if err != nil {
+				return err
+			}
+			m.DryRun(stmt, bound)
+		}
+		return nil
+	}
+
+	return withTx(m.Con, func(tj *sql.Tx) error {
+
+		smt, err := tj.Prepare(stmt)
+		if err != nil {
+			return err
+		}
+		defer smt.Close()
+
+		for _, row := range rows {
+			bound, err := query.BindRow(args, row)
+			if err != nil {
+				return err
+			}
+			if _, err := smt.Exec(bound...); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
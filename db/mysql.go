@@ -2,10 +2,9 @@ package db
 
 import (
 	"database/sql"
-	"log"
-	"strings"
 
 	"github.com/frankill/gotools/query"
+	"github.com/go-sql-driver/mysql"
 )
 
 type MysqlDB struct {
@@ -14,42 +13,45 @@ type MysqlDB struct {
 }
 
 // NewMysqlDB 创建一个新的MysqlDB实例，通过建立与MySQL数据库的连接。
+// 需要在多处复用连接时使用 Registry.Mysql。
 // 参数:
 //
 //	con - 用于连接到MySQL数据库的连接字符串。
 //
 // 返回:
 //
-//	指向新创建的MysqlDB实例的指针。
-func NewMysqlDB(dsn string) *MysqlDB {
+//	指向新创建的MysqlDB实例的指针，以及连接字符串无效时的错误。
+func NewMysqlDB(dsn string) (*MysqlDB, error) {
 
-	db, err := sql.Open("mysql", dsn)
-
-	parts := strings.Split(dsn, "/")
-	database := parts[len(parts)-1]
-
-	// 移除可能的查询参数
-	database = strings.Split(database, "?")[0]
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
 
+	db, err := sql.Open("mysql", dsn)
 	if err != nil {
-		log.Panic(err)
+		return nil, err
 	}
+
 	return &MysqlDB{
 		DB{
-			Con: db,
+			Con:     db,
+			Dialect: query.MySQL,
+			Loc:     cfg.Loc,
 		},
-		database,
-	}
+		cfg.DBName,
+	}, nil
 }
 
 type TableInfo struct {
-	Field   string
-	Type    string
-	Null    string
-	Key     string
-	Default string
-	Extra   string
-	Comment string
+	Field      string
+	Type       string
+	Null       string
+	Key        string
+	Default    string
+	HasDefault bool // 列是否有默认值，用于区分空字符串默认值和没有默认值
+	Extra      string
+	Comment    string
 }
 
 func (m *MysqlDB) QueryTableInfo(table string) ([]TableInfo, error) {
@@ -57,10 +59,12 @@ func (m *MysqlDB) QueryTableInfo(table string) ([]TableInfo, error) {
 	q := query.NewSQLBuilder().From("INFORMATION_SCHEMA.COLUMNS ").
 		Eq("TABLE_NAME", table).
 		Eq("TABLE_SCHEMA", m.database).
-		Select("COLUMN_NAME", "COLUMN_TYPE", "IS_NULLABLE", "COLUMN_KEY", "COLUMN_DEFAULT", "EXTRA", "COLUMN_COMMENT")
+		Select("COLUMN_NAME", "COLUMN_TYPE", "IS_NULLABLE", "COLUMN_KEY", "COLUMN_DEFAULT", "EXTRA", "COLUMN_COMMENT").
+		OrderBy("ORDINAL_POSITION")
 
 	// 准备查询
-	rows, err := m.Con.Query(q.Build())
+	query_, args := q.BuildArgsFor(m.Dialect)
+	rows, err := m.Con.Query(query_, args...)
 	if err != nil {
 		return []TableInfo{}, err
 	}
@@ -77,6 +81,7 @@ func (m *MysqlDB) QueryTableInfo(table string) ([]TableInfo, error) {
 		}
 
 		ti.Default = def.String
+		ti.HasDefault = def.Valid
 
 		info = append(info, ti)
 	}
@@ -0,0 +1,357 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+// PoolConfig 连接池设置
+type PoolConfig struct {
+	MaxOpen        int           // 最大连接数，0 表示不限制
+	MaxIdle        int           // 最大空闲连接数
+	MaxLifetime    time.Duration // 连接最长使用时间，0 表示不限制
+	MaxIdleTime    time.Duration // 连接最长空闲时间，0 表示不限制
+	PingTimeout    time.Duration // 健康检查超时时间
+	HealthInterval time.Duration // 获取连接时距上次健康检查超过该时间则重新检查，0 表示每次都检查
+}
+
+// NewPoolConfig 连接池设置，默认最多 20 个连接、10 个空闲连接，连接最长使用 30 分钟，
+// 健康检查超时 5 秒、间隔 1 分钟
+func NewPoolConfig() *PoolConfig {
+
+	return &PoolConfig{
+		MaxOpen:        20,
+		MaxIdle:        10,
+		MaxLifetime:    30 * time.Minute,
+		MaxIdleTime:    5 * time.Minute,
+		PingTimeout:    5 * time.Second,
+		HealthInterval: time.Minute,
+	}
+}
+
+func (p *PoolConfig) SetMaxOpen(n int) *PoolConfig {
+	p.MaxOpen = n
+
+	return p
+}
+
+func (p *PoolConfig) SetMaxIdle(n int) *PoolConfig {
+	p.MaxIdle = n
+
+	return p
+}
+
+func (p *PoolConfig) SetMaxLifetime(d time.Duration) *PoolConfig {
+	p.MaxLifetime = d
+
+	return p
+}
+
+func (p *PoolConfig) SetMaxIdleTime(d time.Duration) *PoolConfig {
+	p.MaxIdleTime = d
+
+	return p
+}
+
+func (p *PoolConfig) SetPingTimeout(d time.Duration) *PoolConfig {
+	p.PingTimeout = d
+
+	return p
+}
+
+func (p *PoolConfig) SetHealthInterval(d time.Duration) *PoolConfig {
+	p.HealthInterval = d
+
+	return p
+}
+
+func (p *PoolConfig) apply(con *sql.DB) {
+	con.SetMaxOpenConns(p.MaxOpen)
+	con.SetMaxIdleConns(p.MaxIdle)
+	con.SetConnMaxLifetime(p.MaxLifetime)
+	con.SetConnMaxIdleTime(p.MaxIdleTime)
+}
+
+// pinger *sql.DB 与 driver.Conn 共有的方法
+type pinger interface {
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+type sqlPinger struct {
+	*sql.DB
+}
+
+func (p sqlPinger) Ping(ctx context.Context) error {
+	return p.PingContext(ctx)
+}
+
+// entry 一个共享连接，mu 保护建立连接和健康检查，不同连接之间互不阻塞
+type entry struct {
+	mu      sync.Mutex
+	con     any
+	p       pinger
+	checked time.Time
+	removed bool // 已从注册表中移除，等待该连接的使用方需要重新获取
+}
+
+// Registry 按连接字符串共享数据库连接，同一个 DSN 只建立一个连接池。
+// 通过 Registry 获取的连接的 Close 方法不会关闭底层连接，由 Registry.Close 统一关闭。
+type Registry struct {
+	Pool *PoolConfig
+
+	mu      sync.Mutex
+	entries map[string]*entry
+}
+
+// DefaultRegistry iter 中以连接字符串或 CKinfo 为参数的函数使用的默认连接注册表
+var DefaultRegistry = NewRegistry(NewPoolConfig())
+
+// NewRegistry 创建连接注册表，pool 为 nil 时使用默认设置
+func NewRegistry(pool *PoolConfig) *Registry {
+
+	if pool == nil {
+		pool = NewPoolConfig()
+	}
+
+	return &Registry{
+		Pool:    pool,
+		entries: map[string]*entry{},
+	}
+}
+
+// entry 返回 key 对应的连接项，不存在时创建一个空的连接项
+func (r *Registry) entry(key string) *entry {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e, ok := r.entries[key]
+	if !ok {
+		e = &entry{}
+		r.entries[key] = e
+	}
+
+	return e
+}
+
+// remove 从注册表中移除 e，调用方需持有 e.mu
+func (r *Registry) remove(key string, e *entry) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.entries[key] == e {
+		delete(r.entries, key)
+	}
+	e.removed = true
+}
+
+// get 返回 key 对应的连接，不存在时通过 open 建立。
+// 建立连接和健康检查只锁住该连接，不会阻塞其他 DSN 的获取。
+// 已有连接健康检查失败时返回错误但保留连接，连接池会在之后自动重连，其他使用方不受影响。
+func (r *Registry) get(key string, open func() (any, pinger, error)) (any, error) {
+
+	for {
+		e := r.entry(key)
+
+		e.mu.Lock()
+		if e.removed {
+			// 等待期间连接建立失败或注册表已关闭，重新获取
+			e.mu.Unlock()
+			continue
+		}
+
+		con, err := r.check(key, e, open)
+		e.mu.Unlock()
+
+		return con, err
+	}
+}
+
+// check 在持有 e.mu 时建立连接或做健康检查
+func (r *Registry) check(key string, e *entry, open func() (any, pinger, error)) (any, error) {
+
+	if e.p != nil {
+		if time.Since(e.checked) < r.Pool.HealthInterval {
+			return e.con, nil
+		}
+		if err := r.ping(e.p); err != nil {
+			return nil, err
+		}
+		e.checked = time.Now()
+		return e.con, nil
+	}
+
+	con, p, err := open()
+	if err != nil {
+		r.remove(key, e)
+		return nil, err
+	}
+
+	if err := r.ping(p); err != nil {
+		p.Close()
+		r.remove(key, e)
+		return nil, err
+	}
+
+	e.con, e.p, e.checked = con, p, time.Now()
+
+	return con, nil
+}
+
+func (r *Registry) ping(p pinger) error {
+
+	ctx := context.Background()
+	if r.Pool.PingTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Pool.PingTimeout)
+		defer cancel()
+	}
+
+	return p.Ping(ctx)
+}
+
+// Mysql 返回 dsn 对应的共享 MySQL 连接，首次获取时建立连接并做健康检查。
+// 参数:
+//
+//	dsn - MySQL 连接字符串。
+//
+// 返回:
+//
+//	共享的 MysqlDB 实例和可能的错误。
+func (r *Registry) Mysql(dsn string) (*MysqlDB, error) {
+
+	con, err := r.get("mysql|"+dsn, func() (any, pinger, error) {
+		m, err := NewMysqlDB(dsn)
+		if err != nil {
+			return nil, nil, err
+		}
+		m.shared = true
+		r.Pool.apply(m.Con)
+		return m, sqlPinger{m.Con}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return con.(*MysqlDB), nil
+}
+
+// ckKey 由 CKinfo 生成连接的唯一标识
+func ckKey(kind string, ck *CKinfo) string {
+
+	hosts := append([]string{}, ck.HostPost...)
+	sort.Strings(hosts)
+
+	settings := make([]string, 0, len(ck.Settings))
+	for k, v := range ck.Settings {
+		settings = append(settings, k+"="+v)
+	}
+	sort.Strings(settings)
+
+	return fmt.Sprintf("%s|%s|%s|%s|%s|%t|%s", kind, strings.Join(hosts, ","), ck.Database, ck.User, ck.Pwd,
+		ck.Tls != nil, strings.Join(settings, "&"))
+}
+
+// CK 返回 ck 对应的共享 ClickHouse 连接（database/sql 接口），用于 CK 的查询和写入方法。
+func (r *Registry) CK(ck *CKinfo) (*CK, error) {
+
+	con, err := r.get(ckKey("ck", ck), func() (any, pinger, error) {
+		c := NewCK(ck)
+		c.shared = true
+		r.Pool.apply(c.Con)
+		return c, sqlPinger{c.Con}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return con.(*CK), nil
+}
+
+// CKConn 返回 ck 对应的共享 ClickHouse 原生连接，用于 iter.FromCK 等按结构体读取的函数。
+// 返回的连接由 Registry 管理，使用方不要关闭。
+func (r *Registry) CKConn(ck *CKinfo) (driver.Conn, error) {
+
+	con, err := r.get(ckKey("native", ck), func() (any, pinger, error) {
+		opt := ckOptions(ck)
+		opt.MaxOpenConns = r.Pool.MaxOpen
+		opt.MaxIdleConns = r.Pool.MaxIdle
+		opt.ConnMaxLifetime = r.Pool.MaxLifetime
+		conn, err := clickhouse.Open(opt)
+		if err != nil {
+			return nil, nil, err
+		}
+		return conn, conn, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return con.(driver.Conn), nil
+}
+
+// snapshot 返回当前所有连接项，clear 为 true 时同时清空注册表
+func (r *Registry) snapshot(clear bool) []*entry {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	res := make([]*entry, 0, len(r.entries))
+	for k, e := range r.entries {
+		res = append(res, e)
+		if clear {
+			delete(r.entries, k)
+		}
+	}
+
+	return res
+}
+
+// Ping 对所有连接做健康检查，返回失败的连接的错误
+func (r *Registry) Ping() error {
+
+	var errs []error
+	for _, e := range r.snapshot(false) {
+		e.mu.Lock()
+		if e.p != nil {
+			if err := r.ping(e.p); err != nil {
+				errs = append(errs, err)
+			} else {
+				e.checked = time.Now()
+			}
+		}
+		e.mu.Unlock()
+	}
+
+	return errors.Join(errs...)
+}
+
+// Close 关闭并移除所有连接，正在建立的连接会在建立完成后关闭
+func (r *Registry) Close() error {
+
+	var errs []error
+	for _, e := range r.snapshot(true) {
+		e.mu.Lock()
+		e.removed = true
+		if e.p != nil {
+			if err := e.p.Close(); err != nil {
+				errs = append(errs, err)
+			}
+			e.p = nil
+		}
+		e.mu.Unlock()
+	}
+
+	return errors.Join(errs...)
+}
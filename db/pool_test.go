@@ -0,0 +1,42 @@
+package db_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/frankill/gotools/db"
+)
+
+func TestRegistryErrors(t *testing.T) {
+
+	if _, err := db.NewMysqlDB("not a dsn"); err == nil {
+		t.Errorf("Expected DSN error")
+	}
+
+	r := db.NewRegistry(db.NewPoolConfig().SetPingTimeout(time.Second))
+	defer r.Close()
+
+	// 端口 1 无法连接，健康检查失败时返回错误而不是 panic
+	dsn := "u:p@tcp(127.0.0.1:1)/test?timeout=1s"
+	if _, err := r.Mysql(dsn); err == nil {
+		t.Errorf("Expected ping error")
+	}
+
+	// 并发获取时每次都重新建立连接并返回错误，失败的连接不会留在注册表中
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := r.Mysql(dsn); err == nil {
+				t.Errorf("Expected ping error")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := r.Ping(); err != nil {
+		t.Errorf("Expected no registered connections, got %v", err)
+	}
+}
@@ -0,0 +1,492 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+	scannerType    = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+
+	structFieldsCache sync.Map
+)
+
+// StructField 结构体中与数据库列对应的字段
+type StructField struct {
+	Name    string       // 列名，取自标签，没有标签时为字段名
+	Index   []int        // 字段下标，嵌入结构体的字段包含多级下标
+	Options []string     // 标签中列名之后的选项，如 omitempty
+	Type    reflect.Type // 字段类型
+}
+
+// HasOption 判断标签中是否包含指定选项
+func (f StructField) HasOption(opt string) bool {
+	for _, o := range f.Options {
+		if o == opt {
+			return true
+		}
+	}
+	return false
+}
+
+type structFieldsKey struct {
+	t   reflect.Type
+	tag string
+}
+
+// StructFields 返回结构体中与数据库列对应的字段，结果按类型和标签缓存。
+// 标签格式为 `mysql:"name,opt1,opt2"`，name 为 - 时忽略该字段，为空时使用字段名；
+// 没有标签的嵌入结构体会展开其字段，同名时外层字段优先。
+func StructFields(t reflect.Type, tag string) []StructField {
+
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	key := structFieldsKey{t, tag}
+	if v, ok := structFieldsCache.Load(key); ok {
+		return v.([]StructField)
+	}
+
+	type entry struct {
+		f     StructField
+		depth int
+	}
+
+	var (
+		order  []string
+		fields = map[string]entry{}
+	)
+
+	var walk func(t reflect.Type, index []int, depth int)
+	walk = func(t reflect.Type, index []int, depth int) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+
+			tagValue, hasTag := f.Tag.Lookup(tag)
+			parts := strings.Split(tagValue, ",")
+			name := strings.TrimSpace(parts[0])
+
+			if name == "-" && len(parts) == 1 {
+				continue
+			}
+
+			idx := append(append([]int{}, index...), i)
+
+			if f.Anonymous && !hasTag {
+				ft := f.Type
+				if ft.Kind() == reflect.Pointer {
+					ft = ft.Elem()
+				}
+				if ft.Kind() == reflect.Struct && ft != timeType && !reflect.PointerTo(ft).Implements(scannerType) {
+					walk(ft, idx, depth+1)
+					continue
+				}
+			}
+
+			if !f.IsExported() {
+				continue
+			}
+
+			if name == "" {
+				name = f.Name
+			}
+
+			if old, ok := fields[name]; ok && old.depth <= depth {
+				continue
+			} else if !ok {
+				order = append(order, name)
+			}
+
+			fields[name] = entry{
+				f:     StructField{Name: name, Index: idx, Options: parts[1:], Type: f.Type},
+				depth: depth,
+			}
+		}
+	}
+
+	if t.Kind() == reflect.Struct {
+		walk(t, nil, 0)
+	}
+
+	res := make([]StructField, 0, len(order))
+	for _, name := range order {
+		res = append(res, fields[name].f)
+	}
+
+	structFieldsCache.Store(key, res)
+
+	return res
+}
+
+// fieldByIndex 按下标获取字段，途中遇到 nil 指针时分配新值
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for _, i := range index {
+		if v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	return v
+}
+
+// InsertPlan 结构体字段到插入列的映射
+type InsertPlan struct {
+	Columns []string // 插入的列，按字段顺序排列
+	Update  []string // 标签中带 upsert 选项的列，冲突时更新
+	index   [][]int
+}
+
+type insertPlanKey structFieldsKey
+
+var insertPlanCache sync.Map
+
+// StructInsertPlan 返回结构体类型 t 按标签 tag 插入时的列，结果按类型和标签缓存。
+// 标签为 - 或带 omitempty、auto 选项的字段不会插入，由数据库生成值，如自增主键 `mysql:"id,omitempty"`，
+// auto 同时用于 CreateTable 生成自增列；
+// 带 upsert 选项的字段在冲突时更新，如 `mysql:"name,upsert"`。
+func StructInsertPlan(t reflect.Type, tag string) *InsertPlan {
+
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	key := insertPlanKey{t, tag}
+	if v, ok := insertPlanCache.Load(key); ok {
+		return v.(*InsertPlan)
+	}
+
+	p := &InsertPlan{}
+	for _, f := range StructFields(t, tag) {
+		if f.HasOption("omitempty") || f.HasOption("auto") {
+			continue
+		}
+		p.Columns = append(p.Columns, f.Name)
+		p.index = append(p.index, f.Index)
+		if f.HasOption("upsert") {
+			p.Update = append(p.Update, f.Name)
+		}
+	}
+
+	insertPlanCache.Store(key, p)
+
+	return p
+}
+
+// Values 按 Columns 的顺序返回结构体 v 的字段值，v 可以是结构体或结构体指针，
+// 经过 nil 嵌入指针的字段值为 nil
+func (p *InsertPlan) Values(v any) []any {
+
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		rv = rv.Elem()
+	}
+
+	res := make([]any, len(p.index))
+	for i, index := range p.index {
+		if f, ok := fieldValue(rv, index); ok && f.CanInterface() {
+			res[i] = f.Interface()
+		}
+	}
+	return res
+}
+
+// fieldValue 按下标获取字段，途中遇到 nil 指针时返回 false
+func fieldValue(v reflect.Value, index []int) (reflect.Value, bool) {
+	for _, i := range index {
+		if v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	return v, true
+}
+
+// StructScanner 将查询结果的列映射到结构体字段
+type StructScanner struct {
+	columns []string
+	fields  [][]int // 每一列对应的字段下标，nil 表示没有对应字段
+	loc     *time.Location
+}
+
+// NewStructScanner 根据查询结果的列名创建 StructScanner。
+// 列名先按标签或字段名精确匹配，再忽略大小写匹配，没有对应字段的列会被丢弃。
+// 参数:
+//
+//   - t - 结构体类型
+//   - tag - 标签名，如 mysql
+//   - columns - 查询结果的列名
+//   - loc - 解析没有时区信息的时间时使用的时区，为 nil 时使用 UTC
+//
+// 返回:
+//
+//   - *StructScanner
+func NewStructScanner(t reflect.Type, tag string, columns []string, loc *time.Location) *StructScanner {
+
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	exact := map[string][]int{}
+	fold := map[string][]int{}
+	for _, f := range StructFields(t, tag) {
+		exact[f.Name] = f.Index
+		if _, ok := fold[strings.ToLower(f.Name)]; !ok {
+			fold[strings.ToLower(f.Name)] = f.Index
+		}
+	}
+
+	s := &StructScanner{columns: columns, fields: make([][]int, len(columns)), loc: loc}
+	for i, c := range columns {
+		if idx, ok := exact[c]; ok {
+			s.fields[i] = idx
+		} else {
+			s.fields[i] = fold[strings.ToLower(c)]
+		}
+	}
+
+	return s
+}
+
+// Dest 返回用于 rows.Scan 的目标列表，v 必须是可寻址的结构体，如 reflect.ValueOf(&x).Elem()
+func (s *StructScanner) Dest(v reflect.Value) []any {
+
+	dest := make([]any, len(s.fields))
+	for i, idx := range s.fields {
+		if idx == nil {
+			dest[i] = new(any)
+			continue
+		}
+		dest[i] = &fieldScanner{column: s.columns[i], v: fieldByIndex(v, idx), loc: s.loc}
+	}
+	return dest
+}
+
+// Scan 将当前行扫描到 dst 中，dst 必须是结构体指针
+func (s *StructScanner) Scan(rows *sql.Rows, dst any) error {
+	return rows.Scan(s.Dest(reflect.ValueOf(dst).Elem())...)
+}
+
+// fieldScanner 将驱动返回的值转换为字段类型
+type fieldScanner struct {
+	column string
+	v      reflect.Value
+	loc    *time.Location
+}
+
+func (f *fieldScanner) Scan(src any) error {
+	if err := assign(f.v, src, f.loc); err != nil {
+		return fmt.Errorf("column %s: %w", f.column, err)
+	}
+	return nil
+}
+
+// 没有时区信息的时间格式，按顺序尝试
+var timeLayouts = []string{
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999Z07:00",
+	"2006-01-02",
+}
+
+func parseTime(s string, loc *time.Location) (time.Time, error) {
+
+	if s == "" || strings.HasPrefix(s, "0000-00-00") {
+		return time.Time{}, nil
+	}
+
+	var err error
+	for _, layout := range timeLayouts {
+		var t time.Time
+		if t, err = time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// assign 将驱动返回的值 src 赋给 v，src 为 nil 时 v 设为零值
+func assign(v reflect.Value, src any, loc *time.Location) error {
+
+	if v.CanAddr() && v.Kind() != reflect.Pointer {
+		if sc, ok := v.Addr().Interface().(sql.Scanner); ok {
+			return sc.Scan(src)
+		}
+	}
+
+	if src == nil {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+
+	if v.Kind() == reflect.Pointer {
+		p := reflect.New(v.Type().Elem())
+		if err := assign(p.Elem(), src, loc); err != nil {
+			return err
+		}
+		v.Set(p)
+		return nil
+	}
+
+	// 驱动返回的 []byte 在下一次 Scan 时会被复用，需要复制
+	if b, ok := src.([]byte); ok {
+		src = string(b)
+	}
+
+	switch v.Type() {
+	case timeType:
+		switch x := src.(type) {
+		case time.Time:
+			v.Set(reflect.ValueOf(x.In(loc)))
+		case string:
+			t, err := parseTime(x, loc)
+			if err != nil {
+				return err
+			}
+			v.Set(reflect.ValueOf(t))
+		default:
+			return fmt.Errorf("cannot convert %T to time.Time", src)
+		}
+		return nil
+	case rawMessageType:
+		v.SetBytes([]byte(fmt.Sprint(src)))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		switch x := src.(type) {
+		case string:
+			v.SetString(x)
+		case time.Time:
+			v.SetString(x.In(loc).Format("2006-01-02 15:04:05"))
+		default:
+			v.SetString(fmt.Sprint(x))
+		}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		switch x := src.(type) {
+		case int64:
+			n = x
+		case float64:
+			n = int64(x)
+		case bool:
+			if x {
+				n = 1
+			}
+		case string:
+			var err error
+			if n, err = strconv.ParseInt(x, 10, 64); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("cannot convert %T to %s", src, v.Type())
+		}
+		if v.OverflowInt(n) {
+			return fmt.Errorf("value %d overflows %s", n, v.Type())
+		}
+		v.SetInt(n)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var n uint64
+		switch x := src.(type) {
+		case int64:
+			if x < 0 {
+				return fmt.Errorf("value %d overflows %s", x, v.Type())
+			}
+			n = uint64(x)
+		case uint64:
+			n = x
+		case string:
+			var err error
+			if n, err = strconv.ParseUint(x, 10, 64); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("cannot convert %T to %s", src, v.Type())
+		}
+		if v.OverflowUint(n) {
+			return fmt.Errorf("value %d overflows %s", n, v.Type())
+		}
+		v.SetUint(n)
+
+	case reflect.Float32, reflect.Float64:
+		switch x := src.(type) {
+		case float64:
+			v.SetFloat(x)
+		case float32:
+			v.SetFloat(float64(x))
+		case int64:
+			v.SetFloat(float64(x))
+		case string:
+			n, err := strconv.ParseFloat(x, 64)
+			if err != nil {
+				return err
+			}
+			v.SetFloat(n)
+		default:
+			return fmt.Errorf("cannot convert %T to %s", src, v.Type())
+		}
+
+	case reflect.Bool:
+		switch x := src.(type) {
+		case bool:
+			v.SetBool(x)
+		case int64:
+			v.SetBool(x != 0)
+		case string:
+			b, err := strconv.ParseBool(x)
+			if err != nil {
+				return err
+			}
+			v.SetBool(b)
+		default:
+			return fmt.Errorf("cannot convert %T to %s", src, v.Type())
+		}
+
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			if x, ok := src.(string); ok {
+				v.SetBytes([]byte(x))
+				return nil
+			}
+		}
+		return assignJson(v, src)
+
+	case reflect.Struct, reflect.Map, reflect.Array:
+		return assignJson(v, src)
+
+	case reflect.Interface:
+		v.Set(reflect.ValueOf(src))
+
+	default:
+		return fmt.Errorf("unsupported field type %s", v.Type())
+	}
+
+	return nil
+}
+
+// assignJson 将 JSON 列解析到结构体、map 或切片
+func assignJson(v reflect.Value, src any) error {
+
+	x, ok := src.(string)
+	if !ok {
+		return fmt.Errorf("cannot convert %T to %s", src, v.Type())
+	}
+
+	return json.Unmarshal([]byte(x), v.Addr().Interface())
+}
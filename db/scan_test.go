@@ -0,0 +1,113 @@
+package db_test
+
+import (
+	"database/sql"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/frankill/gotools/db"
+)
+
+type scanBase struct {
+	ID   int64  `mysql:"id"`
+	Name string // 没有标签时使用字段名
+}
+
+type scanAttr struct {
+	Color string `json:"color"`
+	Size  int    `json:"size"`
+}
+
+type scanRow struct {
+	scanBase
+	Score   *float64        `mysql:"score"`
+	Count   int             `mysql:"cnt"`
+	Note    sql.NullString  `mysql:"note"`
+	Created time.Time       `mysql:"created"`
+	Attr    scanAttr        `mysql:"attr"`
+	Raw     json.RawMessage `mysql:"raw"`
+	Skip    string          `mysql:"-"`
+}
+
+func TestStructScanner(t *testing.T) {
+	loc := time.FixedZone("CST", 8*3600)
+	columns := []string{"id", "NAME", "score", "cnt", "note", "created", "attr", "raw", "extra", "Skip"}
+
+	s := db.NewStructScanner(reflect.TypeOf(scanRow{}), "mysql", columns, loc)
+
+	scan := func(values ...any) (scanRow, error) {
+		var row scanRow
+		for i, d := range s.Dest(reflect.ValueOf(&row).Elem()) {
+			if sc, ok := d.(sql.Scanner); ok {
+				if err := sc.Scan(values[i]); err != nil {
+					return row, err
+				}
+			}
+		}
+		return row, nil
+	}
+
+	row, err := scan([]byte("1"), []byte("a"), []byte("1.5"), []byte("3"), []byte("x"),
+		[]byte("2024-05-01 12:00:00"), []byte(`{"color":"red","size":2}`), []byte(`[1,2]`), []byte("e"), []byte("s"))
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+
+	if row.ID != 1 || row.Name != "a" || *row.Score != 1.5 || row.Count != 3 || row.Note.String != "x" ||
+		!row.Created.Equal(time.Date(2024, 5, 1, 12, 0, 0, 0, loc)) || row.Attr != (scanAttr{"red", 2}) ||
+		string(row.Raw) != "[1,2]" || row.Skip != "" {
+		t.Errorf("Unexpected row %+v", row)
+	}
+
+	// NULL 写入指针、sql.Null* 和普通数值字段
+	row, err = scan(int64(2), "b", nil, nil, nil, time.Date(2024, 5, 1, 4, 0, 0, 0, time.UTC), nil, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("Scan NULL failed: %v", err)
+	}
+	if row.Score != nil || row.Count != 0 || row.Note.Valid || row.Created.Location() != loc || row.Created.Hour() != 12 {
+		t.Errorf("Unexpected row %+v", row)
+	}
+
+	if _, err := scan([]byte("x"), nil, nil, nil, nil, nil, nil, nil, nil, nil); err == nil {
+		t.Error("Expected error for invalid int")
+	}
+}
+
+func TestStructInsertPlan(t *testing.T) {
+
+	type Base struct {
+		Created string `mysql:"created_at"`
+	}
+	type User struct {
+		ID    int    `mysql:"id,omitempty"`
+		Name  string `mysql:"name,upsert"`
+		Age   int    `mysql:"age"`
+		Cache string `mysql:"-"`
+		*Base
+	}
+
+	plan := db.StructInsertPlan(reflect.TypeOf(User{}), "mysql")
+	if !reflect.DeepEqual(plan.Columns, []string{"name", "age", "created_at"}) || !reflect.DeepEqual(plan.Update, []string{"name"}) {
+		t.Errorf("Unexpected plan %v %v", plan.Columns, plan.Update)
+	}
+	if plan != db.StructInsertPlan(reflect.TypeOf(&User{}), "mysql") {
+		t.Errorf("Expected cached plan")
+	}
+
+	// 经过 nil 嵌入指针的字段值为 nil
+	if values := plan.Values(&User{ID: 1, Name: "a", Age: 2}); !reflect.DeepEqual(values, []any{"a", 2, nil}) {
+		t.Errorf("Unexpected values %v", values)
+	}
+
+	// omitempty 与 auto 都不插入
+	type Row struct {
+		ID   int    `mysql:"id,omitempty"`
+		Seq  int    `mysql:"seq,auto"`
+		Name string `mysql:"name"`
+	}
+	if plan := db.StructInsertPlan(reflect.TypeOf(Row{}), "mysql"); !reflect.DeepEqual(plan.Columns, []string{"name"}) {
+		t.Errorf("Unexpected plan %v", plan.Columns)
+	}
+}
@@ -0,0 +1,605 @@
+package db
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/frankill/gotools/query"
+)
+
+// TableOptions 由结构体建表时的设置
+type TableOptions struct {
+	Engine      string   // 表引擎，为空时 MySQL 使用 InnoDB，ClickHouse 使用 MergeTree()
+	OrderBy     []string // ClickHouse 排序键表达式，为空时使用主键，没有主键时为 tuple()
+	PartitionBy string   // 分区表达式，MySQL 需要包含分区类型，如 RANGE (YEAR(created)) (...)
+	PrimaryKey  []string // 主键列，为空时使用标签中带 pk 选项的字段
+	Charset     string   // MySQL 字符集
+	IfNotExists bool     // 生成 CREATE TABLE IF NOT EXISTS
+}
+
+// NewTableOptions 建表设置，默认字符集 utf8mb4，生成 IF NOT EXISTS
+func NewTableOptions() *TableOptions {
+
+	return &TableOptions{
+		Charset:     "utf8mb4",
+		IfNotExists: true,
+	}
+}
+
+func (o *TableOptions) SetEngine(engine string) *TableOptions {
+	o.Engine = engine
+
+	return o
+}
+
+func (o *TableOptions) SetOrderBy(exprs ...string) *TableOptions {
+	o.OrderBy = exprs
+
+	return o
+}
+
+func (o *TableOptions) SetPartitionBy(expr string) *TableOptions {
+	o.PartitionBy = expr
+
+	return o
+}
+
+func (o *TableOptions) SetPrimaryKey(cols ...string) *TableOptions {
+	o.PrimaryKey = cols
+
+	return o
+}
+
+func (o *TableOptions) SetCharset(charset string) *TableOptions {
+	o.Charset = charset
+
+	return o
+}
+
+func (o *TableOptions) SetIfNotExists(b bool) *TableOptions {
+	o.IfNotExists = b
+
+	return o
+}
+
+// Column 由结构体字段生成的列定义
+type Column struct {
+	Name          string // 列名
+	Type          string // 列类型，ClickHouse 的可空类型包含 Nullable
+	Nullable      bool   // MySQL 中是否允许 NULL，指针字段或带 null 选项的字段允许
+	AutoIncrement bool   // 标签中带 auto 选项，仅用于 MySQL
+	PrimaryKey    bool   // 标签中带 pk 选项
+}
+
+func isCK(d query.Dialect) bool {
+	return d.Name() == query.ClickHouse.Name()
+}
+
+// schemaTag 返回方言对应的结构体标签，与 ToMysqlStruct、ToCKStruct 一致
+func schemaTag(d query.Dialect) (string, error) {
+	switch d.Name() {
+	case query.MySQL.Name():
+		return "mysql", nil
+	case query.ClickHouse.Name():
+		return "ch", nil
+	}
+	return "", fmt.Errorf("schema: unsupported dialect %s", d.Name())
+}
+
+// StructColumns 返回结构体 obj 对应的列定义，列名取自 mysql 或 ch 标签，见 StructFields。
+// 列类型默认由 Dialect.TypeName 生成，MySQL 可以通过 sql 标签指定，如 `sql:"VARCHAR(64)"`，与 GetSqlTags 读取的标签相同，
+// ClickHouse 通过 chtype 标签指定，如 `chtype:"LowCardinality(String)"`，两种数据库的类型互不影响；
+// 标签选项 pk 表示主键，auto 表示自增，null 表示非指针字段也允许 NULL。
+// 参数:
+//
+//	d - 方言，支持 MySQL 和 ClickHouse。
+//	obj - 结构体或结构体指针。
+//
+// 返回:
+//
+//	列定义和可能的错误。
+func StructColumns(d query.Dialect, obj any) ([]Column, error) {
+
+	tag, err := schemaTag(d)
+	if err != nil {
+		return nil, err
+	}
+
+	t := reflect.TypeOf(obj)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("schema: %T is not a struct", obj)
+	}
+
+	typeTag := "sql"
+	if isCK(d) {
+		typeTag = "chtype"
+	}
+
+	fields := StructFields(t, tag)
+	cols := make([]Column, 0, len(fields))
+
+	for _, f := range fields {
+
+		c := Column{
+			Name:          f.Name,
+			Type:          t.FieldByIndex(f.Index).Tag.Get(typeTag),
+			Nullable:      f.Type.Kind() == reflect.Pointer || f.HasOption("null"),
+			AutoIncrement: f.HasOption("auto"),
+			PrimaryKey:    f.HasOption("pk"),
+		}
+
+		if c.Type == "" {
+			c.Type = d.TypeName(f.Type)
+			if isCK(d) && f.HasOption("null") && f.Type.Kind() != reflect.Pointer {
+				c.Type = "Nullable(" + c.Type + ")"
+			}
+		}
+
+		cols = append(cols, c)
+	}
+
+	return cols, nil
+}
+
+// definition 返回列名之后的列定义
+func (c Column) definition(d query.Dialect) string {
+
+	if isCK(d) {
+		return c.Type
+	}
+
+	def := c.Type + " NOT NULL"
+	if c.Nullable {
+		def = c.Type + " NULL"
+	}
+	if c.AutoIncrement {
+		def += " AUTO_INCREMENT"
+	}
+	return def
+}
+
+// modifyDefinition 返回 MODIFY COLUMN 使用的列定义，保留表中原来的默认值和注释，old.HasDefault 为 false 时不写默认值
+func modifyDefinition(d query.Dialect, c Column, old TableInfo) string {
+
+	def := c.definition(d)
+
+	if isCK(d) {
+		// Extra 为 default_kind，如 DEFAULT、MATERIALIZED、ALIAS
+		if old.HasDefault {
+			kind := old.Extra
+			if kind == "" {
+				kind = "DEFAULT"
+			}
+			def += " " + kind + " " + old.Default
+		}
+	} else {
+		extra := strings.ToUpper(old.Extra)
+		if old.HasDefault {
+			// 表达式默认值（MySQL 8 的 DEFAULT_GENERATED、CURRENT_TIMESTAMP）和已带引号的默认值原样写入
+			up := strings.ToUpper(old.Default)
+			if strings.Contains(extra, "DEFAULT_GENERATED") || strings.HasPrefix(up, "CURRENT_TIMESTAMP") || strings.HasPrefix(old.Default, "'") {
+				def += " DEFAULT " + old.Default
+			} else {
+				def += " DEFAULT " + d.Literal(old.Default)
+			}
+		}
+		if i := strings.Index(extra, "ON UPDATE "); i >= 0 {
+			def += " " + old.Extra[i:]
+		}
+	}
+
+	if old.Comment != "" {
+		def += " COMMENT " + d.Literal(old.Comment)
+	}
+
+	return def
+}
+
+func quoteAll(d query.Dialect, cols []string) string {
+	res := make([]string, len(cols))
+	for i, c := range cols {
+		res[i] = d.Quote(c)
+	}
+	return strings.Join(res, ", ")
+}
+
+// CreateTable 由结构体生成 CREATE TABLE 语句。
+// 参数:
+//
+//	d - 方言，支持 MySQL 和 ClickHouse。
+//	table - 表名。
+//	obj - 结构体或结构体指针，列定义见 StructColumns。
+//	opt - 建表设置，为 nil 时使用 NewTableOptions。
+//
+// 返回:
+//
+//	建表语句和可能的错误。
+func CreateTable(d query.Dialect, table string, obj any, opt *TableOptions) (string, error) {
+
+	if opt == nil {
+		opt = NewTableOptions()
+	}
+
+	cols, err := StructColumns(d, obj)
+	if err != nil {
+		return "", err
+	}
+	if len(cols) == 0 {
+		return "", fmt.Errorf("schema: %T has no columns", obj)
+	}
+
+	pk := opt.PrimaryKey
+	if len(pk) == 0 {
+		for _, c := range cols {
+			if c.PrimaryKey {
+				pk = append(pk, c.Name)
+			}
+		}
+	}
+
+	var sb strings.Builder
+
+	sb.WriteString("CREATE TABLE ")
+	if opt.IfNotExists {
+		sb.WriteString("IF NOT EXISTS ")
+	}
+	sb.WriteString(d.Quote(table) + " (\n")
+
+	for i, c := range cols {
+		if i > 0 {
+			sb.WriteString(",\n")
+		}
+		sb.WriteString("  " + d.Quote(c.Name) + " " + c.definition(d))
+	}
+
+	if isCK(d) {
+
+		engine := opt.Engine
+		if engine == "" {
+			engine = "MergeTree()"
+		}
+		sb.WriteString("\n) ENGINE = " + engine)
+
+		orderBy := strings.Join(opt.OrderBy, ", ")
+		if len(opt.OrderBy) == 0 {
+			orderBy = quoteAll(d, pk)
+		}
+		if orderBy == "" {
+			sb.WriteString("\nORDER BY tuple()")
+		} else {
+			sb.WriteString("\nORDER BY (" + orderBy + ")")
+		}
+
+		if opt.PartitionBy != "" {
+			sb.WriteString("\nPARTITION BY " + opt.PartitionBy)
+		}
+		if len(opt.OrderBy) > 0 && len(pk) > 0 {
+			sb.WriteString("\nPRIMARY KEY (" + quoteAll(d, pk) + ")")
+		}
+
+		return sb.String(), nil
+	}
+
+	if len(pk) > 0 {
+		sb.WriteString(",\n  PRIMARY KEY (" + quoteAll(d, pk) + ")")
+	}
+
+	engine := opt.Engine
+	if engine == "" {
+		engine = "InnoDB"
+	}
+	sb.WriteString("\n) ENGINE=" + engine)
+
+	if opt.Charset != "" {
+		sb.WriteString(" DEFAULT CHARSET=" + opt.Charset)
+	}
+	if opt.PartitionBy != "" {
+		sb.WriteString("\nPARTITION BY " + opt.PartitionBy)
+	}
+
+	return sb.String(), nil
+}
+
+// ChangeKind 列差异的类型
+type ChangeKind string
+
+const (
+	ColumnAdded   ChangeKind = "add"    // 结构体中有、表中没有的列
+	ColumnChanged ChangeKind = "modify" // 类型或是否允许 NULL 不一致的列
+	ColumnExtra   ChangeKind = "extra"  // 表中有、结构体中没有的列，只报告，不生成删除语句
+)
+
+// ColumnChange 结构体与表结构的一处差异
+type ColumnChange struct {
+	Kind   ChangeKind
+	Column Column    // 结构体中的列定义，ColumnExtra 时只有列名
+	Old    TableInfo // 表中原来的列，ColumnAdded 时为空
+	After  string    // 新增列应位于其后的列，为空时位于第一列
+}
+
+var (
+	intWidth  = regexp.MustCompile(`^(tinyint|smallint|mediumint|int|bigint)\(\d+\)`)
+	typeAlias = map[string]string{
+		"bool":    "tinyint(1)",
+		"boolean": "tinyint(1)",
+		"integer": "int",
+	}
+)
+
+// normalizeType 统一类型的写法后再比较，MySQL 忽略大小写和整数显示宽度，ClickHouse 忽略空格
+func normalizeType(d query.Dialect, s string) string {
+
+	if isCK(d) {
+		return strings.ReplaceAll(s, " ", "")
+	}
+
+	s = strings.ToLower(strings.Join(strings.Fields(s), " "))
+	if v, ok := typeAlias[s]; ok {
+		return v
+	}
+	if strings.HasPrefix(s, "tinyint(1)") {
+		return s
+	}
+	return intWidth.ReplaceAllString(s, "$1")
+}
+
+// DiffTable 比较结构体与表结构，返回按结构体字段顺序排列的新增、变更的列，之后是表中多出的列。
+// 参数:
+//
+//	d - 方言，支持 MySQL 和 ClickHouse。
+//	obj - 结构体或结构体指针，列定义见 StructColumns。
+//	info - 表结构，由 MysqlDB.QueryTableInfo 或 CK.QueryTableInfo 获取。
+//
+// 返回:
+//
+//	差异列表和可能的错误。
+func DiffTable(d query.Dialect, obj any, info []TableInfo) ([]ColumnChange, error) {
+
+	cols, err := StructColumns(d, obj)
+	if err != nil {
+		return nil, err
+	}
+
+	live := make(map[string]TableInfo, len(info))
+	for _, ti := range info {
+		live[strings.ToLower(ti.Field)] = ti
+	}
+
+	var changes []ColumnChange
+	seen := make(map[string]bool, len(cols))
+
+	for i, c := range cols {
+
+		key := strings.ToLower(c.Name)
+		seen[key] = true
+
+		ti, ok := live[key]
+		if !ok {
+			ch := ColumnChange{Kind: ColumnAdded, Column: c}
+			if i > 0 {
+				ch.After = cols[i-1].Name
+			}
+			changes = append(changes, ch)
+			continue
+		}
+
+		changed := normalizeType(d, ti.Type) != normalizeType(d, c.Type)
+		if !isCK(d) {
+			changed = changed || (ti.Null == "YES") != c.Nullable
+		}
+		if changed {
+			changes = append(changes, ColumnChange{Kind: ColumnChanged, Column: c, Old: ti})
+		}
+	}
+
+	for _, ti := range info {
+		if !seen[strings.ToLower(ti.Field)] {
+			changes = append(changes, ColumnChange{Kind: ColumnExtra, Column: Column{Name: ti.Field}, Old: ti})
+		}
+	}
+
+	return changes, nil
+}
+
+// Migration 表结构迁移计划，String 返回可读的报告，用于执行前检查
+type Migration struct {
+	Table      string
+	Create     bool           // 表不存在，Statements 为建表语句
+	Changes    []ColumnChange // 结构体与表结构的差异
+	Statements []string       // 需要执行的语句
+}
+
+// PlanMigration 比较结构体与表结构，生成迁移计划。
+// info 为空时认为表不存在，生成建表语句；否则为新增、变更的列生成 ALTER TABLE 语句，表中多出的列只报告。
+// 参数:
+//
+//	d - 方言，支持 MySQL 和 ClickHouse。
+//	table - 表名。
+//	obj - 结构体或结构体指针，列定义见 StructColumns。
+//	info - 表结构。
+//	opt - 建表设置，只在表不存在时使用。
+//
+// 返回:
+//
+//	迁移计划和可能的错误。
+func PlanMigration(d query.Dialect, table string, obj any, info []TableInfo, opt *TableOptions) (*Migration, error) {
+
+	mg := &Migration{Table: table}
+
+	if len(info) == 0 {
+		stmt, err := CreateTable(d, table, obj, opt)
+		if err != nil {
+			return nil, err
+		}
+		mg.Create = true
+		mg.Statements = []string{stmt}
+		return mg, nil
+	}
+
+	changes, err := DiffTable(d, obj, info)
+	if err != nil {
+		return nil, err
+	}
+	mg.Changes = changes
+
+	for _, ch := range changes {
+		switch ch.Kind {
+		case ColumnAdded:
+			pos := " FIRST"
+			if ch.After != "" {
+				pos = " AFTER " + d.Quote(ch.After)
+			}
+			mg.Statements = append(mg.Statements, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s%s",
+				d.Quote(table), d.Quote(ch.Column.Name), ch.Column.definition(d), pos))
+		case ColumnChanged:
+			mg.Statements = append(mg.Statements, fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s %s",
+				d.Quote(table), d.Quote(ch.Column.Name), modifyDefinition(d, ch.Column, ch.Old)))
+		}
+	}
+
+	return mg, nil
+}
+
+// Empty 判断是否没有需要执行的语句
+func (mg *Migration) Empty() bool {
+	return len(mg.Statements) == 0
+}
+
+// String 返回迁移计划的报告
+func (mg *Migration) String() string {
+
+	var sb strings.Builder
+
+	switch {
+	case mg.Create:
+		fmt.Fprintf(&sb, "table %s: create\n", mg.Table)
+	case len(mg.Changes) == 0:
+		fmt.Fprintf(&sb, "table %s: up to date\n", mg.Table)
+	default:
+		fmt.Fprintf(&sb, "table %s: %d changes\n", mg.Table, len(mg.Changes))
+	}
+
+	for _, ch := range mg.Changes {
+		switch ch.Kind {
+		case ColumnAdded:
+			fmt.Fprintf(&sb, "  + %s %s\n", ch.Column.Name, ch.Column.Type)
+		case ColumnChanged:
+			fmt.Fprintf(&sb, "  ~ %s %s -> %s\n", ch.Column.Name, ch.Old.Type, ch.Column.Type)
+		case ColumnExtra:
+			fmt.Fprintf(&sb, "  ? %s %s (not in struct, kept)\n", ch.Column.Name, ch.Old.Type)
+		}
+	}
+
+	for _, stmt := range mg.Statements {
+		sb.WriteString(stmt + ";\n")
+	}
+
+	return sb.String()
+}
+
+// Migrate 方法按顺序执行迁移计划中的语句，DryRun 模式下只将语句传给 DryRun。
+// 参数:
+//
+//	mg - 迁移计划，由 PlanMigration、MysqlDB.SyncTable 或 CK.SyncTable 生成。
+//
+// 返回:
+//
+//	第一个执行失败的语句的错误，之前的语句不会回滚。
+func (m *DB) Migrate(mg *Migration) error {
+
+	for _, stmt := range mg.Statements {
+		if m.DryRun != nil {
+			m.DryRun(stmt, nil)
+			continue
+		}
+		if _, err := m.Con.Exec(stmt); err != nil {
+			return fmt.Errorf("schema: %s: %w", stmt, err)
+		}
+	}
+
+	return nil
+}
+
+// SyncTable 方法读取表结构并与结构体比较，返回迁移计划，不执行任何语句。
+// 确认报告后使用 Migrate 执行。
+// 参数:
+//
+//	table - 表名。
+//	obj - 结构体或结构体指针，列名取自 mysql 标签。
+//	opt - 建表设置，只在表不存在时使用。
+//
+// 返回:
+//
+//	迁移计划和可能的错误。
+func (m *MysqlDB) SyncTable(table string, obj any, opt *TableOptions) (*Migration, error) {
+
+	info, err := m.QueryTableInfo(table)
+	if err != nil {
+		return nil, err
+	}
+
+	return PlanMigration(query.MySQL, table, obj, info, opt)
+}
+
+// QueryTableInfo 方法从 system.columns 读取当前数据库中表的列信息，
+// Null 为 YES 表示 Nullable 类型，Key 为 PRI 表示主键列，Extra 为默认值的类型，如 DEFAULT、MATERIALIZED
+func (m *CK) QueryTableInfo(table string) ([]TableInfo, error) {
+
+	q := query.NewSQLBuilder().From("system.columns").
+		Select("name", "type", "default_kind", "default_expression", "comment", "is_in_primary_key").
+		Where("database = currentDatabase()").
+		Eq("table", table).
+		OrderBy("position")
+
+	query_, args := q.BuildArgsFor(m.Dialect)
+	rows, err := m.Con.Query(query_, args...)
+	if err != nil {
+		return []TableInfo{}, err
+	}
+	defer rows.Close()
+
+	var info []TableInfo
+
+	for rows.Next() {
+		var (
+			ti TableInfo
+			pk uint8
+		)
+		if err := rows.Scan(&ti.Field, &ti.Type, &ti.Extra, &ti.Default, &ti.Comment, &pk); err != nil {
+			return []TableInfo{}, err
+		}
+
+		ti.Null = "NO"
+		if strings.HasPrefix(ti.Type, "Nullable(") {
+			ti.Null = "YES"
+		}
+		if pk == 1 {
+			ti.Key = "PRI"
+		}
+		ti.HasDefault = ti.Extra != ""
+
+		info = append(info, ti)
+	}
+
+	if err := rows.Err(); err != nil {
+		return []TableInfo{}, err
+	}
+
+	return info, nil
+}
+
+// SyncTable 方法与 MysqlDB.SyncTable 相同，列名取自 ch 标签
+func (m *CK) SyncTable(table string, obj any, opt *TableOptions) (*Migration, error) {
+
+	info, err := m.QueryTableInfo(table)
+	if err != nil {
+		return nil, err
+	}
+
+	return PlanMigration(query.ClickHouse, table, obj, info, opt)
+}
@@ -0,0 +1,118 @@
+package db_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frankill/gotools/db"
+	"github.com/frankill/gotools/query"
+)
+
+func TestSchema(t *testing.T) {
+
+	type User struct {
+		ID      int64     `mysql:"id,pk,auto" ch:"id,pk"`
+		Name    string    `mysql:"name" ch:"name" sql:"VARCHAR(64)" chtype:"LowCardinality(String)"`
+		Email   *string   `mysql:"email" ch:"email"`
+		Tags    []string  `mysql:"-" ch:"tags"`
+		Created time.Time `mysql:"created_at" ch:"created_at"`
+	}
+
+	sql, err := db.CreateTable(query.MySQL, "users", User{}, nil)
+	expected := "CREATE TABLE IF NOT EXISTS `users` (\n" +
+		"  `id` BIGINT NOT NULL AUTO_INCREMENT,\n" +
+		"  `name` VARCHAR(64) NOT NULL,\n" +
+		"  `email` VARCHAR(255) NULL,\n" +
+		"  `created_at` DATETIME NOT NULL,\n" +
+		"  PRIMARY KEY (`id`)\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"
+	if err != nil || sql != expected {
+		t.Errorf("Expected SQL: %s, but got: %s %v", expected, sql, err)
+	}
+
+	opt := db.NewTableOptions().SetEngine("ReplacingMergeTree()").SetPartitionBy("toYYYYMM(created_at)").SetIfNotExists(false)
+	sql, err = db.CreateTable(query.ClickHouse, "users", &User{}, opt)
+	expected = "CREATE TABLE `users` (\n" +
+		"  `id` Int64,\n" +
+		"  `name` LowCardinality(String),\n" +
+		"  `email` Nullable(String),\n" +
+		"  `tags` Array(String),\n" +
+		"  `created_at` DateTime64(3)\n" +
+		") ENGINE = ReplacingMergeTree()\n" +
+		"ORDER BY (`id`)\n" +
+		"PARTITION BY toYYYYMM(created_at)"
+	if err != nil || sql != expected {
+		t.Errorf("Expected SQL: %s, but got: %s %v", expected, sql, err)
+	}
+
+	if _, err := db.CreateTable(query.PostgreSQL, "users", User{}, nil); err == nil {
+		t.Errorf("Expected unsupported dialect error")
+	}
+
+	info := []db.TableInfo{
+		{Field: "id", Type: "bigint(20)", Null: "NO", Key: "PRI"},
+		{Field: "name", Type: "varchar(32)", Null: "NO", Default: "guest", HasDefault: true, Comment: "user's name"},
+		{Field: "legacy", Type: "int(11)", Null: "YES"},
+	}
+
+	mg, err := db.PlanMigration(query.MySQL, "users", User{}, info, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kinds := make([]db.ChangeKind, len(mg.Changes))
+	for i, c := range mg.Changes {
+		kinds[i] = c.Kind
+	}
+	if !reflect.DeepEqual(kinds, []db.ChangeKind{db.ColumnChanged, db.ColumnAdded, db.ColumnAdded, db.ColumnExtra}) {
+		t.Errorf("Unexpected changes %v", kinds)
+	}
+	expectedStmts := []string{
+		"ALTER TABLE `users` MODIFY COLUMN `name` VARCHAR(64) NOT NULL DEFAULT 'guest' COMMENT 'user\\'s name'",
+		"ALTER TABLE `users` ADD COLUMN `email` VARCHAR(255) NULL AFTER `name`",
+		"ALTER TABLE `users` ADD COLUMN `created_at` DATETIME NOT NULL AFTER `email`",
+	}
+	if !reflect.DeepEqual(mg.Statements, expectedStmts) {
+		t.Errorf("Unexpected statements %q", mg.Statements)
+	}
+	if report := mg.String(); !strings.Contains(report, "~ name varchar(32) -> VARCHAR(64)") || !strings.Contains(report, "? legacy") {
+		t.Errorf("Unexpected report %s", report)
+	}
+
+	var executed []string
+	m := &db.DB{DryRun: func(stmt string, args []any) { executed = append(executed, stmt) }}
+	if err := m.Migrate(mg); err != nil || !reflect.DeepEqual(executed, expectedStmts) {
+		t.Errorf("Unexpected dry run %q %v", executed, err)
+	}
+
+	// 空字符串默认值与没有默认值不同
+	info[1].Default = ""
+	if mg, _ := db.PlanMigration(query.MySQL, "users", User{}, info, nil); mg.Statements[0] != "ALTER TABLE `users` MODIFY COLUMN `name` VARCHAR(64) NOT NULL DEFAULT '' COMMENT 'user\\'s name'" {
+		t.Errorf("Expected empty default, got %q", mg.Statements[0])
+	}
+	info[1].HasDefault = false
+	if mg, _ := db.PlanMigration(query.MySQL, "users", User{}, info, nil); mg.Statements[0] != "ALTER TABLE `users` MODIFY COLUMN `name` VARCHAR(64) NOT NULL COMMENT 'user\\'s name'" {
+		t.Errorf("Expected no default, got %q", mg.Statements[0])
+	}
+
+	info[1].Type = "VARCHAR(64)"
+	info = append(info, db.TableInfo{Field: "email", Type: "varchar(255)", Null: "YES"}, db.TableInfo{Field: "created_at", Type: "datetime", Null: "NO"})
+	if mg, _ := db.PlanMigration(query.MySQL, "users", User{}, info, nil); !mg.Empty() {
+		t.Errorf("Expected no statements, got %q", mg.Statements)
+	}
+
+	// ClickHouse 不使用 sql 标签，类型一致时不生成变更；类型变化时保留默认值和注释
+	ckInfo := []db.TableInfo{
+		{Field: "id", Type: "Int64"},
+		{Field: "name", Type: "LowCardinality(String)"},
+		{Field: "email", Type: "Nullable(String)"},
+		{Field: "tags", Type: "Array(String)"},
+		{Field: "created_at", Type: "DateTime", Extra: "DEFAULT", Default: "now()", HasDefault: true, Comment: "created"},
+	}
+	mg, err = db.PlanMigration(query.ClickHouse, "users", User{}, ckInfo, nil)
+	expectedStmts = []string{"ALTER TABLE `users` MODIFY COLUMN `created_at` DateTime64(3) DEFAULT now() COMMENT 'created'"}
+	if err != nil || !reflect.DeepEqual(mg.Statements, expectedStmts) {
+		t.Errorf("Unexpected statements %q %v", mg.Statements, err)
+	}
+}
@@ -0,0 +1,321 @@
+package db
+
+import (
+	"sync"
+	"time"
+
+	"github.com/frankill/gotools/query"
+)
+
+// WriterConfig 批量写入设置，用于 DB.InsertWith 和 CK.InsertWith
+type WriterConfig struct {
+	BatchRows     int                        // 每批最多行数
+	BatchBytes    int                        // 每批数据的估算字节数上限，0 表示不限制
+	FlushInterval time.Duration              // 每隔该时间写入一次未满的批次，0 表示只按行数、字节数写入
+	Workers       int                        // 并发写入的批次数
+	Retries       int                        // 每批写入失败后的重试次数
+	RetryDelay    time.Duration              // 第一次重试前的等待时间，之后每次翻倍
+	Split         bool                       // 重试后仍失败时将批次二分后分别写入，直到定位到写入失败的行，拆分后的批次不再重试
+	OnFailed      func(row []any, err error) // Split 定位到写入失败的行时回调，该行被跳过
+}
+
+// NewWriterConfig 批量写入设置，默认每批 1000 行、每 10 秒写入一次、单个写入、不重试
+func NewWriterConfig() *WriterConfig {
+
+	return &WriterConfig{
+		BatchRows:     1000,
+		FlushInterval: 10 * time.Second,
+		Workers:       1,
+		RetryDelay:    time.Second,
+	}
+}
+
+func (w *WriterConfig) SetBatchRows(n int) *WriterConfig {
+	w.BatchRows = n
+
+	return w
+}
+
+func (w *WriterConfig) SetBatchBytes(n int) *WriterConfig {
+	w.BatchBytes = n
+
+	return w
+}
+
+func (w *WriterConfig) SetFlushInterval(d time.Duration) *WriterConfig {
+	w.FlushInterval = d
+
+	return w
+}
+
+func (w *WriterConfig) SetWorkers(n int) *WriterConfig {
+	w.Workers = n
+
+	return w
+}
+
+func (w *WriterConfig) SetRetries(n int, delay time.Duration) *WriterConfig {
+	w.Retries = n
+	w.RetryDelay = delay
+
+	return w
+}
+
+func (w *WriterConfig) SetSplit(b bool) *WriterConfig {
+	w.Split = b
+
+	return w
+}
+
+func (w *WriterConfig) SetOnFailed(fn func(row []any, err error)) *WriterConfig {
+	w.OnFailed = fn
+
+	return w
+}
+
+// WriteResult 批量写入的结果
+type WriteResult struct {
+	Rows       int64 // 写入成功的行数
+	Batches    int64 // 写入成功的批次数，拆分后的批次分别计数
+	Retries    int64 // 重试次数
+	FailedRows int64 // 开启 Split 时定位到并跳过的行数
+}
+
+// buildInsert 以 data 构建插入语句，数据写入 q 的副本，q 本身不变，可并发调用
+func buildInsert(q query.SqlInsert, data [][]any) (string, []any) {
+
+	c := q.Clone()
+	c.AddValues(data...)
+
+	return c.Build()
+}
+
+// rowBytes 估算一行数据的字节数，字符串按长度计算，其余值按 8 字节计算
+func rowBytes(row []any) int {
+
+	n := 0
+	for _, v := range row {
+		switch v := v.(type) {
+		case string:
+			n += len(v)
+		case []byte:
+			n += len(v)
+		default:
+			n += 8
+		}
+	}
+	return n
+}
+
+// batchWriter 按 WriterConfig 将通道中的数据分批交给 do 写入
+type batchWriter struct {
+	cfg *WriterConfig
+	do  func(data [][]any) error
+
+	mu   sync.Mutex
+	res  WriteResult
+	err  error
+	done chan struct{}
+	once sync.Once
+}
+
+func (b *batchWriter) fail(err error) {
+	b.once.Do(func() {
+		b.err = err
+		close(b.done)
+	})
+}
+
+func (b *batchWriter) stopped() bool {
+	select {
+	case <-b.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// written 记录写入成功的一批数据
+func (b *batchWriter) written(data [][]any) {
+	b.mu.Lock()
+	b.res.Rows += int64(len(data))
+	b.res.Batches++
+	b.mu.Unlock()
+}
+
+// write 写入一批数据，失败时按设置重试，重试后仍失败时拆分
+func (b *batchWriter) write(data [][]any) error {
+
+	delay := b.cfg.RetryDelay
+
+	err := b.do(data)
+	for i := 0; err != nil && i < b.cfg.Retries; i++ {
+		select {
+		case <-time.After(delay):
+		case <-b.done:
+			return err
+		}
+		delay *= 2
+
+		b.mu.Lock()
+		b.res.Retries++
+		b.mu.Unlock()
+
+		err = b.do(data)
+	}
+
+	if err == nil {
+		b.written(data)
+		return nil
+	}
+
+	if !b.cfg.Split {
+		return err
+	}
+
+	return b.split(data, err)
+}
+
+// split 将写入失败的批次二分后分别写入，拆分后的批次不再重试，直到定位到写入失败的行
+func (b *batchWriter) split(data [][]any, err error) error {
+
+	if b.stopped() {
+		return err
+	}
+
+	if len(data) == 1 {
+		b.mu.Lock()
+		b.res.FailedRows++
+		b.mu.Unlock()
+		if b.cfg.OnFailed != nil {
+			b.cfg.OnFailed(data[0], err)
+		}
+		return nil
+	}
+
+	half := len(data) / 2
+	for _, part := range [][][]any{data[:half], data[half:]} {
+		if err := b.do(part); err == nil {
+			b.written(part)
+		} else if err := b.split(part, err); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *batchWriter) run(ch chan []any) (*WriteResult, error) {
+
+	cfg := b.cfg
+	b.done = make(chan struct{})
+
+	workers := max(cfg.Workers, 1)
+	batches := make(chan [][]any, workers)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for data := range batches {
+				if b.stopped() {
+					continue
+				}
+				if err := b.write(data); err != nil {
+					b.fail(err)
+				}
+			}
+		}()
+	}
+
+	var tick <-chan time.Time
+	if cfg.FlushInterval > 0 {
+		ticker := time.NewTicker(cfg.FlushInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	num := max(cfg.BatchRows, 1)
+	res := make([][]any, 0, num)
+	size := 0
+
+	flush := func() {
+		if len(res) == 0 {
+			return
+		}
+		select {
+		case batches <- res:
+		case <-b.done:
+		}
+		res = make([][]any, 0, num)
+		size = 0
+	}
+
+loop:
+	for {
+		select {
+		case data, ok := <-ch:
+
+			if !ok {
+				flush()
+				break loop
+			}
+
+			if len(data) == 0 {
+				continue
+			}
+
+			res = append(res, data)
+			if cfg.BatchBytes > 0 {
+				size += rowBytes(data)
+			}
+
+			if len(res) >= num || (cfg.BatchBytes > 0 && size >= cfg.BatchBytes) {
+				flush()
+			}
+		case <-tick:
+			flush()
+		case <-b.done:
+			break loop
+		}
+	}
+
+	close(batches)
+	wg.Wait()
+
+	return &b.res, b.err
+}
+
+// InsertWith 方法从一个通道接收数据，按 cfg 分批、并发插入数据库，返回写入结果。
+// 开启 Split 时，重试后仍写入失败的批次会被逐次二分，最终写入失败的单行交给 OnFailed 并跳过，不会中止写入。
+// Workers 大于 1 时各批次的写入顺序不确定。
+// 参数:
+//
+//	q - 插入语句。
+//	cfg - 批量写入设置，为 nil 时使用 NewWriterConfig。
+//
+// 返回:
+//
+//	一个函数，接受一个通道，执行插入操作并返回写入结果和第一个中止写入的错误。
+func (m *DB) InsertWith(q query.SqlInsert, cfg *WriterConfig) func(ch chan []any) (*WriteResult, error) {
+
+	return m.insertWith(q, cfg, m.do)
+}
+
+func (m *DB) insertWith(q query.SqlInsert, cfg *WriterConfig, do func(data [][]any, q query.SqlInsert) error) func(ch chan []any) (*WriteResult, error) {
+
+	if cfg == nil {
+		cfg = NewWriterConfig()
+	}
+
+	return func(ch chan []any) (*WriteResult, error) {
+
+		b := &batchWriter{
+			cfg: cfg,
+			do:  func(data [][]any) error { return do(data, q) },
+		}
+
+		return b.run(ch)
+	}
+}
@@ -0,0 +1,141 @@
+package db_test
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/frankill/gotools/db"
+	"github.com/frankill/gotools/query"
+)
+
+// failDriver 测试用的数据库驱动，参数中包含 "bad" 的语句执行失败
+type failDriver struct{}
+
+type failConn struct{}
+
+type failStmt struct{}
+
+func (failDriver) Open(string) (driver.Conn, error)        { return failConn{}, nil }
+func (failConn) Prepare(string) (driver.Stmt, error)       { return failStmt{}, nil }
+func (failConn) Close() error                              { return nil }
+func (failConn) Begin() (driver.Tx, error)                 { return failConn{}, nil }
+func (failConn) Commit() error                             { return nil }
+func (failConn) Rollback() error                           { return nil }
+func (failStmt) Close() error                              { return nil }
+func (failStmt) NumInput() int                             { return -1 }
+func (failStmt) Query([]driver.Value) (driver.Rows, error) { return nil, errors.New("not supported") }
+
+func (failStmt) Exec(args []driver.Value) (driver.Result, error) {
+	for _, v := range args {
+		if v == "bad" {
+			return nil, errors.New("bad row")
+		}
+	}
+	return driver.RowsAffected(1), nil
+}
+
+// noTxDriver 测试用的数据库驱动，无法开启事务
+type noTxDriver struct{}
+
+type noTxConn struct{ failConn }
+
+func (noTxDriver) Open(string) (driver.Conn, error) { return noTxConn{}, nil }
+func (noTxConn) Begin() (driver.Tx, error)          { return nil, errors.New("begin failed") }
+
+func init() {
+	sql.Register("fail", failDriver{})
+	sql.Register("notx", noTxDriver{})
+}
+
+func TestInsertWith(t *testing.T) {
+
+	var (
+		mu    sync.Mutex
+		stmts []string
+	)
+	m := &db.DB{DryRun: func(stmt string, args []any) {
+		mu.Lock()
+		defer mu.Unlock()
+		stmts = append(stmts, stmt)
+	}}
+
+	send := func(rows ...[]any) chan []any {
+		ch := make(chan []any, len(rows))
+		for _, r := range rows {
+			ch <- r
+		}
+		close(ch)
+		return ch
+	}
+
+	q := query.NewInsert(query.MySQL, "t").AddColumn("a", "b")
+	cfg := db.NewWriterConfig().SetBatchRows(3).SetFlushInterval(0).SetWorkers(2)
+
+	res, err := m.InsertWith(q, cfg)(send([]any{1, "x"}, []any{2, "x"}, []any{3, "x"}, []any{4, "x"}, []any{5, "x"}, []any{6, "x"}, []any{7, "x"}))
+	if err != nil || res.Rows != 7 || res.Batches != 3 || len(stmts) != 3 {
+		t.Errorf("Unexpected result %+v %v %d", res, err, len(stmts))
+	}
+
+	// 每行估算 8 + 10 字节，两行达到 30 字节上限
+	stmts = nil
+	cfg = db.NewWriterConfig().SetBatchBytes(30).SetFlushInterval(0)
+	res, _ = m.InsertWith(q, cfg)(send([]any{1, "0123456789"}, []any{2, "0123456789"}, []any{3, "0123456789"}))
+	if res.Batches != 2 || stmts[0] != "INSERT INTO `t` (`a`, `b`) VALUES (?, ?), (?, ?)" {
+		t.Errorf("Unexpected result %+v %v", res, stmts)
+	}
+
+	con, err := sql.Open("fail", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer con.Close()
+	m = &db.DB{Con: con, Dialect: query.MySQL}
+
+	rows := [][]any{{1, "ok"}, {2, "ok"}, {3, "bad"}, {4, "ok"}, {5, "bad"}}
+
+	if _, err := m.InsertWith(q, db.NewWriterConfig().SetFlushInterval(0))(send(rows...)); err == nil {
+		t.Errorf("Expected error without split")
+	}
+
+	var failed []any
+	cfg = db.NewWriterConfig().SetFlushInterval(0).SetRetries(1, 0).SetSplit(true).
+		SetOnFailed(func(row []any, err error) { failed = append(failed, row[0]) })
+	res, err = m.InsertWith(q, cfg)(send(rows...))
+	if err != nil || res.Rows != 3 || res.FailedRows != 2 || !reflect.DeepEqual(failed, []any{3, 5}) {
+		t.Errorf("Unexpected result %+v %v %v", res, err, failed)
+	}
+
+	// 只有整批写入会重试，拆分后的批次不再重试
+	if res.Retries != 1 {
+		t.Errorf("Expected 1 retry, got %d", res.Retries)
+	}
+
+	// 数据写入 q 的副本，q 本身不保存数据
+	if len(q.InsertValues) != 0 {
+		t.Errorf("Expected empty insert values, got %v", q.InsertValues)
+	}
+
+	// 无法开启事务时返回错误，不会回滚空事务
+	notx, err := sql.Open("notx", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer notx.Close()
+
+	for _, m := range []interface {
+		InsertWith(query.SqlInsert, *db.WriterConfig) func(chan []any) (*db.WriteResult, error)
+	}{&db.DB{Con: notx, Dialect: query.MySQL}, &db.CK{DB: db.DB{Con: notx, Dialect: query.ClickHouse}}} {
+		if _, err := m.InsertWith(q, db.NewWriterConfig().SetFlushInterval(0))(send([]any{1, "x"})); err == nil {
+			t.Errorf("%T: expected begin error", m)
+		}
+	}
+
+	upd := query.NewUpdateBuilder("t").Columns("a").Keys("id")
+	if err := (&db.DB{Con: notx, Dialect: query.MySQL}).UpdateBatch(upd)(send([]any{1, 2})); err == nil {
+		t.Errorf("Expected begin error from UpdateBatch")
+	}
+}
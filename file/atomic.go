@@ -0,0 +1,126 @@
+package file
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SuccessMarker 写入成功后在输出目录中创建的标记文件名
+const SuccessMarker = "_SUCCESS"
+
+// TempPath 在 path 所在目录创建一个空的临时文件并返回其路径，
+// 临时文件名以 . 开头并保留原文件后缀（如 .csv.gz、.xlsx），以便按后缀识别格式的写入方式正常工作。
+// 临时文件的权限与已存在的 path 相同，path 不存在时为 0644
+func TempPath(path string) (string, error) {
+
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	ext := splitExt(base)
+
+	f, err := os.CreateTemp(dir, "."+strings.TrimSuffix(base, ext)+".tmp-*"+ext)
+	if err != nil {
+		return "", err
+	}
+
+	name := f.Name()
+	if err := f.Close(); err != nil {
+		return name, err
+	}
+
+	return name, os.Chmod(name, targetMode(path))
+}
+
+// targetMode 返回替换 path 时新文件应使用的权限，path 不存在时为 0644
+func targetMode(path string) os.FileMode {
+	if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+		return info.Mode().Perm()
+	}
+	return 0644
+}
+
+// syncPath 将文件或目录的内容刷新到磁盘
+func syncPath(path string) error {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	err = f.Sync()
+	return errors.Join(err, f.Close())
+}
+
+// WriteAtomic 先将内容写入同目录下的临时文件，成功后刷新到磁盘再重命名为 path，
+// 因此 path 要么保持原样，要么是完整的新文件。write 返回错误时删除临时文件。
+// 参数:
+//
+//   - path - 目标文件路径
+//   - success - 是否在重命名后在目标目录中创建 _SUCCESS 标记文件，已有的标记文件在写入前删除
+//   - write - 写入函数，参数为临时文件路径，写入方需自行关闭文件
+//
+// 返回:
+//
+//   - 错误信息
+func WriteAtomic(path string, success bool, write func(tmp string) error) (err error) {
+
+	if path == "" {
+		return errors.New("path is empty")
+	}
+
+	dir := filepath.Dir(path)
+	marker := filepath.Join(dir, SuccessMarker)
+
+	// 先删除旧的标记文件，避免读取方在替换过程中看到旧标记
+	if success {
+		if err := os.Remove(marker); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	tmp, err := TempPath(path)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			os.Remove(tmp)
+		}
+	}()
+
+	if err = write(tmp); err != nil {
+		return err
+	}
+
+	// 写入方可能删除后重新创建了临时文件，重命名前再次设置权限
+	if err = os.Chmod(tmp, targetMode(path)); err != nil {
+		return err
+	}
+
+	if err = syncPath(tmp); err != nil {
+		return err
+	}
+
+	if err = os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	// 重命名刷新到磁盘后再创建标记文件，部分平台不支持对目录 Sync，忽略该错误
+	syncPath(dir)
+
+	if success {
+		if err := os.WriteFile(marker, nil, 0644); err != nil {
+			return err
+		}
+		if err := syncPath(marker); err != nil {
+			return err
+		}
+		syncPath(dir)
+	}
+
+	return nil
+}
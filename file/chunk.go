@@ -0,0 +1,171 @@
+package file
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+)
+
+// Chunk 文件中的一段字节范围 [Start, End)
+type Chunk struct {
+	Start int64
+	End   int64
+}
+
+// chunkStat 单段内的引号统计
+type chunkStat struct {
+	parity  int      // 段内有效引号数的奇偶
+	firstNL [2]int64 // 段内有效引号数为偶/奇时遇到的第一个换行符的位置，-1 表示不存在
+}
+
+// SplitChunks 将分隔符文件按字节切分为最多 n 段，每段的边界对齐到引号外的换行符之后，
+// 因此每段都从一条完整记录开始，可以独立解析。
+// 引号状态通过并发统计各段的引号奇偶性再求前缀得到，escape 为 '\\' 时被转义的引号不计入。
+// 参数:
+//
+//   - path - 文件路径，不支持压缩文件
+//   - n - 最大段数
+//   - escape - 转义字符，与 NewReader 一致
+//
+// 返回:
+//
+//   - 切分后的字节范围
+//   - 错误信息
+func SplitChunks(path string, n int, escape byte) ([]Chunk, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+
+	if size == 0 {
+		return nil, nil
+	}
+
+	n = max(n, 1)
+	step := max(size/int64(n), 1)
+
+	var starts []int64
+	for s := int64(0); s < size; s += step {
+		starts = append(starts, s)
+	}
+
+	stats := make([]chunkStat, len(starts))
+	errs := make([]error, len(starts))
+
+	var wg sync.WaitGroup
+	for i, s := range starts {
+		end := size
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+		wg.Add(1)
+		go func(i int, s, end int64) {
+			defer wg.Done()
+			stats[i], errs[i] = scanChunk(f, s, end, escape)
+		}(i, s, end)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	chunks := []Chunk{{Start: 0}}
+	state := 0
+	for i := range starts {
+		if i > 0 {
+			if nl := stats[i].firstNL[state]; nl >= 0 && nl+1 < size {
+				chunks[len(chunks)-1].End = nl + 1
+				chunks = append(chunks, Chunk{Start: nl + 1})
+			}
+		}
+		state ^= stats[i].parity
+	}
+	chunks[len(chunks)-1].End = size
+
+	return chunks, nil
+}
+
+// scanChunk 统计 [start, end) 范围内的引号奇偶性和换行位置
+func scanChunk(f *os.File, start, end int64, escape byte) (chunkStat, error) {
+
+	st := chunkStat{firstNL: [2]int64{-1, -1}}
+
+	// 往前多读一些字节以判断段首的引号是否被转义
+	const back = 16
+	from := max(start-back, 0)
+
+	r := io.NewSectionReader(f, from, end-from)
+	buf := make([]byte, 1<<20)
+
+	escaped := false
+	pos := from
+
+	for {
+		n, err := r.Read(buf)
+		b := buf[:n]
+
+		for len(b) > 0 {
+			i := bytes.IndexAny(b, "\"\n\\")
+			if i < 0 {
+				pos += int64(len(b))
+				escaped = false
+				break
+			}
+
+			if i > 0 {
+				escaped = false
+			}
+
+			c := b[i]
+			at := pos + int64(i)
+			pos = at + 1
+			b = b[i+1:]
+
+			if at < start {
+				// 仅用于确定段首之前的转义状态
+				if c == '\\' && escape == '\\' {
+					escaped = !escaped
+				} else {
+					escaped = false
+				}
+				continue
+			}
+
+			switch c {
+			case '\\':
+				if escape == '\\' {
+					escaped = !escaped
+				}
+			case '"':
+				if !escaped {
+					st.parity ^= 1
+				}
+				escaped = false
+			case '\n':
+				if st.firstNL[st.parity] < 0 {
+					st.firstNL[st.parity] = at
+				}
+				escaped = false
+			}
+		}
+
+		if err == io.EOF {
+			return st, nil
+		}
+		if err != nil {
+			return st, err
+		}
+	}
+}
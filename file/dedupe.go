@@ -0,0 +1,456 @@
+package file
+
+import (
+	"bufio"
+	"compress/gzip"
+	"container/heap"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// 差异类型
+const (
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+	DiffChanged = "changed"
+)
+
+// sortChunkRows 外部排序时每个临时文件的最大行数
+const sortChunkRows = 100000
+
+// DiffRecord 两个文件按主键比较的差异
+type DiffRecord struct {
+	Kind    string   // DiffAdded、DiffRemoved 或 DiffChanged
+	Key     []string // 主键列的值
+	Old     []string // 旧文件中的行，新增时为 nil
+	New     []string // 新文件中的行，删除时为 nil
+	Columns []string // 发生变化的列名，仅 DiffChanged 有效，没有表头时为 c1、c2 ...
+}
+
+// keyCompare 返回按 keys 列比较两行的函数
+func keyCompare(keys []int) func(x, y []string) int {
+
+	return func(x, y []string) int {
+		for _, k := range keys {
+			var a, b string
+			if k < len(x) {
+				a = x[k]
+			}
+			if k < len(y) {
+				b = y[k]
+			}
+			if c := strings.Compare(a, b); c != 0 {
+				return c
+			}
+		}
+		return 0
+	}
+}
+
+// sortRun 外部排序中一个已排序的临时文件
+type sortRun struct {
+	f   *os.File
+	dec *gob.Decoder
+	cur []string
+	idx int // 临时文件的序号，主键相同时序号小的先输出，保证排序稳定
+}
+
+func (r *sortRun) next() error {
+	r.cur = nil
+	return r.dec.Decode(&r.cur)
+}
+
+type sortHeap struct {
+	runs []*sortRun
+	cmp  func(x, y []string) int
+}
+
+func (h *sortHeap) Len() int { return len(h.runs) }
+func (h *sortHeap) Less(i, j int) bool {
+	if c := h.cmp(h.runs[i].cur, h.runs[j].cur); c != 0 {
+		return c < 0
+	}
+	return h.runs[i].idx < h.runs[j].idx
+}
+func (h *sortHeap) Swap(i, j int) { h.runs[i], h.runs[j] = h.runs[j], h.runs[i] }
+func (h *sortHeap) Push(x any)    { h.runs = append(h.runs, x.(*sortRun)) }
+func (h *sortHeap) Pop() any {
+	old := h.runs
+	x := old[len(old)-1]
+	h.runs = old[:len(old)-1]
+	return x
+}
+
+// sortedFile 按主键排序后的文件，Next 依次返回各行，结束时返回 io.EOF
+type sortedFile struct {
+	dir  string
+	runs []*sortRun
+	h    *sortHeap
+}
+
+// sortFile 使用外部排序按 keys 列对分隔符文件排序，每 sortChunkRows 行稳定排序后写入一个临时文件，
+// 合并时主键相同的行按临时文件的顺序输出，因此主键相同的行保持在文件中出现的顺序。
+// 使用完毕后需调用 Close 删除临时文件
+func sortFile(path string, header bool, comma string, escape byte, keys []int) (*sortedFile, error) {
+
+	in, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	r := NewReader(in, comma, escape)
+	r.FieldsPerRecord = -1
+
+	if header {
+		if _, err := r.Read(); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	dir, err := os.MkdirTemp("", "sort-*")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &sortedFile{dir: dir}
+	cmp := keyCompare(keys)
+
+	write := func(rows [][]string) error {
+		slices.SortStableFunc(rows, cmp)
+
+		f, err := os.Create(filepath.Join(dir, strconv.Itoa(len(s.runs))+".gob"))
+		if err != nil {
+			return err
+		}
+		s.runs = append(s.runs, &sortRun{f: f, idx: len(s.runs)})
+
+		w := bufio.NewWriter(f)
+		enc := gob.NewEncoder(w)
+		for _, row := range rows {
+			if err := enc.Encode(row); err != nil {
+				return err
+			}
+		}
+		return w.Flush()
+	}
+
+	var rows [][]string
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			s.Close()
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		rows = append(rows, record)
+		if len(rows) == sortChunkRows {
+			if err := write(rows); err != nil {
+				s.Close()
+				return nil, err
+			}
+			rows = nil
+		}
+	}
+	if len(rows) > 0 {
+		if err := write(rows); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+
+	s.h = &sortHeap{cmp: cmp}
+	for _, run := range s.runs {
+		if _, err := run.f.Seek(0, io.SeekStart); err != nil {
+			s.Close()
+			return nil, err
+		}
+		run.dec = gob.NewDecoder(bufio.NewReader(run.f))
+		err := run.next()
+		if errors.Is(err, io.EOF) {
+			continue
+		}
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		s.h.runs = append(s.h.runs, run)
+	}
+	heap.Init(s.h)
+
+	return s, nil
+}
+
+// Next 返回下一行
+func (s *sortedFile) Next() ([]string, error) {
+
+	if s.h.Len() == 0 {
+		return nil, io.EOF
+	}
+
+	run := s.h.runs[0]
+	row := run.cur
+
+	err := run.next()
+	switch {
+	case errors.Is(err, io.EOF):
+		heap.Pop(s.h)
+	case err != nil:
+		return nil, err
+	default:
+		heap.Fix(s.h, 0)
+	}
+
+	return row, nil
+}
+
+// Close 关闭并删除临时文件
+func (s *sortedFile) Close() error {
+
+	var err error
+	for _, run := range s.runs {
+		err = errors.Join(err, run.f.Close())
+	}
+
+	return errors.Join(err, os.RemoveAll(s.dir))
+}
+
+// SortDedupeFile 使用外部排序将分隔符文件按 keys 列排序并去重，主键相同的行只保留第一次出现的行，
+// 适用于无法全部放入内存的文件。输入和输出文件以 .gz 结尾时自动解压和压缩。
+// 参数:
+//
+//   - src - 输入文件路径
+//   - dst - 输出文件路径
+//   - header - 是否包含表头，包含时输出文件保留表头
+//   - comma - 分隔符
+//   - escape - 转义字符
+//   - keys - 主键列下标
+//
+// 返回:
+//
+//   - 写入的数据行数，不含表头
+//   - 错误信息
+func SortDedupeFile(src, dst string, header bool, comma string, escape byte, keys ...int) (int, error) {
+
+	if len(keys) == 0 {
+		return 0, errors.New("keys cannot be empty")
+	}
+	if src == dst {
+		return 0, errors.New("dst cannot be the same as src")
+	}
+
+	var hdr []string
+	if header {
+		h, err := ReadHeader(src, comma, escape)
+		if err != nil {
+			return 0, err
+		}
+		hdr = h
+	}
+
+	sorted, err := sortFile(src, header, comma, escape, keys)
+	if err != nil {
+		return 0, err
+	}
+	defer sorted.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+
+	var w io.Writer = out
+	var gz *gzip.Writer
+	if strings.HasSuffix(strings.ToLower(dst), ".gz") {
+		gz = gzip.NewWriter(out)
+		w = gz
+	}
+
+	writer := NewWriter(w, comma, true, escape)
+	if len(hdr) > 0 {
+		if err := writer.Write(hdr); err != nil {
+			return 0, err
+		}
+	}
+
+	cmp := keyCompare(keys)
+
+	var (
+		last []string
+		rows int
+	)
+
+	for {
+		record, err := sorted.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return rows, err
+		}
+		if last != nil && cmp(last, record) == 0 {
+			continue
+		}
+		last = record
+		if err := writer.Write(record); err != nil {
+			return rows, err
+		}
+		rows++
+	}
+
+	if err := writer.Flush(); err != nil {
+		return rows, err
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return rows, err
+		}
+	}
+
+	return rows, out.Close()
+}
+
+// DiffFiles 按主键比较两个分隔符文件，输出新增、删除和发生变化的行，两个文件都会先进行外部排序，
+// 结果按主键升序输出。同一文件中主键重复的行按出现顺序依次配对。
+// 参数:
+//
+//   - oldPath - 旧文件路径
+//   - newPath - 新文件路径
+//   - header - 是否包含表头，包含时变化的列使用新文件的列名
+//   - comma - 分隔符
+//   - escape - 转义字符
+//   - keys - 主键列下标
+//
+// 返回:
+//
+//   - 一个通道，用于接收差异
+//   - 一个通道，用于接收错误信息
+func DiffFiles(oldPath, newPath string, header bool, comma string, escape byte, keys ...int) (chan DiffRecord, chan error) {
+
+	ch := make(chan DiffRecord, 100)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(ch)
+		defer close(errs)
+
+		if err := diffFiles(oldPath, newPath, header, comma, escape, keys, ch); err != nil {
+			errs <- err
+		}
+	}()
+
+	return ch, errs
+}
+
+func diffFiles(oldPath, newPath string, header bool, comma string, escape byte, keys []int, ch chan DiffRecord) error {
+
+	if len(keys) == 0 {
+		return errors.New("keys cannot be empty")
+	}
+
+	var names []string
+	if header {
+		h, err := ReadHeader(newPath, comma, escape)
+		if err != nil {
+			return err
+		}
+		names = h
+	}
+
+	name := func(i int) string {
+		if i < len(names) {
+			return names[i]
+		}
+		return fmt.Sprintf("c%d", i+1)
+	}
+
+	key := func(x []string) []string {
+		res := make([]string, len(keys))
+		for i, k := range keys {
+			if k < len(x) {
+				res[i] = x[k]
+			}
+		}
+		return res
+	}
+
+	sa, err := sortFile(oldPath, header, comma, escape, keys)
+	if err != nil {
+		return err
+	}
+	defer sa.Close()
+
+	sb, err := sortFile(newPath, header, comma, escape, keys)
+	if err != nil {
+		return err
+	}
+	defer sb.Close()
+
+	next := func(s *sortedFile) ([]string, bool, error) {
+		row, err := s.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, false, nil
+		}
+		return row, err == nil, err
+	}
+
+	cmp := keyCompare(keys)
+
+	a, okA, err := next(sa)
+	if err != nil {
+		return err
+	}
+	b, okB, err := next(sb)
+	if err != nil {
+		return err
+	}
+
+	for okA || okB {
+		switch {
+		case !okB || (okA && cmp(a, b) < 0):
+			ch <- DiffRecord{Kind: DiffRemoved, Key: key(a), Old: a}
+			if a, okA, err = next(sa); err != nil {
+				return err
+			}
+		case !okA || cmp(a, b) > 0:
+			ch <- DiffRecord{Kind: DiffAdded, Key: key(b), New: b}
+			if b, okB, err = next(sb); err != nil {
+				return err
+			}
+		default:
+			var cols []string
+			for i := 0; i < max(len(a), len(b)); i++ {
+				if i >= len(a) || i >= len(b) || a[i] != b[i] {
+					cols = append(cols, name(i))
+				}
+			}
+			if len(cols) > 0 {
+				ch <- DiffRecord{Kind: DiffChanged, Key: key(b), Old: a, New: b, Columns: cols}
+			}
+			if a, okA, err = next(sa); err != nil {
+				return err
+			}
+			if b, okB, err = next(sb); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// DiffCsv 按主键比较两个带表头的 CSV 文件，见 DiffFiles
+func DiffCsv(oldPath, newPath string, keys ...int) (chan DiffRecord, chan error) {
+
+	return DiffFiles(oldPath, newPath, true, ",", '"', keys...)
+}
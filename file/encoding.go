@@ -0,0 +1,276 @@
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// 支持的字符编码
+const (
+	UTF8    = "utf-8"
+	GBK     = "gbk"
+	GB18030 = "gb18030"
+	Big5    = "big5"
+	UTF16LE = "utf-16le"
+	UTF16BE = "utf-16be"
+	Latin1  = "latin1"
+	// Auto 读取时根据文件开头的内容自动识别编码
+	Auto = "auto"
+)
+
+var (
+	// 自动识别编码时采样的字节数
+	detectSize = 64 * 1024
+
+	detectMutex = sync.RWMutex{}
+)
+
+// SetDetectSize 设置自动识别编码时采样的字节数
+func SetDetectSize(n int) {
+	detectMutex.Lock()
+	defer detectMutex.Unlock()
+
+	detectSize = n
+}
+
+// GetDetectSize 获取自动识别编码时采样的字节数
+func GetDetectSize() int {
+	detectMutex.RLock()
+	defer detectMutex.RUnlock()
+
+	return detectSize
+}
+
+var boms = map[string][]byte{
+	UTF8:    {0xEF, 0xBB, 0xBF},
+	UTF16LE: {0xFF, 0xFE},
+	UTF16BE: {0xFE, 0xFF},
+	GB18030: {0x84, 0x31, 0x95, 0x33},
+}
+
+// NormalizeEncoding 规范化编码名称，空字符串视为 UTF-8
+func NormalizeEncoding(enc string) (string, error) {
+
+	switch strings.ReplaceAll(strings.ToLower(strings.TrimSpace(enc)), "_", "-") {
+	case "", "utf-8", "utf8":
+		return UTF8, nil
+	case "gbk", "cp936":
+		return GBK, nil
+	case "gb18030":
+		return GB18030, nil
+	case "big5", "big-5":
+		return Big5, nil
+	case "utf-16le", "utf16le", "utf-16":
+		return UTF16LE, nil
+	case "utf-16be", "utf16be":
+		return UTF16BE, nil
+	case "latin1", "latin-1", "iso-8859-1":
+		return Latin1, nil
+	case "auto":
+		return Auto, nil
+	default:
+		return "", fmt.Errorf("unsupported encoding %q", enc)
+	}
+}
+
+func lookupEncoding(enc string) encoding.Encoding {
+	switch enc {
+	case GBK:
+		return simplifiedchinese.GBK
+	case GB18030:
+		return simplifiedchinese.GB18030
+	case Big5:
+		return traditionalchinese.Big5
+	case UTF16LE:
+		return unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
+	case UTF16BE:
+		return unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)
+	case Latin1:
+		return charmap.ISO8859_1
+	default:
+		return nil
+	}
+}
+
+// DetectEncoding 根据样本内容识别编码，依次判断 BOM、UTF-16、UTF-8、GB18030，都不满足时视为 Latin-1
+func DetectEncoding(sample []byte) string {
+
+	for _, enc := range []string{UTF8, UTF16LE, UTF16BE, GB18030} {
+		if bytes.HasPrefix(sample, boms[enc]) {
+			return enc
+		}
+	}
+
+	if len(sample) >= 2 {
+		var even, odd int
+		for i := 0; i+1 < len(sample); i += 2 {
+			if sample[i] == 0 {
+				even++
+			}
+			if sample[i+1] == 0 {
+				odd++
+			}
+		}
+		half := len(sample) / 2
+		if odd*10 > half*3 && even*10 < half {
+			return UTF16LE
+		}
+		if even*10 > half*3 && odd*10 < half {
+			return UTF16BE
+		}
+	}
+
+	if validUTF8Prefix(sample) {
+		return UTF8
+	}
+
+	if validGB18030Prefix(sample) {
+		return GB18030
+	}
+
+	return Latin1
+}
+
+// validUTF8Prefix 判断样本是否为合法 UTF-8，允许末尾有被截断的字符
+func validUTF8Prefix(b []byte) bool {
+	for i := 0; i < len(b); {
+		r, size := utf8.DecodeRune(b[i:])
+		if r == utf8.RuneError && size <= 1 {
+			return len(b)-i < utf8.UTFMax && !utf8.FullRune(b[i:])
+		}
+		i += size
+	}
+	return true
+}
+
+// validGB18030Prefix 判断样本是否为合法 GBK/GB18030 字节序列，允许末尾有被截断的字符
+func validGB18030Prefix(b []byte) bool {
+	for i := 0; i < len(b); {
+		c := b[i]
+		if c < 0x80 {
+			i++
+			continue
+		}
+		if c == 0x80 || c == 0xFF {
+			return false
+		}
+		if i+1 >= len(b) {
+			return true
+		}
+		c2 := b[i+1]
+		switch {
+		case c2 >= 0x40 && c2 <= 0xFE && c2 != 0x7F:
+			i += 2
+		case c2 >= 0x30 && c2 <= 0x39:
+			if i+3 >= len(b) {
+				return true
+			}
+			if b[i+2] < 0x81 || b[i+2] > 0xFE || b[i+3] < 0x30 || b[i+3] > 0x39 {
+				return false
+			}
+			i += 4
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// NewDecodeReader 返回将 enc 编码的内容转换为 UTF-8 的 Reader，并去除开头的 BOM。
+// enc 为 Auto 时采样开头的 GetDetectSize() 字节自动识别编码。
+func NewDecodeReader(r io.Reader, enc string) (io.Reader, error) {
+
+	enc, err := NormalizeEncoding(enc)
+	if err != nil {
+		return nil, err
+	}
+
+	size := GetDetectSize()
+	br := bufio.NewReaderSize(r, max(size, 16))
+
+	if enc == Auto {
+		sample, err := br.Peek(size)
+		if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+			return nil, err
+		}
+		enc = DetectEncoding(sample)
+	}
+
+	if bom, ok := boms[enc]; ok {
+		if b, _ := br.Peek(len(bom)); bytes.Equal(b, bom) {
+			br.Discard(len(bom))
+		}
+	}
+
+	e := lookupEncoding(enc)
+	if e == nil {
+		return br, nil
+	}
+
+	return transform.NewReader(br, e.NewDecoder()), nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// NewEncodeWriter 返回将 UTF-8 内容转换为 enc 编码写入 w 的 Writer，写入完成后必须调用 Close 刷新缓冲，
+// Close 不会关闭 w。bom 为 true 时先写入 BOM，GBK、Big5、Latin-1 没有 BOM，会忽略该参数。
+func NewEncodeWriter(w io.Writer, enc string, bom bool) (io.WriteCloser, error) {
+
+	enc, err := NormalizeEncoding(enc)
+	if err != nil {
+		return nil, err
+	}
+	if enc == Auto {
+		return nil, fmt.Errorf("encoding auto is only supported for reading")
+	}
+
+	if bom {
+		if b, ok := boms[enc]; ok {
+			if _, err := w.Write(b); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	e := lookupEncoding(enc)
+	if e == nil {
+		return nopWriteCloser{w}, nil
+	}
+
+	return transform.NewWriter(w, e.NewEncoder()), nil
+}
+
+// DecodeBytes 将 enc 编码的 b 转换为 UTF-8，并去除开头的 BOM，用于按行解码
+func DecodeBytes(b []byte, enc string) ([]byte, error) {
+
+	enc, err := NormalizeEncoding(enc)
+	if err != nil {
+		return nil, err
+	}
+	if enc == UTF8 {
+		return bytes.TrimPrefix(b, boms[UTF8]), nil
+	}
+
+	r, err := NewDecodeReader(bytes.NewReader(b), enc)
+	if err != nil {
+		return nil, err
+	}
+
+	return io.ReadAll(r)
+}
@@ -0,0 +1,129 @@
+package file
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+// ReadHeader 读取分隔符文件的第一行，.gz 后缀的文件会自动解压，空文件返回 nil
+func ReadHeader(path string, comma string, escape byte) ([]string, error) {
+
+	f, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	header, err := NewReader(f, comma, escape).Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+
+	return header, err
+}
+
+// MergeFiles 将多个分隔符文件按顺序合并为一个文件，是 SplitFileByLines 的逆操作。
+// header 为 true 时只保留第一个文件的表头，其余文件的表头必须与之相同。
+// 输入和输出文件以 .gz 结尾时自动解压和压缩。
+// 参数:
+//
+//   - dst - 输出文件路径
+//   - srcs - 输入文件路径
+//   - header - 输入文件是否包含表头
+//   - comma - 分隔符
+//   - escape - 转义字符
+//
+// 返回:
+//
+//   - 写入的数据行数，不含表头
+//   - 错误信息
+func MergeFiles(dst string, srcs []string, header bool, comma string, escape byte) (int, error) {
+
+	if slices.Contains(srcs, dst) {
+		return 0, fmt.Errorf("output %s is also an input", dst)
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+
+	var w io.Writer = out
+	var gz *gzip.Writer
+	if strings.HasSuffix(strings.ToLower(dst), ".gz") {
+		gz = gzip.NewWriter(out)
+		w = gz
+	}
+
+	writer := NewWriter(w, comma, true, escape)
+
+	var (
+		first []string
+		rows  int
+	)
+
+	for _, src := range srcs {
+		if err := func() error {
+
+			f, err := Open(src)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			r := NewReader(f, comma, escape)
+			r.FieldsPerRecord = -1
+
+			if header {
+				h, err := r.Read()
+				if errors.Is(err, io.EOF) {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				if first == nil {
+					first = h
+					if err := writer.Write(h); err != nil {
+						return err
+					}
+				} else if !slices.Equal(first, h) {
+					return fmt.Errorf("header %v does not match %v", h, first)
+				}
+			}
+
+			for {
+				record, err := r.Read()
+				if errors.Is(err, io.EOF) {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				if err := writer.Write(record); err != nil {
+					return err
+				}
+				rows++
+			}
+		}(); err != nil {
+			return rows, fmt.Errorf("%s: %w", src, err)
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		return rows, err
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return rows, err
+		}
+	}
+
+	return rows, out.Close()
+}
@@ -0,0 +1,302 @@
+package file
+
+import (
+	"compress/gzip"
+	"container/list"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PartitionWriter 按分区将记录写入不同文件，如 out/dt=2024-05-01/region=east/part-0001.csv.gz。
+// 同时打开的文件数受 MaxOpen 限制，超出时关闭最久未使用的文件，再次写入时以追加方式重新打开。
+// 每个分区的文件按行数或字节数滚动，每个文件都会写入表头。
+type PartitionWriter struct {
+	Dir      string   // 输出根目录
+	Comma    string   // 分隔符
+	UseQuote bool     // 是否在需要时为字段加引号
+	Escape   byte     // 转义字符
+	Header   []string // 表头，为空时不写
+	Ext      string   // 文件后缀，以 .gz 结尾时使用 gzip 压缩
+	MaxOpen  int      // 最多同时打开的文件数
+	MaxRows  int64    // 单个文件最大行数，0 表示不限制
+	MaxBytes int64    // 单个文件最大字节数（压缩前），0 表示不限制
+
+	parts map[string]*part
+	lru   *list.List
+	files []string
+}
+
+type part struct {
+	partition string
+	index     int
+	rows      int64
+	bytes     int64
+	created   bool
+
+	f    *os.File
+	gz   *gzip.Writer
+	cw   *countWriter
+	w    *Writer
+	elem *list.Element
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// NewPartitionWriter 返回一个写入 dir 目录的 PartitionWriter，默认输出逗号分隔的 .csv 文件，最多同时打开 64 个文件
+func NewPartitionWriter(dir string) *PartitionWriter {
+
+	return &PartitionWriter{
+		Dir:      dir,
+		Comma:    ",",
+		UseQuote: true,
+		Escape:   '"',
+		Ext:      ".csv",
+		MaxOpen:  64,
+		parts:    map[string]*part{},
+		lru:      list.New(),
+	}
+}
+
+func (p *PartitionWriter) SetComma(comma string) *PartitionWriter {
+	p.Comma = comma
+
+	return p
+}
+
+func (p *PartitionWriter) SetUseQuote(useQuote bool) *PartitionWriter {
+	p.UseQuote = useQuote
+
+	return p
+}
+
+func (p *PartitionWriter) SetEscape(escape byte) *PartitionWriter {
+	p.Escape = escape
+
+	return p
+}
+
+func (p *PartitionWriter) SetHeader(header ...string) *PartitionWriter {
+	p.Header = header
+
+	return p
+}
+
+func (p *PartitionWriter) SetExt(ext string) *PartitionWriter {
+	p.Ext = ext
+
+	return p
+}
+
+func (p *PartitionWriter) SetMaxOpen(n int) *PartitionWriter {
+	p.MaxOpen = n
+
+	return p
+}
+
+// SetRoll 设置文件滚动条件，rows、bytes 为 0 时表示不限制
+func (p *PartitionWriter) SetRoll(rows, bytes int64) *PartitionWriter {
+	p.MaxRows = rows
+	p.MaxBytes = bytes
+
+	return p
+}
+
+// Files 返回已经创建的文件列表
+func (p *PartitionWriter) Files() []string {
+	return p.files
+}
+
+func (pt *part) path(p *PartitionWriter) string {
+	return filepath.Join(p.Dir, filepath.FromSlash(pt.partition), fmt.Sprintf("part-%04d%s", pt.index, p.Ext))
+}
+
+func (p *PartitionWriter) open(pt *part) error {
+
+	name := pt.path(p)
+
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+
+	flag := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if pt.created {
+		flag = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+
+	f, err := os.OpenFile(name, flag, 0644)
+	if err != nil {
+		return err
+	}
+
+	// 先加入 lru，之后的写入失败时 close 仍能正确移除并关闭文件
+	pt.f = f
+	pt.elem = p.lru.PushFront(pt)
+
+	var w io.Writer = f
+	if strings.HasSuffix(strings.ToLower(p.Ext), ".gz") {
+		// 追加打开时写入新的 gzip 成员，多成员 gzip 可以被正常读取
+		pt.gz = gzip.NewWriter(f)
+		w = pt.gz
+	}
+	pt.cw = &countWriter{w: w, n: pt.bytes}
+	pt.w = NewWriter(pt.cw, p.Comma, p.UseQuote, p.Escape)
+
+	if !pt.created {
+		pt.created = true
+		p.files = append(p.files, name)
+		if len(p.Header) > 0 {
+			if err := pt.w.Write(p.Header); err != nil {
+				return err
+			}
+		}
+	}
+
+	for p.MaxOpen > 0 && p.lru.Len() > p.MaxOpen {
+		if err := p.close(p.lru.Back().Value.(*part)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *PartitionWriter) close(pt *part) error {
+
+	if pt.f == nil {
+		return nil
+	}
+
+	p.lru.Remove(pt.elem)
+	pt.elem = nil
+
+	err := pt.w.Flush()
+	pt.bytes = pt.cw.n
+	if pt.gz != nil {
+		err = errors.Join(err, pt.gz.Close())
+	}
+	err = errors.Join(err, pt.f.Close())
+
+	pt.f, pt.gz, pt.cw, pt.w = nil, nil, nil, nil
+
+	return err
+}
+
+// checkPartition 校验分区路径，不允许绝对路径和 .. 片段，避免写到 Dir 之外
+func checkPartition(partition string) error {
+
+	if filepath.IsAbs(partition) || strings.HasPrefix(partition, "/") || strings.HasPrefix(partition, `\`) || filepath.VolumeName(partition) != "" {
+		return fmt.Errorf("partition %q must be a relative path", partition)
+	}
+
+	for _, seg := range strings.FieldsFunc(partition, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if seg == ".." {
+			return fmt.Errorf("partition %q must not contain ..", partition)
+		}
+	}
+
+	return nil
+}
+
+// Write 将记录写入 partition 对应的文件，partition 为相对路径，如 dt=2024-05-01/region=east，
+// 包含 .. 或者为绝对路径时返回错误
+func (p *PartitionWriter) Write(partition string, record []string) error {
+
+	if p.parts == nil {
+		p.parts = map[string]*part{}
+		p.lru = list.New()
+	}
+
+	pt, ok := p.parts[partition]
+	if !ok {
+		if err := checkPartition(partition); err != nil {
+			return err
+		}
+		pt = &part{partition: partition, index: 1}
+		p.parts[partition] = pt
+	}
+
+	if pt.f == nil {
+		if err := p.open(pt); err != nil {
+			return err
+		}
+	} else {
+		p.lru.MoveToFront(pt.elem)
+	}
+
+	if err := pt.w.Write(record); err != nil {
+		return err
+	}
+	pt.rows++
+
+	if (p.MaxRows > 0 && pt.rows >= p.MaxRows) || (p.MaxBytes > 0 && pt.cw.n+int64(pt.w.w.Buffered()) >= p.MaxBytes) {
+		if err := p.close(pt); err != nil {
+			return err
+		}
+		pt.index++
+		pt.rows = 0
+		pt.bytes = 0
+		pt.created = false
+	}
+
+	return nil
+}
+
+// Close 关闭所有打开的文件
+func (p *PartitionWriter) Close() error {
+
+	var err error
+	for p.lru != nil && p.lru.Len() > 0 {
+		err = errors.Join(err, p.close(p.lru.Back().Value.(*part)))
+	}
+	return err
+}
+
+// HivePartition 生成 name=value 形式的分区路径，如 dt=2024-05-01/region=east，value 中的特殊字符会被转义
+func HivePartition(names []string, values []string) string {
+
+	var sb strings.Builder
+	for i, name := range names {
+		if i > 0 {
+			sb.WriteByte('/')
+		}
+		v := ""
+		if i < len(values) {
+			v = values[i]
+		}
+		if v == "" {
+			v = "__HIVE_DEFAULT_PARTITION__"
+		}
+		sb.WriteString(name)
+		sb.WriteByte('=')
+		sb.WriteString(url.PathEscape(v))
+	}
+	return sb.String()
+}
+
+// ColumnPartition 返回按列生成分区路径的函数，names 为分区名，cols 为对应的列下标
+func ColumnPartition(names []string, cols ...int) func(record []string) string {
+
+	return func(record []string) string {
+		values := make([]string, len(cols))
+		for i, c := range cols {
+			if c < len(record) {
+				values[i] = record[c]
+			}
+		}
+		return HivePartition(names, values)
+	}
+}
@@ -0,0 +1,495 @@
+package file
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// 推断出的列类型
+const (
+	TypeInt      = "int"
+	TypeFloat    = "float"
+	TypeBool     = "bool"
+	TypeDate     = "date"
+	TypeDateTime = "datetime"
+	TypeString   = "string"
+)
+
+// 按顺序尝试的日期格式
+var dateLayouts = []string{
+	"2006-01-02",
+	"2006/01/02",
+	"2006.01.02",
+	"01/02/2006",
+	"02.01.2006",
+}
+
+// 按顺序尝试的时间格式，秒后面的小数部分可以省略
+var dateTimeLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	time.RFC3339,
+	"2006/01/02 15:04:05",
+	"2006-01-02 15:04",
+	"2006/01/02 15:04",
+}
+
+// ColumnSchema 推断出的列信息
+type ColumnSchema struct {
+	Name        string // 列名
+	Type        string // 列类型，TypeInt、TypeFloat 等
+	Layout      string // 日期或时间格式，仅 TypeDate、TypeDateTime 有效
+	Fraction    bool   // 时间是否包含小数秒
+	Nullable    bool   // 是否出现空值
+	MaxLength   int    // 最大字符数
+	Min         int64  // 最小值，仅 TypeInt 有效
+	Max         int64  // 最大值，仅 TypeInt 有效
+	Cardinality int    // 不同值个数，超过 1024 个时为估计值
+	Count       int    // 非空值个数
+}
+
+// Schema 推断出的文件结构
+type Schema struct {
+	Columns []ColumnSchema
+	Rows    int // 采样的行数
+}
+
+// InferOptions 结构推断配置
+type InferOptions struct {
+	Comma      string   // 分隔符
+	Escape     byte     // 转义字符
+	Header     bool     // 第一行是否为表头
+	SampleRows int      // 采样行数，0 表示读取全部
+	NullValues []string // 视为空值的字符串
+	Encoding   string   // 文件编码
+}
+
+// NewInferOptions 返回默认配置：逗号分隔，包含表头，采样 10000 行，空字符串、NULL、null、\N 视为空值
+func NewInferOptions() *InferOptions {
+
+	return &InferOptions{
+		Comma:      ",",
+		Escape:     '"',
+		Header:     true,
+		SampleRows: 10000,
+		NullValues: []string{"", "NULL", "null", `\N`},
+		Encoding:   UTF8,
+	}
+}
+
+func (o *InferOptions) SetComma(comma string) *InferOptions {
+	o.Comma = comma
+
+	return o
+}
+
+func (o *InferOptions) SetEscape(escape byte) *InferOptions {
+	o.Escape = escape
+
+	return o
+}
+
+func (o *InferOptions) SetHeader(header bool) *InferOptions {
+	o.Header = header
+
+	return o
+}
+
+func (o *InferOptions) SetSampleRows(n int) *InferOptions {
+	o.SampleRows = n
+
+	return o
+}
+
+func (o *InferOptions) SetNullValues(values ...string) *InferOptions {
+	o.NullValues = values
+
+	return o
+}
+
+func (o *InferOptions) SetEncoding(enc string) *InferOptions {
+	o.Encoding = enc
+
+	return o
+}
+
+// kmvSize KMV 基数估计保留的最小哈希个数
+const kmvSize = 1024
+
+// kmv 保留最小的 k 个哈希值，用于估计不同值个数
+type kmv struct {
+	h    hashHeap
+	seen map[uint64]struct{}
+}
+
+type hashHeap []uint64
+
+func (h hashHeap) Len() int           { return len(h) }
+func (h hashHeap) Less(i, j int) bool { return h[i] > h[j] }
+func (h hashHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *hashHeap) Push(x any)        { *h = append(*h, x.(uint64)) }
+func (h *hashHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+func (k *kmv) add(s string) {
+
+	f := fnv.New64a()
+	f.Write([]byte(s))
+	v := f.Sum64()
+
+	if _, ok := k.seen[v]; ok {
+		return
+	}
+	if len(k.h) < kmvSize {
+		heap.Push(&k.h, v)
+		k.seen[v] = struct{}{}
+		return
+	}
+	if v >= k.h[0] {
+		return
+	}
+	delete(k.seen, heap.Pop(&k.h).(uint64))
+	heap.Push(&k.h, v)
+	k.seen[v] = struct{}{}
+}
+
+func (k *kmv) estimate() int {
+	if len(k.h) < kmvSize {
+		return len(k.h)
+	}
+	return int(float64(kmvSize-1) / (float64(k.h[0]) / math.MaxUint64))
+}
+
+// columnState 单列推断过程中的状态
+type columnState struct {
+	col ColumnSchema
+
+	isInt, isFloat, isBool bool
+	dates, dateTimes       []string
+	card                   kmv
+}
+
+func newColumnState(name string) *columnState {
+	return &columnState{
+		col:       ColumnSchema{Name: name, Min: math.MaxInt64, Max: math.MinInt64},
+		isInt:     true,
+		isFloat:   true,
+		isBool:    true,
+		dates:     dateLayouts,
+		dateTimes: dateTimeLayouts,
+		card:      kmv{seen: map[uint64]struct{}{}},
+	}
+}
+
+func filterLayouts(layouts []string, v string) []string {
+	var res []string
+	for _, l := range layouts {
+		if _, err := time.Parse(l, v); err == nil {
+			res = append(res, l)
+		}
+	}
+	return res
+}
+
+func (c *columnState) add(v string) {
+
+	c.col.Count++
+	c.col.MaxLength = max(c.col.MaxLength, utf8.RuneCountInString(v))
+	c.card.add(v)
+
+	if c.isInt {
+		// 以 0 开头的多位数字通常是编号，保留为字符串
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || (len(v) > 1 && v[0] == '0') {
+			c.isInt = false
+		} else {
+			c.col.Min = min(c.col.Min, n)
+			c.col.Max = max(c.col.Max, n)
+		}
+	}
+	if c.isFloat {
+		// ParseFloat 接受 NaN、Inf 等写法，这类值不作为数字
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) || (len(v) > 1 && v[0] == '0' && v[1] != '.') {
+			c.isFloat = false
+		}
+	}
+	if c.isBool {
+		switch strings.ToLower(v) {
+		case "true", "false":
+		default:
+			c.isBool = false
+		}
+	}
+	if len(c.dates) > 0 {
+		c.dates = filterLayouts(c.dates, v)
+	}
+	if len(c.dateTimes) > 0 {
+		c.dateTimes = filterLayouts(c.dateTimes, v)
+		if len(v) > 16 && strings.Contains(v[16:], ".") {
+			c.col.Fraction = true
+		}
+	}
+}
+
+func (c *columnState) result() ColumnSchema {
+
+	col := c.col
+	col.Cardinality = c.card.estimate()
+
+	switch {
+	case col.Count == 0:
+		col.Type = TypeString
+	case c.isBool:
+		col.Type = TypeBool
+	case c.isInt:
+		col.Type = TypeInt
+	case c.isFloat:
+		col.Type = TypeFloat
+	case len(c.dates) > 0:
+		col.Type, col.Layout = TypeDate, c.dates[0]
+	case len(c.dateTimes) > 0:
+		col.Type, col.Layout = TypeDateTime, c.dateTimes[0]
+	default:
+		col.Type = TypeString
+	}
+
+	if col.Type != TypeInt {
+		col.Min, col.Max = 0, 0
+	}
+	if col.Type != TypeDateTime {
+		col.Fraction = false
+	}
+
+	return col
+}
+
+// InferSchema 采样分隔符文件推断每列的类型、是否可空、最大长度和不同值个数
+// 参数:
+//
+//   - path - 文件路径，.gz 后缀的文件会自动解压
+//   - opts - 推断配置，为 nil 时使用 NewInferOptions()
+//
+// 返回:
+//
+//   - 推断出的结构，没有表头时列名为 c1、c2 ...
+//   - 错误信息
+func InferSchema(path string, opts *InferOptions) (*Schema, error) {
+
+	if opts == nil {
+		opts = NewInferOptions()
+	}
+
+	f, err := OpenEncoding(path, opts.Encoding)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := NewReader(f, opts.Comma, opts.Escape)
+	r.FieldsPerRecord = -1
+
+	nulls := map[string]struct{}{}
+	for _, v := range opts.NullValues {
+		nulls[v] = struct{}{}
+	}
+
+	var cols []*columnState
+	schema := &Schema{}
+
+	if opts.Header {
+		header, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return schema, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range header {
+			cols = append(cols, newColumnState(name))
+		}
+	}
+
+	for opts.SampleRows <= 0 || schema.Rows < opts.SampleRows {
+
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		schema.Rows++
+
+		for len(cols) < len(record) {
+			cols = append(cols, newColumnState(fmt.Sprintf("c%d", len(cols)+1)))
+			// 新出现的列在之前的行中缺失
+			cols[len(cols)-1].col.Nullable = schema.Rows > 1
+		}
+
+		for i, c := range cols {
+			if i >= len(record) {
+				c.col.Nullable = true
+				continue
+			}
+			if _, ok := nulls[record[i]]; ok {
+				c.col.Nullable = true
+				continue
+			}
+			c.add(record[i])
+		}
+	}
+
+	for _, c := range cols {
+		schema.Columns = append(schema.Columns, c.result())
+	}
+
+	return schema, nil
+}
+
+func quoteIdent(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// MysqlType 返回列对应的 MySQL 类型
+func (c ColumnSchema) MysqlType() string {
+
+	switch c.Type {
+	case TypeInt:
+		if c.Min >= math.MinInt32 && c.Max <= math.MaxInt32 {
+			return "INT"
+		}
+		return "BIGINT"
+	case TypeFloat:
+		return "DOUBLE"
+	case TypeBool:
+		return "TINYINT(1)"
+	case TypeDate:
+		return "DATE"
+	case TypeDateTime:
+		if c.Fraction {
+			return "DATETIME(3)"
+		}
+		return "DATETIME"
+	default:
+		// 行大小上限为 65535 字节，由所有 VARCHAR 列共享，较长的列使用 TEXT 避免建表失败
+		// TEXT 等类型的上限为字节数，按 utf8mb4 每字符 4 字节计算
+		switch {
+		case c.MaxLength <= 255:
+			return fmt.Sprintf("VARCHAR(%d)", max(c.MaxLength, 1))
+		case c.MaxLength <= 65535/4:
+			return "TEXT"
+		case c.MaxLength <= 16777215/4:
+			return "MEDIUMTEXT"
+		default:
+			return "LONGTEXT"
+		}
+	}
+}
+
+// CKType 返回列对应的 ClickHouse 类型，低基数的字符串列使用 LowCardinality(String)
+func (c ColumnSchema) CKType() string {
+
+	var t string
+
+	switch c.Type {
+	case TypeInt:
+		if c.Min >= math.MinInt32 && c.Max <= math.MaxInt32 {
+			t = "Int32"
+		} else {
+			t = "Int64"
+		}
+	case TypeFloat:
+		t = "Float64"
+	case TypeBool:
+		t = "Bool"
+	case TypeDate:
+		t = "Date"
+	case TypeDateTime:
+		if c.Fraction {
+			t = "DateTime64(3)"
+		} else {
+			t = "DateTime"
+		}
+	default:
+		t = "String"
+		if c.Nullable {
+			t = "Nullable(String)"
+		}
+		// ClickHouse 只接受 LowCardinality(Nullable(String))，不接受 Nullable 包裹 LowCardinality
+		if c.Count > 0 && c.Cardinality <= 10000 && c.Cardinality*10 <= c.Count {
+			t = "LowCardinality(" + t + ")"
+		}
+		return t
+	}
+
+	if c.Nullable {
+		t = "Nullable(" + t + ")"
+	}
+
+	return t
+}
+
+// MysqlDDL 生成 MySQL 建表语句
+func (s *Schema) MysqlDDL(table string) string {
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "CREATE TABLE %s (\n", quoteIdent(table))
+
+	for i, c := range s.Columns {
+		null := "NOT NULL"
+		if c.Nullable {
+			null = "NULL"
+		}
+		fmt.Fprintf(&sb, "  %s %s %s", quoteIdent(c.Name), c.MysqlType(), null)
+		if i < len(s.Columns)-1 {
+			sb.WriteString(",")
+		}
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString(") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4")
+
+	return sb.String()
+}
+
+// CKDDL 生成 ClickHouse MergeTree 建表语句，orderBy 为空时使用 tuple()
+func (s *Schema) CKDDL(table string, orderBy ...string) string {
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "CREATE TABLE %s (\n", quoteIdent(table))
+
+	for i, c := range s.Columns {
+		fmt.Fprintf(&sb, "  %s %s", quoteIdent(c.Name), c.CKType())
+		if i < len(s.Columns)-1 {
+			sb.WriteString(",")
+		}
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString(") ENGINE = MergeTree\nORDER BY ")
+
+	if len(orderBy) == 0 {
+		sb.WriteString("tuple()")
+	} else {
+		keys := make([]string, len(orderBy))
+		for i, k := range orderBy {
+			keys[i] = quoteIdent(k)
+		}
+		sb.WriteString("(" + strings.Join(keys, ", ") + ")")
+	}
+
+	return sb.String()
+}
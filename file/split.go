@@ -2,242 +2,456 @@ package file
 
 import (
 	"bufio"
+	"compress/gzip"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 )
 
-// SplitFileByLines 按文件行数拆分文件
-// 参数:
-//
-//   - inputFile - 文件路径
-//   - linesPerFile - 每个文件的行数
-//   - addHeader - 是否添加文件头
-//   - deleteSource - 是否删除源文件
-//
-// 返回:
-//
-//   - 错误信息
-func SplitFileByLines(inputFile string, linesPerFile int, addHeader, deleteSource bool) error {
-	fileInfo, err := os.Stat(inputFile)
-	if err != nil {
-		return fmt.Errorf("file %s does not exist", inputFile)
+// SplitPart 拆分后生成的文件
+type SplitPart struct {
+	Path string // 文件路径
+	Rows int    // 数据行数，不含表头
+}
+
+// Splitter 分隔符文件拆分配置。
+// 使用 Reader 按记录读取，引号内的换行不会被拆开；.gz 后缀的输入会自动解压，
+// 输出文件名以 .gz 结尾时会压缩写入。Lines 为 true 时按原始行拆分，不解析字段。
+type Splitter struct {
+	Lines        bool   // 按原始行拆分，不解析分隔符和引号，输出内容与输入逐字节一致
+	Comma        string // 分隔符
+	Escape       byte   // 转义字符
+	UseQuote     bool   // 写入时是否在需要时为字段加引号
+	Header       bool   // 输入文件第一行是否为表头
+	AddHeader    bool   // 是否在每个输出文件中写入表头
+	Rows         int    // 每个文件的最大行数，0 表示不限制
+	Bytes        int64  // 每个文件的最大字节数（压缩前），0 表示不限制
+	Template     string // 输出文件名模板，见 SetTemplate
+	DeleteSource bool   // 拆分完成后是否删除源文件
+}
+
+// NewSplitter 返回默认的拆分配置：逗号分隔，输入包含表头并写入每个输出文件，
+// 输出文件名为 {dir}/{name}_{n}{ext}
+func NewSplitter() *Splitter {
+
+	return &Splitter{
+		Comma:     ",",
+		Escape:    '"',
+		UseQuote:  true,
+		Header:    true,
+		AddHeader: true,
+		Template:  "{dir}/{name}_{n}{ext}",
 	}
+}
 
-	fileSize := fileInfo.Size()
-	if fileSize == 0 {
-		fmt.Println("File is empty, no need to split.")
-		return nil
+func (s *Splitter) SetComma(comma string) *Splitter {
+	s.Comma = comma
+
+	return s
+}
+
+func (s *Splitter) SetEscape(escape byte) *Splitter {
+	s.Escape = escape
+
+	return s
+}
+
+func (s *Splitter) SetUseQuote(useQuote bool) *Splitter {
+	s.UseQuote = useQuote
+
+	return s
+}
+
+// SetHeader 设置输入是否包含表头，以及是否将表头写入每个输出文件
+func (s *Splitter) SetHeader(header, addHeader bool) *Splitter {
+	s.Header = header
+	s.AddHeader = addHeader
+
+	return s
+}
+
+// SetRows 设置每个文件的最大行数
+func (s *Splitter) SetRows(rows int) *Splitter {
+	s.Rows = rows
+
+	return s
+}
+
+// SetBytes 设置每个文件的最大字节数
+func (s *Splitter) SetBytes(bytes int64) *Splitter {
+	s.Bytes = bytes
+
+	return s
+}
+
+// SetTemplate 设置输出文件名模板，支持以下占位符:
+//
+//   - {dir} - 源文件所在目录
+//   - {name} - 源文件名，不含后缀
+//   - {ext} - 源文件后缀，如 .csv、.csv.gz
+//   - {n} - 从 1 开始的序号，{n:4} 表示补零到 4 位
+func (s *Splitter) SetTemplate(tmpl string) *Splitter {
+	s.Template = tmpl
+
+	return s
+}
+
+// SetLines 设置是否按原始行拆分，此时 Comma、Escape、UseQuote 不起作用
+func (s *Splitter) SetLines(lines bool) *Splitter {
+	s.Lines = lines
+
+	return s
+}
+
+func (s *Splitter) SetDeleteSource(del bool) *Splitter {
+	s.DeleteSource = del
+
+	return s
+}
+
+// splitExt 返回文件后缀，.gz 文件包含前一级后缀，如 .csv.gz
+func splitExt(path string) string {
+	ext := filepath.Ext(path)
+	if strings.EqualFold(ext, ".gz") {
+		ext = filepath.Ext(strings.TrimSuffix(path, ext)) + ext
 	}
+	return ext
+}
 
-	fmt.Println("Splitting file by lines.")
+func (s *Splitter) name(path string, n int) string {
 
-	file, err := os.Open(inputFile)
-	if err != nil {
-		return err
+	ext := splitExt(path)
+	base := filepath.Base(path)
+
+	out := strings.NewReplacer(
+		"{dir}", filepath.Dir(path),
+		"{name}", strings.TrimSuffix(base, ext),
+		"{ext}", ext,
+		"{n}", strconv.Itoa(n),
+	).Replace(s.Template)
+
+	// {n:width}
+	for {
+		i := strings.Index(out, "{n:")
+		if i < 0 {
+			break
+		}
+		j := strings.IndexByte(out[i:], '}')
+		if j < 0 {
+			break
+		}
+		width, err := strconv.Atoi(out[i+3 : i+j])
+		if err != nil {
+			break
+		}
+		out = out[:i] + fmt.Sprintf("%0*d", width, n) + out[i+j+1:]
 	}
-	defer file.Close()
 
-	reader := bufio.NewReader(file)
-	header, err := reader.ReadString('\n')
-	if err != nil {
-		return err
+	return filepath.Clean(out)
+}
+
+// splitOutput 正在写入的拆分文件
+type splitOutput struct {
+	f  *os.File
+	gz *gzip.Writer
+	cw *countWriter
+	w  *Writer
+}
+
+func (o *splitOutput) close() error {
+	err := o.w.Flush()
+	if o.gz != nil {
+		err = errors.Join(err, o.gz.Close())
 	}
+	return errors.Join(err, o.f.Close())
+}
+
+func (s *Splitter) create(name string, header *splitRecord) (*splitOutput, error) {
 
-	baseName := strings.TrimSuffix(inputFile, filepath.Ext(inputFile))
-	ext := filepath.Ext(inputFile)
-	chunkIndex := 1
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return nil, err
+	}
 
-	chunkFileName := fmt.Sprintf("%s_%d%s", baseName, chunkIndex, ext)
-	chunkFile, err := os.Create(chunkFileName)
+	f, err := os.Create(name)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer chunkFile.Close()
 
-	writer := bufio.NewWriter(chunkFile)
-	defer writer.Flush()
+	o := &splitOutput{f: f}
+	var w io.Writer = f
+	if strings.HasSuffix(strings.ToLower(name), ".gz") {
+		o.gz = gzip.NewWriter(f)
+		w = o.gz
+	}
+	o.cw = &countWriter{w: w}
+	o.w = NewWriter(o.cw, s.Comma, s.UseQuote, s.Escape)
 
-	if addHeader {
-		_, err = writer.WriteString(header)
-		if err != nil {
-			return err
+	if s.AddHeader && header != nil {
+		if err := o.write(header); err != nil {
+			o.close()
+			return nil, err
 		}
 	}
 
-	lineCount := 0
+	return o, nil
+}
 
-	for {
-		line, err := reader.ReadString('\n')
-		if err != nil {
-			if err.Error() != "EOF" {
-				return err
-			}
-			break
-		}
+// splitRecord 一条记录，按原始行拆分时只有 line
+type splitRecord struct {
+	fields []string
+	line   string
+}
 
-		_, err = writer.WriteString(line)
-		if err != nil {
-			return err
-		}
+func (o *splitOutput) write(r *splitRecord) error {
+	if r.fields == nil {
+		_, err := o.w.w.WriteString(r.line)
+		return err
+	}
+	return o.w.Write(r.fields)
+}
 
-		lineCount++
-		if lineCount >= linesPerFile {
-			writer.Flush()
-			chunkFile.Close()
+// reader 返回逐条读取记录的函数，结束时返回 io.EOF
+func (s *Splitter) reader(in io.Reader) func() (*splitRecord, error) {
 
-			chunkIndex++
-			chunkFileName = fmt.Sprintf("%s_%d%s", baseName, chunkIndex, ext)
-			chunkFile, err = os.Create(chunkFileName)
-			if err != nil {
-				return err
+	if s.Lines {
+		br := bufio.NewReader(in)
+		return func() (*splitRecord, error) {
+			line, err := br.ReadString('\n')
+			if err == io.EOF && line != "" {
+				err = nil
 			}
-			defer chunkFile.Close()
-
-			writer = bufio.NewWriter(chunkFile)
-			if addHeader {
-				_, err = writer.WriteString(header)
-				if err != nil {
-					return err
-				}
+			if err != nil {
+				return nil, err
 			}
-			lineCount = 0
+			return &splitRecord{line: line}, nil
 		}
 	}
 
-	writer.Flush()
-
-	if deleteSource {
-		err = os.Remove(inputFile)
+	r := NewReader(in, s.Comma, s.Escape)
+	r.FieldsPerRecord = -1
+	return func() (*splitRecord, error) {
+		fields, err := r.Read()
 		if err != nil {
-			return fmt.Errorf("error removing original file: %v", err)
+			return nil, err
 		}
-		fmt.Println("File split completed successfully and original file removed.")
-	} else {
-		fmt.Println("File split completed successfully. Original file retained.")
+		if fields == nil {
+			fields = []string{}
+		}
+		return &splitRecord{fields: fields}, nil
 	}
-
-	return nil
 }
 
-// SplitFileBySize 按文件大小拆分文件
+// Split 按行数或字节数拆分文件，两者都设置时满足任一条件即开始新文件，空文件不会生成输出
 // 参数:
 //
-//   - inputFile - 文件路径
-//   - chunkSizeMB - 每个文件的大小（单位 MB）
-//   - addHeader - 是否添加文件头
-//   - deleteSource - 是否删除源文件
+//   - path - 文件路径，.gz 后缀的文件会自动解压
 //
 // 返回:
 //
+//   - 生成的文件及其行数
 //   - 错误信息
-func SplitFileBySize(inputFile string, chunkSizeMB int, addHeader, deleteSource bool) error {
-	fileInfo, err := os.Stat(inputFile)
-	if err != nil {
-		return fmt.Errorf("file %s does not exist", inputFile)
-	}
-
-	fileSize := fileInfo.Size()
-	if fileSize == 0 {
-		fmt.Println("File is empty, no need to split.")
-		return nil
-	}
-
-	chunkSizeBytes := int64(chunkSizeMB * 1024 * 1024)
-
-	if fileSize <= chunkSizeBytes {
-		fmt.Println("File size is not larger than the specified chunk size, no need to split.")
-		return nil
-	}
-
-	fmt.Println("Splitting file by size.")
-
-	file, err := os.Open(inputFile)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
+func (s *Splitter) Split(path string) ([]SplitPart, error) {
 
-	reader := bufio.NewReader(file)
-	header, err := reader.ReadString('\n')
-	if err != nil {
-		return err
+	if s.Rows <= 0 && s.Bytes <= 0 {
+		return nil, errors.New("rows or bytes must be set")
 	}
 
-	baseName := strings.TrimSuffix(inputFile, filepath.Ext(inputFile))
-	ext := filepath.Ext(inputFile)
-	chunkIndex := 1
-
-	chunkFileName := fmt.Sprintf("%s_%d%s", baseName, chunkIndex, ext)
-	chunkFile, err := os.Create(chunkFileName)
+	in, err := Open(path)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer chunkFile.Close()
+	defer in.Close()
 
-	writer := bufio.NewWriter(chunkFile)
-	defer writer.Flush()
+	read := s.reader(in)
 
-	if addHeader {
-		_, err = writer.WriteString(header)
+	var header *splitRecord
+	if s.Header {
+		header, err = read()
+		if err == io.EOF {
+			return nil, nil
+		}
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
-	var currentSize int64
+	var (
+		parts []SplitPart
+		out   *splitOutput
+	)
+
+	defer func() {
+		if out != nil {
+			out.close()
+		}
+	}()
 
 	for {
-		line, err := reader.ReadString('\n')
+		record, err := read()
+		if err == io.EOF {
+			break
+		}
 		if err != nil {
-			if err.Error() != "EOF" {
-				return err
+			return parts, err
+		}
+
+		if out == nil {
+			name := s.name(path, len(parts)+1)
+			if name == filepath.Clean(path) {
+				return parts, fmt.Errorf("output %s overwrites source file", name)
 			}
-			break
+			if out, err = s.create(name, header); err != nil {
+				return parts, err
+			}
+			parts = append(parts, SplitPart{Path: name})
 		}
 
-		lineBytes := int64(len(line))
-		if currentSize+lineBytes > chunkSizeBytes {
-			writer.Flush()
-			chunkFile.Close()
+		if err := out.write(record); err != nil {
+			return parts, err
+		}
+
+		p := &parts[len(parts)-1]
+		p.Rows++
 
-			chunkIndex++
-			chunkFileName = fmt.Sprintf("%s_%d%s", baseName, chunkIndex, ext)
-			chunkFile, err = os.Create(chunkFileName)
+		if (s.Rows > 0 && p.Rows >= s.Rows) || (s.Bytes > 0 && out.cw.n+int64(out.w.w.Buffered()) >= s.Bytes) {
+			err := out.close()
+			out = nil
 			if err != nil {
-				return err
-			}
-			defer chunkFile.Close()
-
-			writer = bufio.NewWriter(chunkFile)
-			if addHeader {
-				_, err = writer.WriteString(header)
-				if err != nil {
-					return err
-				}
+				return parts, err
 			}
-			currentSize = 0
 		}
+	}
 
-		_, err = writer.WriteString(line)
+	if out != nil {
+		err := out.close()
+		out = nil
 		if err != nil {
-			return err
+			return parts, err
+		}
+	}
+
+	if s.DeleteSource {
+		in.Close()
+		if err := os.Remove(path); err != nil {
+			return parts, fmt.Errorf("error removing original file: %w", err)
 		}
-		currentSize += lineBytes
 	}
 
-	writer.Flush()
+	return parts, nil
+}
 
-	if deleteSource {
-		err = os.Remove(inputFile)
-		if err != nil {
-			return fmt.Errorf("error removing original file: %v", err)
+// SplitDir 并发拆分目录下匹配的文件，匹配多个文件时 Template 必须包含 {name}，否则各文件的输出会互相覆盖
+// 参数:
+//
+//   - dir - 目录
+//   - pattern - 文件名匹配模式，语法同 filepath.Match，如 *.csv
+//   - parallel - 并发数
+//
+// 返回:
+//
+//   - 所有生成的文件及其行数，按源文件名排序
+//   - 错误信息，多个文件出错时合并返回
+func (s *Splitter) SplitDir(dir, pattern string, parallel int) ([]SplitPart, error) {
+
+	files, err := filepath.Glob(filepath.Join(dir, pattern))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	n := 0
+	for _, f := range files {
+		if !IsDir(f) {
+			n++
 		}
-		fmt.Println("File split completed successfully and original file removed.")
-	} else {
-		fmt.Println("File split completed successfully. Original file retained.")
+	}
+	if n > 1 && !strings.Contains(s.Template, "{name}") {
+		return nil, fmt.Errorf("template %q must contain {name} when splitting %d files", s.Template, n)
+	}
+
+	results := make([][]SplitPart, len(files))
+	errs := make([]error, len(files))
+
+	sem := make(chan struct{}, max(parallel, 1))
+	var wg sync.WaitGroup
+
+	for i, f := range files {
+		if IsDir(f) {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, f string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			parts, err := s.Split(f)
+			results[i] = parts
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", f, err)
+			}
+		}(i, f)
+	}
+	wg.Wait()
+
+	var parts []SplitPart
+	for _, r := range results {
+		parts = append(parts, r...)
+	}
+
+	return parts, errors.Join(errs...)
+}
+
+// SplitFileByLines 按文件行数拆分文件，按原始行拆分，不解析字段，第一行视为表头，输出文件为 {name}_{n}{ext}。
+// 需要保留引号内的换行时使用 Splitter
+// 参数:
+//
+//   - inputFile - 文件路径
+//   - linesPerFile - 每个文件的行数
+//   - addHeader - 是否添加文件头
+//   - deleteSource - 是否删除源文件
+//
+// 返回:
+//
+//   - 错误信息
+func SplitFileByLines(inputFile string, linesPerFile int, addHeader, deleteSource bool) error {
+
+	if _, err := os.Stat(inputFile); err != nil {
+		return fmt.Errorf("file %s does not exist", inputFile)
+	}
+
+	_, err := NewSplitter().SetLines(true).SetHeader(true, addHeader).SetRows(linesPerFile).SetDeleteSource(deleteSource).Split(inputFile)
+	return err
+}
+
+// SplitFileBySize 按文件大小拆分文件，按原始行拆分，不解析字段，第一行视为表头，文件不大于 chunkSizeMB 时不拆分
+// 参数:
+//
+//   - inputFile - 文件路径
+//   - chunkSizeMB - 每个文件的大小（单位 MB）
+//   - addHeader - 是否添加文件头
+//   - deleteSource - 是否删除源文件
+//
+// 返回:
+//
+//   - 错误信息
+func SplitFileBySize(inputFile string, chunkSizeMB int, addHeader, deleteSource bool) error {
+
+	info, err := os.Stat(inputFile)
+	if err != nil {
+		return fmt.Errorf("file %s does not exist", inputFile)
+	}
+
+	chunkSizeBytes := int64(chunkSizeMB) * 1024 * 1024
+	if info.Size() <= chunkSizeBytes {
+		return nil
 	}
 
-	return nil
+	_, err = NewSplitter().SetLines(true).SetHeader(true, addHeader).SetBytes(chunkSizeBytes).SetDeleteSource(deleteSource).Split(inputFile)
+	return err
 }
@@ -1,8 +1,11 @@
 package file
 
 import (
+	"compress/gzip"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 // 判断文件或文件夹是否存在
@@ -62,3 +65,77 @@ func GetFileList(dir string) ([]string, error) {
 
 	return res, nil
 }
+
+type gzipReadCloser struct {
+	*gzip.Reader
+	f *os.File
+}
+
+func (g *gzipReadCloser) Close() error {
+	g.Reader.Close()
+	return g.f.Close()
+}
+
+// Open 打开文件用于读取，.gz 后缀的文件会自动解压
+// 参数:
+//
+//   - name - 文件路径
+//
+// 返回:
+//
+//   - io.ReadCloser，关闭时会同时关闭底层文件
+//   - 错误信息
+func Open(name string) (io.ReadCloser, error) {
+
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasSuffix(strings.ToLower(name), ".gz") {
+		return f, nil
+	}
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &gzipReadCloser{Reader: gz, f: f}, nil
+}
+
+type decodeReadCloser struct {
+	io.Reader
+	c io.Closer
+}
+
+func (d *decodeReadCloser) Close() error {
+	return d.c.Close()
+}
+
+// OpenEncoding 打开文件并将 enc 编码的内容转换为 UTF-8，.gz 后缀的文件会自动解压
+// 参数:
+//
+//   - name - 文件路径
+//   - enc - 文件编码，如 GBK、GB18030、Auto，为空时视为 UTF-8
+//
+// 返回:
+//
+//   - io.ReadCloser，关闭时会同时关闭底层文件
+//   - 错误信息
+func OpenEncoding(name, enc string) (io.ReadCloser, error) {
+
+	f, err := Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := NewDecodeReader(f, enc)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &decodeReadCloser{Reader: r, c: f}, nil
+}
@@ -0,0 +1,339 @@
+package iter
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/frankill/gotools/file"
+)
+
+// ArchiveField 压缩包读取配置
+type ArchiveField struct {
+	Path     string
+	Pattern  string // 成员名匹配模式，不含 / 时只匹配文件名部分，为空时读取全部成员
+	Encoding string // 成员文件编码，为空时视为 UTF-8，见 file.NewDecodeReader
+}
+
+// Archive 压缩包读取配置，支持 .zip、.tar、.tar.gz、.tgz
+func Archive(path string) *ArchiveField {
+
+	return &ArchiveField{
+		Path:     path,
+		Pattern:  "",
+		Encoding: file.UTF8,
+	}
+}
+
+// SetPattern 设置成员名匹配模式，语法同 path.Match，如 *.csv、2024/*.txt
+func (a *ArchiveField) SetPattern(pattern string) *ArchiveField {
+	a.Pattern = pattern
+
+	return a
+}
+
+// SetEncoding 设置成员文件编码，如 file.GBK、file.Auto
+func (a *ArchiveField) SetEncoding(enc string) *ArchiveField {
+	a.Encoding = enc
+
+	return a
+}
+
+func (a *ArchiveField) match(name string) (bool, error) {
+	if a.Pattern == "" {
+		return true, nil
+	}
+	if !strings.Contains(a.Pattern, "/") {
+		name = path.Base(name)
+	}
+	return path.Match(a.Pattern, name)
+}
+
+// walk 依次打开匹配的成员，.gz 后缀的成员自动解压
+func (a *ArchiveField) walk(fn func(name string, r io.Reader) error) error {
+
+	lower := strings.ToLower(a.Path)
+
+	open := func(name string, r io.Reader) error {
+		if strings.HasSuffix(strings.ToLower(name), ".gz") {
+			gz, err := gzip.NewReader(r)
+			if err != nil {
+				return err
+			}
+			defer gz.Close()
+			r = gz
+		}
+		dr, err := file.NewDecodeReader(r, a.Encoding)
+		if err != nil {
+			return err
+		}
+		return fn(name, dr)
+	}
+
+	if strings.HasSuffix(lower, ".zip") {
+		zr, err := zip.OpenReader(a.Path)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+
+		for _, m := range zr.File {
+			if m.FileInfo().IsDir() {
+				continue
+			}
+			ok, err := a.match(m.Name)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+
+			rc, err := m.Open()
+			if err != nil {
+				return err
+			}
+			err = open(m.Name, rc)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	f, err := os.Open(a.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	switch {
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	case strings.HasSuffix(lower, ".tar"):
+	default:
+		return fmt.Errorf("unsupported archive %s", a.Path)
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		ok, err := a.match(h.Name)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if err := open(h.Name, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// fromArchive 按顺序读取压缩包中匹配的成员，read 负责解析单个成员
+func fromArchive[T any](a *ArchiveField, read func(name string, r io.Reader, emit func(FileRecord[T]) bool) error) (chan FileRecord[T], chan error) {
+
+	ch := make(chan FileRecord[T], bufferSize)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(ch)
+		defer close(errs)
+
+		emit := func(r FileRecord[T]) bool {
+			ch <- r
+			return true
+		}
+
+		err := a.walk(func(name string, r io.Reader) error {
+			if err := read(name, r, emit); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			return nil
+		})
+		if err != nil {
+			errs <- err
+		}
+	}()
+
+	return ch, errs
+}
+
+// FromArchiveTxt 从压缩包中匹配的成员逐行读取文本，不需要解压到磁盘
+// 参数:
+//
+//   - a - 压缩包读取配置
+//   - skip - 每个成员跳过的行数
+//
+// 返回:
+//
+//   - 一个通道，用于接收带成员名和行号的数据
+//   - 一个通道，用于接收错误信息
+func FromArchiveTxt(a *ArchiveField) func(skip int) (chan FileRecord[string], chan error) {
+
+	return func(skip int) (chan FileRecord[string], chan error) {
+
+		return fromArchive(a, func(name string, r io.Reader, emit func(FileRecord[string]) bool) error {
+			return readTxt(r, name, skip, emit)
+		})
+	}
+}
+
+// FromArchiveCsv 从压缩包中匹配的 CSV 成员读取数据，不需要解压到磁盘
+// 参数:
+//
+//   - a - 压缩包读取配置
+//   - header - 每个成员是否包含表头
+//
+// 返回:
+//
+//   - 一个通道，用于接收带成员名和行号的数据
+//   - 一个通道，用于接收错误信息
+func FromArchiveCsv(a *ArchiveField) func(header bool) (chan FileRecord[[]string], chan error) {
+
+	return func(header bool) (chan FileRecord[[]string], chan error) {
+
+		return fromArchive(a, func(name string, r io.Reader, emit func(FileRecord[[]string]) bool) error {
+			return readCsv(r, name, header, emit)
+		})
+	}
+}
+
+// FromArchiveTable 从压缩包中匹配的分隔符文件成员读取数据，不需要解压到磁盘
+// 参数:
+//
+//   - a - 压缩包读取配置
+//   - header - 每个成员是否包含表头
+//   - seq - 分隔符
+//   - escape - 转义字符
+//
+// 返回:
+//
+//   - 一个通道，用于接收带成员名和行号的数据
+//   - 一个通道，用于接收错误信息
+func FromArchiveTable(a *ArchiveField) func(header bool, seq string, escape byte) (chan FileRecord[[]string], chan error) {
+
+	return func(header bool, seq string, escape byte) (chan FileRecord[[]string], chan error) {
+
+		return fromArchive(a, func(name string, r io.Reader, emit func(FileRecord[[]string]) bool) error {
+			return readTable(r, name, header, seq, escape, emit)
+		})
+	}
+}
+
+// ToZip 将通道中的数据按 File 字段写入 zip 压缩包中的多个 CSV 成员。
+// 不同成员的数据可以交错到达，会先写入输出目录下的临时文件，全部接收后按成员首次出现的顺序打包。
+// 临时文件由 file.PartitionWriter 管理，最多同时打开 64 个，超出时关闭最久未使用的文件。
+// 参数:
+//
+//   - path - zip 文件路径
+//   - header - 每个成员的表头，为空时不写表头
+//
+// 返回:
+//
+//   - 一个函数，用于执行文件写入操作
+func ToZip(path string, header ...string) func(ch chan FileRecord[[]string]) error {
+
+	return func(ch chan FileRecord[[]string]) error {
+
+		if path == "" {
+			return errors.New("path is empty")
+		}
+
+		// 临时文件放在输出目录中，避免占用系统临时目录
+		dir, err := os.MkdirTemp(filepath.Dir(path), ".zip-*")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+
+		// 每个成员对应一个以序号命名的分区，成员名可能包含路径分隔符，不能直接作为分区
+		pw := file.NewPartitionWriter(dir).SetHeader(header...)
+		defer pw.Close()
+
+		var names []string
+		parts := map[string]string{}
+
+		for r := range ch {
+
+			part, ok := parts[r.File]
+			if !ok {
+				part = strconv.Itoa(len(names))
+				parts[r.File] = part
+				names = append(names, r.File)
+			}
+
+			if err := pw.Write(part, r.Data); err != nil {
+				return err
+			}
+		}
+
+		if err := pw.Close(); err != nil {
+			return err
+		}
+
+		out, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+
+		zw := zip.NewWriter(out)
+
+		// 分区不滚动，每个成员只有一个文件，Files 按创建顺序返回
+		for i, name := range names {
+			if err := copyMember(zw, name, pw.Files()[i]); err != nil {
+				return err
+			}
+		}
+
+		if err := zw.Close(); err != nil {
+			return err
+		}
+
+		return out.Close()
+	}
+}
+
+// copyMember 将临时文件 tmp 写入压缩包成员 name
+func copyMember(zw *zip.Writer, name, tmp string) error {
+
+	f, err := os.Open(tmp)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w, f)
+	return err
+}
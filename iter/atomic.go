@@ -0,0 +1,120 @@
+package iter
+
+import (
+	"context"
+
+	"github.com/frankill/gotools/file"
+)
+
+// AtomicField 原子写入配置
+type AtomicField struct {
+	Ctx     context.Context // 取消时放弃写入并删除临时文件
+	Success bool            // 是否在写入成功后创建 _SUCCESS 标记文件
+}
+
+// Atomic 原子写入配置，默认不可取消、不创建标记文件
+func Atomic() *AtomicField {
+
+	return &AtomicField{
+		Ctx:     context.Background(),
+		Success: false,
+	}
+}
+
+func (a *AtomicField) SetContext(ctx context.Context) *AtomicField {
+	a.Ctx = ctx
+
+	return a
+}
+
+func (a *AtomicField) SetSuccess(success bool) *AtomicField {
+	a.Success = success
+
+	return a
+}
+
+// ToAtomic 将任意文件写入函数包装为原子写入：数据先写入同目录下的临时文件，
+// 全部写入成功后刷新到磁盘并重命名为 path；写入出错或 a.Ctx 取消时删除临时文件，path 保持不变。
+// 临时文件开始时为空，因此写入函数应使用覆盖模式。
+// 参数:
+//
+//   - path - 目标文件路径
+//   - a - 原子写入配置，为 nil 时使用 Atomic()
+//   - sink - 根据文件路径返回写入函数，如 func(p string) func(chan []string) error { return ToCsv(p, false) }
+//
+// 返回:
+//
+//   - 一个函数，用于执行文件写入操作
+func ToAtomic[T any](path string, a *AtomicField, sink func(path string) func(ch chan T) error) func(ch chan T) error {
+
+	if a == nil {
+		a = Atomic()
+	}
+
+	return func(ch chan T) error {
+
+		ctx := a.Ctx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+
+		return file.WriteAtomic(path, a.Success, func(tmp string) error {
+
+			in := make(chan T, bufferSize)
+			done := make(chan error, 1)
+
+			go func() {
+				done <- sink(tmp)(in)
+			}()
+
+			var (
+				err      error
+				finished bool
+				stopped  bool
+			)
+
+		loop:
+			for {
+				select {
+				case <-ctx.Done():
+					err, stopped = ctx.Err(), true
+					break loop
+				case x, ok := <-ch:
+					if !ok {
+						break loop
+					}
+					select {
+					case in <- x:
+					case <-ctx.Done():
+						err, stopped = ctx.Err(), true
+						break loop
+					case err = <-done:
+						finished, stopped = true, true
+						break loop
+					}
+				}
+			}
+
+			close(in)
+			if !finished {
+				if serr := <-done; err == nil {
+					err = serr
+				}
+			}
+
+			// 提前结束时继续消费上游数据，避免上游阻塞
+			if stopped {
+				go func() {
+					for range ch {
+					}
+				}()
+			}
+
+			if err == nil {
+				err = ctx.Err()
+			}
+
+			return err
+		})
+	}
+}
@@ -0,0 +1,341 @@
+package iter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/hamba/avro/v2"
+	"github.com/hamba/avro/v2/ocf"
+)
+
+// AvroField Avro 容器文件写入配置
+type AvroField struct {
+	Path   string
+	Schema string // 写入使用的 schema，为空时根据 T 推导
+	Codec  string // 压缩方式 null、deflate、snappy
+}
+
+// Avro Avro 容器文件写入配置，默认使用 deflate 压缩
+func Avro(path string) *AvroField {
+
+	return &AvroField{
+		Path:   path,
+		Schema: "",
+		Codec:  string(ocf.Deflate),
+	}
+}
+
+func (a *AvroField) SetSchema(schema string) *AvroField {
+	a.Schema = schema
+
+	return a
+}
+
+func (a *AvroField) SetCodec(codec string) *AvroField {
+	a.Codec = codec
+
+	return a
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// AvroSchema 根据结构体 T 推导 Avro record schema。
+// 字段名取 avro 标签，没有标签时使用字段名，标签为 - 的字段忽略。
+// 指针字段映射为 ["null", T] 联合类型并默认为 null，time.Time 映射为 timestamp-millis。
+func AvroSchema[T any]() (string, error) {
+
+	t := reflect.TypeOf((*T)(nil)).Elem()
+
+	s, err := avroType(t, "record", &avroNames{types: map[reflect.Type]string{}, used: map[string]bool{}})
+	if err != nil {
+		return "", err
+	}
+
+	b, err := json.Marshal(s)
+	return string(b), err
+}
+
+// avroNames schema 中已定义的 record 名称，同一 schema 内名称不能重复
+type avroNames struct {
+	types map[reflect.Type]string
+	used  map[string]bool
+}
+
+// name 为结构体分配唯一的 record 名称，具名类型使用类型名，匿名结构体使用字段路径，重名时追加序号
+func (n *avroNames) name(t reflect.Type, path string) string {
+
+	base := t.Name()
+	if base == "" {
+		base = path
+	}
+	base = avroIdent(base)
+
+	name := base
+	for i := 2; n.used[name]; i++ {
+		name = fmt.Sprintf("%s_%d", base, i)
+	}
+	n.used[name] = true
+	n.types[t] = name
+
+	return name
+}
+
+// avroIdent 将 s 转换为合法的 Avro 名称，只保留字母、数字和下划线，不能以数字开头
+func avroIdent(s string) string {
+
+	var b strings.Builder
+	for i, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	if b.Len() == 0 {
+		return "record"
+	}
+	return b.String()
+}
+
+// avroType 返回 t 对应的 Avro 类型，path 为字段路径，用于为匿名结构体命名
+func avroType(t reflect.Type, path string, names *avroNames) (any, error) {
+
+	if t == timeType {
+		return map[string]any{"type": "long", "logicalType": "timestamp-millis"}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return "string", nil
+	case reflect.Bool:
+		return "boolean", nil
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return "int", nil
+	case reflect.Int, reflect.Int64, reflect.Uint32:
+		return "long", nil
+	case reflect.Float32:
+		return "float", nil
+	case reflect.Float64:
+		return "double", nil
+	case reflect.Pointer:
+		elem, err := avroType(t.Elem(), path, names)
+		if err != nil {
+			return nil, err
+		}
+		return []any{"null", elem}, nil
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "bytes", nil
+		}
+		elem, err := avroType(t.Elem(), path+"_item", names)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"type": "array", "items": elem}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("avro: map key of %s must be string", t)
+		}
+		elem, err := avroType(t.Elem(), path+"_value", names)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"type": "map", "values": elem}, nil
+	case reflect.Struct:
+		if name, ok := names.types[t]; ok {
+			// 已定义过的 record 直接引用名称
+			return name, nil
+		}
+		record := names.name(t, path)
+
+		fields := make([]map[string]any, 0, t.NumField())
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+
+			name := f.Name
+			if tag, ok := f.Tag.Lookup("avro"); ok {
+				if tag == "-" {
+					continue
+				}
+				name = tag
+			}
+
+			ft, err := avroType(f.Type, path+"_"+name, names)
+			if err != nil {
+				return nil, err
+			}
+
+			field := map[string]any{"name": name, "type": ft}
+			if f.Type.Kind() == reflect.Pointer {
+				field["default"] = nil
+			}
+			fields = append(fields, field)
+		}
+
+		return map[string]any{"type": "record", "name": record, "fields": fields}, nil
+	default:
+		return nil, fmt.Errorf("avro: unsupported type %s", t)
+	}
+}
+
+// FromAvro 从 Avro 容器文件中读取数据，支持 deflate、snappy 压缩。
+// 文件中的 writer schema 与 reader schema 不同时按 Avro 规则进行 schema 演进，
+// reader 中新增的字段使用默认值填充。
+// 参数:
+//
+//   - path - 文件路径
+//   - schema - reader schema，为空时根据 T 推导
+//
+// 返回:
+//
+//   - chan T: 数据通道
+//   - chan error: 错误通道
+func FromAvro[T any](path string) func(schema string) (chan T, chan error) {
+
+	return func(schema string) (chan T, chan error) {
+
+		ch := make(chan T, bufferSize)
+		errs := make(chan error, 1)
+
+		go func() {
+			defer close(ch)
+			defer close(errs)
+
+			if schema == "" {
+				s, err := AvroSchema[T]()
+				if err != nil {
+					errs <- err
+					return
+				}
+				schema = s
+			}
+
+			reader, err := avro.Parse(schema)
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			f, err := os.Open(path)
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer f.Close()
+
+			dec, err := ocf.NewDecoder(f)
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			writer, err := avro.Parse(string(dec.Metadata()["avro.schema"]))
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			// writer 与 reader 一致时直接解码，否则先按 writer 解码再通过合成 schema 转换
+			var resolved avro.Schema
+			if writer.Fingerprint() != reader.Fingerprint() {
+				resolved, err = avro.NewSchemaCompatibility().Resolve(reader, writer)
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+
+			for dec.HasNext() {
+				var t T
+
+				if resolved == nil {
+					err = dec.Decode(&t)
+				} else {
+					var raw any
+					if err = dec.Decode(&raw); err == nil {
+						var b []byte
+						if b, err = avro.Marshal(writer, raw); err == nil {
+							err = avro.Unmarshal(resolved, b, &t)
+						}
+					}
+				}
+
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				ch <- t
+			}
+
+			if err := dec.Error(); err != nil {
+				errs <- err
+			}
+		}()
+
+		return ch, errs
+	}
+}
+
+// ToAvro 将通道中的数据写入 Avro 容器文件
+// 参数:
+//
+//   - a - Avro 容器文件写入配置
+//   - ch - 一个通道，用于接收待写入的数据
+//
+// 返回:
+//
+//   - 一个函数，用于执行文件写入操作
+func ToAvro[T any](a *AvroField) func(ch chan T) error {
+
+	return func(ch chan T) error {
+
+		if a.Path == "" {
+			return errors.New("path is empty")
+		}
+
+		schema := a.Schema
+		if schema == "" {
+			s, err := AvroSchema[T]()
+			if err != nil {
+				return err
+			}
+			schema = s
+		}
+
+		codec := ocf.CodecName(strings.ToLower(a.Codec))
+
+		f, err := os.Create(a.Path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		enc, err := ocf.NewEncoder(schema, f, ocf.WithCodec(codec))
+		if err != nil {
+			return err
+		}
+
+		for t := range ch {
+			if err := enc.Encode(t); err != nil {
+				return err
+			}
+		}
+
+		return enc.Close()
+	}
+}
@@ -0,0 +1,7 @@
+package iter
+
+// 导出内部函数供 iter_test 测试
+var (
+	SplitRange  = splitRange
+	KeysetAfter = keysetAfter
+)
@@ -4,17 +4,18 @@ import (
 	"bufio"
 	"compress/gzip"
 	"context"
-	"database/sql"
 	"encoding/csv"
 	"encoding/gob"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"log"
 	"os"
 	"reflect"
-	"strconv"
+	"strings"
 
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
 	"github.com/frankill/gotools"
 	"github.com/frankill/gotools/db"
 	"github.com/frankill/gotools/file"
@@ -66,6 +67,26 @@ func FromRedisList[T any](host, pwd string, dbN, num int) func(key string) (chan
 //   - 一个通道，用于接收从 gzip 文件中读取的数据。
 //   - 一个通道，用于接收错误信息
 func FromGzip(path string) func(skip int) (chan string, chan error) {
+
+	return fromGzip(path, file.UTF8)
+}
+
+// FromGzipT 方法按表格配置从 gzip 文件中读取指定编码的文本，转换为 UTF-8 后发送到通道中
+// 参数:
+//
+//   - t - 表格配置，使用其中的 Path、Encoding，编码如 file.GBK、file.Auto，开头的 BOM 会被去除
+//   - skip - 跳过的行数
+//
+// 返回:
+//
+//   - 一个通道，用于接收从 gzip 文件中读取的数据。
+//   - 一个通道，用于接收错误信息
+func FromGzipT(t *TableField) func(skip int) (chan string, chan error) {
+
+	return fromGzip(t.Path, t.Encoding)
+}
+
+func fromGzip(path string, enc string) func(skip int) (chan string, chan error) {
 	return func(skip int) (chan string, chan error) {
 		ch := make(chan string, bufferSize)
 		errs := make(chan error, 1)
@@ -88,7 +109,13 @@ func FromGzip(path string) func(skip int) (chan string, chan error) {
 			}
 			defer gz.Close()
 
-			scanner := bufio.NewScanner(gz)
+			r, err := file.NewDecodeReader(gz, enc)
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			scanner := bufio.NewScanner(r)
 
 			for i := 0; i < skip; i++ {
 				scanner.Scan()
@@ -116,6 +143,26 @@ func FromGzip(path string) func(skip int) (chan string, chan error) {
 // - 一个通道，用于接收错误信息
 func FromJson[T any](path string) func(skip int) (chan T, chan error) {
 
+	return fromJson[T](path, file.UTF8)
+}
+
+// FromJsonT 方法按表格配置从指定编码的 JSON 文件中逐行读取数据，转换为 UTF-8 后解码并发送到通道中
+// 参数:
+//
+//   - t - 表格配置，使用其中的 Path、Encoding，编码如 file.GBK、file.UTF16LE、file.Auto，开头的 BOM 会被去除
+//   - skip - 跳过的行数
+//
+// 返回:
+//
+// - 一个通道，用于接收从文件中读取的数据。
+// - 一个通道，用于接收错误信息
+func FromJsonT[T any](t *TableField) func(skip int) (chan T, chan error) {
+
+	return fromJson[T](t.Path, t.Encoding)
+}
+
+func fromJson[T any](path string, enc string) func(skip int) (chan T, chan error) {
+
 	return func(skip int) (chan T, chan error) {
 
 		ch := make(chan T, bufferSize)
@@ -132,7 +179,13 @@ func FromJson[T any](path string) func(skip int) (chan T, chan error) {
 			}
 			defer f.Close()
 
-			scanner := bufio.NewScanner(f)
+			r, err := file.NewDecodeReader(f, enc)
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			scanner := bufio.NewScanner(r)
 
 			for i := 0; i < skip; i++ {
 				scanner.Scan()
@@ -167,6 +220,26 @@ func FromJson[T any](path string) func(skip int) (chan T, chan error) {
 // - 一个通道，用于接收错误信息
 func FromTxt(path string) func(skip int) (chan string, chan error) {
 
+	return fromTxt(path, file.UTF8)
+}
+
+// FromTxtT 方法按表格配置从指定编码的文本文件中读取数据，转换为 UTF-8 后发送到通道中
+// 参数:
+//
+//   - t - 表格配置，使用其中的 Path、Encoding，编码如 file.GBK、file.GB18030、file.Auto，开头的 BOM 会被去除
+//   - skip - 跳过的行数
+//
+// 返回:
+//
+// - 一个通道，用于接收从文件中读取的数据。
+// - 一个通道，用于接收错误信息
+func FromTxtT(t *TableField) func(skip int) (chan string, chan error) {
+
+	return fromTxt(t.Path, t.Encoding)
+}
+
+func fromTxt(path string, enc string) func(skip int) (chan string, chan error) {
+
 	return func(skip int) (chan string, chan error) {
 
 		ch := make(chan string, bufferSize)
@@ -183,7 +256,13 @@ func FromTxt(path string) func(skip int) (chan string, chan error) {
 			}
 			defer f.Close()
 
-			scanner := bufio.NewScanner(f)
+			r, err := file.NewDecodeReader(f, enc)
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			scanner := bufio.NewScanner(r)
 
 			for i := 0; i < skip; i++ {
 				scanner.Scan()
@@ -334,7 +413,13 @@ func FromCsv(path string) func(header bool) (chan []string, chan error) {
 			}
 			defer f.Close()
 
-			reader := csv.NewReader(f)
+			r, err := file.NewDecodeReader(f, file.UTF8)
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			reader := csv.NewReader(r)
 
 			if header {
 				_, err := reader.Read()
@@ -382,6 +467,11 @@ func FromCsv(path string) func(header bool) (chan []string, chan error) {
 //   - 一个通道，通道中的值是读取表格文件时发生的错误。
 func FromTable(path string) func(header bool, seq string, escape byte) (chan []string, chan error) {
 
+	return fromTable(path, file.UTF8)
+}
+
+func fromTable(path string, enc string) func(header bool, seq string, escape byte) (chan []string, chan error) {
+
 	return func(header bool, seq string, escape byte) (chan []string, chan error) {
 		ch := make(chan []string, bufferSize)
 		errs := make(chan error, 1)
@@ -397,7 +487,13 @@ func FromTable(path string) func(header bool, seq string, escape byte) (chan []s
 			}
 			defer f.Close()
 
-			reader := file.NewReader(f, seq, escape)
+			r, err := file.NewDecodeReader(f, enc)
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			reader := file.NewReader(r, seq, escape)
 
 			if header {
 				_, err := reader.Read()
@@ -429,6 +525,83 @@ func FromTable(path string) func(header bool, seq string, escape byte) (chan []s
 	}
 }
 
+// FromTableT 按表格配置读取文件，Encoding 不是 UTF-8 时转换为 UTF-8，开头的 BOM 会被去除。
+// t.Parallel 大于 1 时将单个大文件按记录边界切分为多段并发解析。
+// 切分时识别引号内的换行，支持 Escape 转义和多字符分隔符；只有未压缩的 UTF-8 文件可以切分，
+// 其余文件按顺序读取。默认配置 T(path) 即按 CSV 读取。
+// 参数:
+//
+//   - t: 表格配置，使用其中的 Path、Seq、Escape、Encoding、Parallel、Ordered。
+//   - header: 是否包含表头，布尔类型。
+//
+// 返回:
+//   - 一个通道，通道中的值是读取的表格文件中的每一行数据，每一行数据是一个字符串切片（[]string）。
+//   - 一个通道，通道中的值是读取表格文件时发生的错误。
+func FromTableT(t *TableField) func(header bool) (chan []string, chan error) {
+
+	return func(header bool) (chan []string, chan error) {
+
+		enc, _ := file.NormalizeEncoding(t.Encoding)
+		if t.Parallel <= 1 || enc != file.UTF8 || strings.HasSuffix(strings.ToLower(t.Path), ".gz") {
+			return fromTable(t.Path, t.Encoding)(header, t.Seq, t.Escape)
+		}
+
+		return fromChunks(t.Path, t.Parallel, t.Ordered, header, t.Escape, func(r io.Reader) func() ([]string, error) {
+			return file.NewReader(r, t.Seq, t.Escape).Read
+		})
+	}
+}
+
+// fromChunks 切分文件后每段使用 newReader 创建的解析函数并发读取
+func fromChunks(path string, parallel int, ordered bool, header bool, escape byte, newReader func(r io.Reader) func() ([]string, error)) (chan []string, chan error) {
+
+	parallel = max(parallel, 1)
+
+	chunks, err := file.SplitChunks(path, parallel*4, escape)
+	if err != nil {
+		ch := make(chan []string)
+		errs := make(chan error, 1)
+		errs <- err
+		close(ch)
+		close(errs)
+		return ch, errs
+	}
+
+	return fanIn(len(chunks), parallel, ordered, false, func(i int, emit func([]string) bool) error {
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		c := chunks[i]
+		read := newReader(io.NewSectionReader(f, c.Start, c.End-c.Start))
+
+		if header && i == 0 {
+			if _, err := read(); err != nil {
+				if errors.Is(err, io.EOF) {
+					return nil
+				}
+				return err
+			}
+		}
+
+		for {
+			record, err := read()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("%s bytes %d-%d: %w", path, c.Start, c.End, err)
+			}
+			if !emit(record) {
+				return nil
+			}
+		}
+	})
+}
+
 // FromExcel 从指定的 Excel 文件路径读取数据，并将其以切片的形式发送到通道。
 // 参数:
 //   - path: Excel 文件的路径，字符串类型。
@@ -481,12 +654,21 @@ func FromExcel(path string) func(sheet string, header bool) (chan []string, chan
 	}
 }
 
-type ftype struct {
-	t reflect.Value
-	n int
+// fromErr 返回只包含一个错误的数据通道和错误通道
+func fromErr[T any](err error) (chan T, chan error) {
+	ch := make(chan T)
+	errs := make(chan error, 1)
+	errs <- err
+	close(ch)
+	close(errs)
+	return ch, errs
 }
 
-// FromMysqlQuery 从 MySQL 数据库中执行查询并返回数据通道。
+// FromMysql 从 MySQL 数据库中执行查询并返回数据通道。
+// 列按 mysql 标签映射到结构体字段，没有标签时使用字段名，见 db.NewStructScanner。
+// 支持 NULL 写入指针和 sql.Null* 字段、按 DSN 中 loc 参数解析 time.Time、
+// JSON 列解析到嵌套结构体或 json.RawMessage、实现 sql.Scanner 的类型以及嵌入结构体。
+// 连接通过 db.DefaultRegistry 按 DSN 共享，已有连接时使用 FromMysqlDB。
 // 参数:
 //
 //   - query: *query.SQLBuilder - 查询语句
@@ -499,7 +681,30 @@ func FromMysql[T any](con string) func(query *query.SQLBuilder) (chan T, chan er
 
 	return func(query *query.SQLBuilder) (chan T, chan error) {
 
-		query_ := query.Build()
+		m, err := db.DefaultRegistry.Mysql(con)
+		if err != nil {
+			return fromErr[T](err)
+		}
+
+		return FromMysqlDB[T](m)(query)
+	}
+}
+
+// FromMysqlDB 与 FromMysql 相同，使用已有的连接，读取结束后不关闭连接。
+// 参数:
+//
+//   - m: *db.MysqlDB - MySQL 连接，可以通过 db.NewMysqlDB 或 db.Registry 获取
+//
+// 返回:
+//
+//   - 一个函数，接受查询语句，返回数据通道和错误通道
+func FromMysqlDB[T any](m *db.MysqlDB) func(query *query.SQLBuilder) (chan T, chan error) {
+
+	d := query.MySQL
+
+	return func(query *query.SQLBuilder) (chan T, chan error) {
+
+		query_, args := query.BuildArgsFor(d)
 
 		ch := make(chan T, bufferSize)
 		errs := make(chan error, 1)
@@ -509,18 +714,12 @@ func FromMysql[T any](con string) func(query *query.SQLBuilder) (chan T, chan er
 			defer close(ch)
 			defer close(errs)
 
-			con, err := sql.Open("mysql", con)
-			if err != nil {
-				errs <- err
-				return
-			}
-			defer con.Close()
-
-			rows, err := con.Query(query_)
+			rows, err := m.Con.Query(query_, args...)
 			if err != nil {
 				errs <- err
 				return
 			}
+			defer rows.Close()
 
 			columns, err := rows.Columns()
 			if err != nil {
@@ -528,43 +727,21 @@ func FromMysql[T any](con string) func(query *query.SQLBuilder) (chan T, chan er
 				return
 			}
 
-			columnValues := make([]interface{}, len(columns))
-			for i := range columnValues {
-				columnValues[i] = new(sql.RawBytes)
-			}
-
-			instance := new(T)
-			v := reflect.ValueOf(instance).Elem()
-			fieldMap := make(map[string]ftype, len(columns))
-			t := reflect.TypeOf(instance).Elem()
-			for i := 0; i < t.NumField(); i++ {
-				field := t.Field(i)
-				if tag, ok := field.Tag.Lookup("mysql"); ok {
-					var tmp ftype
-					tmp.t = v.Field(i)
-					tmp.n = fieldType(tmp.t)
-					fieldMap[tag] = tmp
-				}
-			}
+			scanner := db.NewStructScanner(reflect.TypeOf((*T)(nil)).Elem(), "mysql", columns, m.Loc)
 
 			for rows.Next() {
-				if err := rows.Scan(columnValues...); err != nil {
+				instance := new(T)
+				if err := scanner.Scan(rows, instance); err != nil {
 					errs <- err
 					return
 				}
 
-				for i, column := range columns {
-					if field, ok := fieldMap[column]; ok {
-						rawBytes := columnValues[i].(*sql.RawBytes)
-						if err := convertToGoType(field, *rawBytes); err != nil {
-							errs <- err
-							return
-						}
-					}
-				}
-
 				ch <- *instance
 			}
+
+			if err := rows.Err(); err != nil {
+				errs <- err
+			}
 		}()
 
 		return ch, errs
@@ -572,6 +749,7 @@ func FromMysql[T any](con string) func(query *query.SQLBuilder) (chan T, chan er
 }
 
 // FromCK 从 ClickHouse 数据库中执行查询并返回数据通道。
+// 连接通过 db.DefaultRegistry 共享，已有连接时使用 FromCKConn。
 // 参数:
 //
 //   - query: *query.SQLBuilder - 查询语句
@@ -584,7 +762,30 @@ func FromCK[T any](ck *db.CKinfo) func(query *query.SQLBuilder) (chan T, chan er
 
 	return func(query *query.SQLBuilder) (chan T, chan error) {
 
-		query_ := query.Build()
+		con, err := db.DefaultRegistry.CKConn(ck)
+		if err != nil {
+			return fromErr[T](err)
+		}
+
+		return FromCKConn[T](con)(query)
+	}
+}
+
+// FromCKConn 与 FromCK 相同，使用已有的原生连接，读取结束后不关闭连接。
+// 参数:
+//
+//   - con: driver.Conn - ClickHouse 原生连接，可以通过 db.NewCKLoc 或 db.Registry.CKConn 获取
+//
+// 返回:
+//
+//   - 一个函数，接受查询语句，返回数据通道和错误通道
+func FromCKConn[T any](con driver.Conn) func(query *query.SQLBuilder) (chan T, chan error) {
+
+	d := query.ClickHouse
+
+	return func(query *query.SQLBuilder) (chan T, chan error) {
+
+		query_, args := query.BuildArgsFor(d)
 
 		ch := make(chan T, bufferSize)
 		errs := make(chan error, 1)
@@ -594,19 +795,14 @@ func FromCK[T any](ck *db.CKinfo) func(query *query.SQLBuilder) (chan T, chan er
 			defer close(ch)
 			defer close(errs)
 
-			con, err := db.NewCKLoc(ck)
-			if err != nil {
-				errs <- err
-				return
-			}
-			defer con.Close()
-
-			rows, err := con.Query(context.Background(), query_)
+			rows, err := con.Query(context.Background(), query_, args...)
 
 			if err != nil {
 				errs <- err
 				return
 			}
+			defer rows.Close()
+
 			for rows.Next() {
 				var instance T
 				if err := rows.ScanStruct(&instance); err != nil {
@@ -616,69 +812,17 @@ func FromCK[T any](ck *db.CKinfo) func(query *query.SQLBuilder) (chan T, chan er
 				ch <- instance
 			}
 
+			if err := rows.Err(); err != nil {
+				errs <- err
+			}
 		}()
 
 		return ch, errs
 	}
 }
 
-func fieldType(field reflect.Value) int {
-
-	switch field.Kind() {
-	case reflect.String:
-		return 1
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		return 2
-	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		return 3
-	case reflect.Float32, reflect.Float64:
-		return 4
-	case reflect.Bool:
-		return 5
-	default:
-		return 0
-	}
-}
-
-// Converts raw database bytes to Go native types, handling NULL values and missing fields.
-func convertToGoType(field ftype, value []byte) error {
-
-	switch field.n {
-	case 1:
-		field.t.SetString(string(value))
-	case 2:
-		intValue, err := strconv.ParseInt(string(value), 10, 64)
-		if err != nil {
-			return err
-		}
-		field.t.SetInt(intValue)
-	case 3:
-		intValue, err := strconv.ParseUint(string(value), 10, 64)
-		if err != nil {
-			return err
-		}
-		field.t.SetUint(intValue)
-	case 4:
-		intValue, err := strconv.ParseFloat(string(value), 64)
-		if err != nil {
-			return err
-		}
-		field.t.SetFloat(intValue)
-	case 5:
-		intValue, err := strconv.ParseBool(string(value))
-		if err != nil {
-			return err
-		}
-		field.t.SetBool(intValue)
-	default:
-		return errors.New("unknown field type")
-	}
-
-	return nil
-}
-
 // FromMysqlStr 从 MySQL 数据库中执行查询并返回数据通道，
-// 使用 SQL 查询字符串。
+// 使用 SQL 查询字符串。连接通过 db.DefaultRegistry 按 DSN 共享。
 //
 //	参数:
 //
@@ -692,13 +836,18 @@ func FromMysqlStr(con string) func(query *query.SQLBuilder) (chan []string, chan
 
 	return func(query *query.SQLBuilder) (chan []string, chan error) {
 
-		return db.NewMysqlDB(con).QueryIter(query)()
+		m, err := db.DefaultRegistry.Mysql(con)
+		if err != nil {
+			return fromErr[[]string](err)
+		}
+
+		return m.QueryIter(query)()
 
 	}
 }
 
 // FromCKStr 从 ClickHouse 数据库中执行查询并返回数据通道。
-// 使用 SQL 查询字符串。
+// 使用 SQL 查询字符串。连接通过 db.DefaultRegistry 共享。
 //
 //	参数:
 //
@@ -712,7 +861,29 @@ func FromCKStr(ck *db.CKinfo) func(query *query.SQLBuilder) (chan []string, chan
 
 	return func(query *query.SQLBuilder) (chan []string, chan error) {
 
-		return db.NewCK(ck).QueryIter(query)()
+		c, err := db.DefaultRegistry.CK(ck)
+		if err != nil {
+			return fromErr[[]string](err)
+		}
+
+		return c.QueryIter(query)()
+	}
+}
+
+// FromDBStr 与 FromMysqlStr、FromCKStr 相同，使用已有的连接，如 &m.DB。
+// 通过 db.NewMysqlDB、db.NewCK 创建的非共享连接在读取结束后会被关闭，与 DB.QueryIter 一致。
+//
+//	参数:
+//
+//	- m - *db.DB 数据库连接。
+//
+// 返回:
+//
+//   - 一个函数，接受查询语句，返回数据通道和错误通道
+func FromDBStr(m *db.DB) func(query *query.SQLBuilder) (chan []string, chan error) {
+
+	return func(query *query.SQLBuilder) (chan []string, chan error) {
+		return m.QueryIter(query)()
 	}
 }
 
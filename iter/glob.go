@@ -0,0 +1,320 @@
+package iter
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/frankill/gotools/file"
+)
+
+// FileRecord 带来源信息的记录
+type FileRecord[T any] struct {
+	File string // 来源文件路径
+	Line int    // 记录在文件中的起始行号，从 1 开始
+	Data T
+}
+
+// GlobField 多文件读取配置
+type GlobField struct {
+	Pattern  string
+	Parallel int
+	Ordered  bool
+	SkipErr  bool
+	Encoding string // 文件编码，为空时视为 UTF-8，见 file.NewDecodeReader
+}
+
+// G 多文件读取配置，pattern 为 filepath.Glob 支持的模式，如 logs/2024-*/part-*.csv.gz
+func G(pattern string) *GlobField {
+
+	return &GlobField{
+		Pattern:  pattern,
+		Parallel: 4,
+		Ordered:  false,
+		SkipErr:  false,
+		Encoding: file.UTF8,
+	}
+}
+
+// SetParallel 设置同时读取的文件数
+func (g *GlobField) SetParallel(parallel int) *GlobField {
+	g.Parallel = parallel
+
+	return g
+}
+
+// SetOrdered 设置是否按文件名顺序输出，为 false 时各文件记录交错输出
+func (g *GlobField) SetOrdered(ordered bool) *GlobField {
+	g.Ordered = ordered
+
+	return g
+}
+
+// SetSkipErr 设置文件读取失败时的策略，true 跳过该文件并将错误写入错误通道，false 终止全部读取
+func (g *GlobField) SetSkipErr(skip bool) *GlobField {
+	g.SkipErr = skip
+
+	return g
+}
+
+// SetEncoding 设置文件编码，如 file.GBK、file.Auto
+func (g *GlobField) SetEncoding(enc string) *GlobField {
+	g.Encoding = enc
+
+	return g
+}
+
+// Files 返回匹配的文件列表，按文件名排序
+func (g *GlobField) Files() ([]string, error) {
+	files, err := filepath.Glob(g.Pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]string, 0, len(files))
+	for _, f := range files {
+		if !file.IsDir(f) {
+			res = append(res, f)
+		}
+	}
+	return res, nil
+}
+
+// fromGlob 并发读取匹配的文件，read 负责解析单个文件并通过 emit 发送记录，emit 返回 false 时应停止读取
+func fromGlob[T any](g *GlobField, read func(path string, emit func(FileRecord[T]) bool) error) (chan FileRecord[T], chan error) {
+
+	files, err := g.Files()
+	if err != nil {
+		ch := make(chan FileRecord[T])
+		errs := make(chan error, 1)
+		errs <- err
+		close(ch)
+		close(errs)
+		return ch, errs
+	}
+
+	return fanIn(len(files), g.Parallel, g.Ordered, g.SkipErr, func(i int, emit func(FileRecord[T]) bool) error {
+		if err := read(files[i], emit); err != nil {
+			return fmt.Errorf("%s: %w", files[i], err)
+		}
+		return nil
+	})
+}
+
+// FromGlobTxt 从匹配的多个文本文件中并发读取数据，.gz 文件自动解压
+// 参数:
+//
+//   - g - 多文件读取配置
+//   - skip - 每个文件跳过的行数
+//
+// 返回:
+//
+//   - 一个通道，用于接收带文件名和行号的数据
+//   - 一个通道，用于接收错误信息
+func FromGlobTxt(g *GlobField) func(skip int) (chan FileRecord[string], chan error) {
+
+	return func(skip int) (chan FileRecord[string], chan error) {
+
+		return fromGlob(g, func(path string, emit func(FileRecord[string]) bool) error {
+
+			f, err := file.OpenEncoding(path, g.Encoding)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			return readTxt(f, path, skip, emit)
+		})
+	}
+}
+
+// FromGlobJson 从匹配的多个 JSON 行文件中并发读取数据，.gz 文件自动解压
+// 参数:
+//
+//   - g - 多文件读取配置
+//   - skip - 每个文件跳过的行数
+//
+// 返回:
+//
+//   - 一个通道，用于接收带文件名和行号的数据
+//   - 一个通道，用于接收错误信息
+func FromGlobJson[T any](g *GlobField) func(skip int) (chan FileRecord[T], chan error) {
+
+	return func(skip int) (chan FileRecord[T], chan error) {
+
+		return fromGlob(g, func(path string, emit func(FileRecord[T]) bool) error {
+
+			f, err := file.OpenEncoding(path, g.Encoding)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			return readJson(f, path, skip, emit)
+		})
+	}
+}
+
+// FromGlobCsv 从匹配的多个 CSV 文件中并发读取数据，.gz 文件自动解压
+// 参数:
+//
+//   - g - 多文件读取配置
+//   - header - 每个文件是否包含表头
+//
+// 返回:
+//
+//   - 一个通道，用于接收带文件名和行号的数据
+//   - 一个通道，用于接收错误信息
+func FromGlobCsv(g *GlobField) func(header bool) (chan FileRecord[[]string], chan error) {
+
+	return func(header bool) (chan FileRecord[[]string], chan error) {
+
+		return fromGlob(g, func(path string, emit func(FileRecord[[]string]) bool) error {
+
+			f, err := file.OpenEncoding(path, g.Encoding)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			return readCsv(f, path, header, emit)
+		})
+	}
+}
+
+// FromGlobTable 从匹配的多个分隔符文件中并发读取数据，.gz 文件自动解压
+// 参数:
+//
+//   - g - 多文件读取配置
+//   - header - 每个文件是否包含表头
+//   - seq - 分隔符
+//   - escape - 转义字符
+//
+// 返回:
+//
+//   - 一个通道，用于接收带文件名和行号的数据
+//   - 一个通道，用于接收错误信息
+func FromGlobTable(g *GlobField) func(header bool, seq string, escape byte) (chan FileRecord[[]string], chan error) {
+
+	return func(header bool, seq string, escape byte) (chan FileRecord[[]string], chan error) {
+
+		return fromGlob(g, func(path string, emit func(FileRecord[[]string]) bool) error {
+
+			f, err := file.OpenEncoding(path, g.Encoding)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			return readTable(f, path, header, seq, escape, emit)
+		})
+	}
+}
+
+// readTxt 逐行读取 r 中的文本，name 用于标记记录来源
+func readTxt(r io.Reader, name string, skip int, emit func(FileRecord[string]) bool) error {
+
+	scanner := bufio.NewScanner(r)
+
+	line := 0
+	for i := 0; i < skip && scanner.Scan(); i++ {
+		line++
+	}
+
+	for scanner.Scan() {
+		line++
+		if !emit(FileRecord[string]{File: name, Line: line, Data: scanner.Text()}) {
+			return nil
+		}
+	}
+
+	return scanner.Err()
+}
+
+// readJson 逐行解析 r 中的 JSON 数据
+func readJson[T any](r io.Reader, name string, skip int, emit func(FileRecord[T]) bool) error {
+
+	scanner := bufio.NewScanner(r)
+
+	line := 0
+	for i := 0; i < skip && scanner.Scan(); i++ {
+		line++
+	}
+
+	for scanner.Scan() {
+		line++
+		var t T
+		if err := json.Unmarshal(scanner.Bytes(), &t); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		if !emit(FileRecord[T]{File: name, Line: line, Data: t}) {
+			return nil
+		}
+	}
+
+	return scanner.Err()
+}
+
+// readCsv 使用 encoding/csv 解析 r 中的数据
+func readCsv(r io.Reader, name string, header bool, emit func(FileRecord[[]string]) bool) error {
+
+	reader := csv.NewReader(r)
+
+	if header {
+		if _, err := reader.Read(); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+	}
+
+	for {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		line, _ := reader.FieldPos(0)
+		if !emit(FileRecord[[]string]{File: name, Line: line, Data: row}) {
+			return nil
+		}
+	}
+}
+
+// readTable 使用 file.Reader 解析 r 中的分隔符数据
+func readTable(r io.Reader, name string, header bool, seq string, escape byte, emit func(FileRecord[[]string]) bool) error {
+
+	reader := file.NewReader(r, seq, escape)
+
+	if header {
+		if _, err := reader.Read(); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+	}
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		line, _ := reader.FieldPos(0)
+		if !emit(FileRecord[[]string]{File: name, Line: line, Data: record}) {
+			return nil
+		}
+	}
+}
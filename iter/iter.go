@@ -1,7 +1,6 @@
 package iter
 
 import (
-	"log"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -612,7 +611,8 @@ func Slider[T, U any](f func(x ...T) U, before, after int, defaultValue T) func(
 	}
 }
 
-// Sort 针对数据较大的情况进行处理，使用了外部文件排序，如果内存满足请使用SortSimple
+// Sort 针对数据较大的情况进行处理，使用了外部文件排序，如果内存满足请使用SortSimple。
+// 排序过程中的错误只记录日志，需要获取错误时请使用 SortErr
 // 参数:
 //   - f: 一个函数，接受两个类型为 T 和 U 的值，返回一个布尔值，表示是否满足排序条件。
 //     当 `fun(x, y)` 返回 `true`，则在排序时 `x` 应位于 `y` 之前。
@@ -627,17 +627,51 @@ func Slider[T, U any](f func(x ...T) U, before, after int, defaultValue T) func(
 func Sort[T any](f func(x, y T) bool) func(ch chan T) chan T {
 
 	return func(ch chan T) chan T {
+
+		res, errs := SortErr(f)(ch)
+		go ErrorCH(errs)
+
+		return res
+	}
+
+}
+
+// SortErr 与 Sort 相同，使用外部文件排序，但返回排序过程中的错误。
+// 写入临时文件失败时剩余的输入会被丢弃，返回的数据通道直接关闭；读取临时文件失败时数据可能不完整。
+// 参数:
+//   - f: 一个函数，接受两个类型为 T 和 U 的值，返回一个布尔值，表示是否满足排序条件。
+//     当 `fun(x, y)` 返回 `true`，则在排序时 `x` 应位于 `y` 之前。
+//   - ch: 一个通道，用于接收数据。
+//
+// 返回:
+//   - 一个通道，用于接收排序后的数据。
+//   - 一个通道，数据通道关闭后用于接收错误信息。
+func SortErr[T any](f func(x, y T) bool) func(ch chan T) (chan T, chan error) {
+
+	return func(ch chan T) (chan T, chan error) {
 		ch_ := Window(ch)(sortWindowSize)
 		num := 0
 		file := []string{}
 
-		tmp := make(chan T)
-		close(tmp)
+		errs := make(chan error, 1)
+
+		fail := func(err error) (chan T, chan error) {
+			// 丢弃剩余的输入，避免上游阻塞
+			for range ch_ {
+			}
+
+			tmp := make(chan T)
+			close(tmp)
+
+			errs <- err
+			close(errs)
+
+			return tmp, errs
+		}
 
 		p, err := os.MkdirTemp("", "t-*")
 		if err != nil {
-			log.Println(err)
-			return tmp
+			return fail(err)
 		}
 
 		for v := range ch_ {
@@ -649,23 +683,44 @@ func Sort[T any](f func(x, y T) bool) func(ch chan T) chan T {
 
 			err = ToGob[T](fn, true)(FromArray(v))
 			if err != nil {
-				log.Println(err)
-				return tmp
+				os.RemoveAll(p)
+				return fail(err)
 			}
 			num++
 		}
 
-		fs := array.Map(func(x string) chan T {
+		gobErrs := make([]chan error, len(file))
+		fs := make([]chan T, len(file))
+		for i, fn := range file {
+			fs[i], gobErrs[i] = FromGob[T](fn, true)
+		}
 
-			c, errs := FromGob[T](x, true)
-			go ErrorCH(errs)
+		merged := Merge(f)(fs...)
+		res := make(chan T, bufferSize)
 
-			return c
+		go func() {
+			defer close(errs)
+			defer os.RemoveAll(p)
+			defer close(res)
 
-		}, file)
+			for v := range merged {
+				res <- v
+			}
 
-		return Merge(f)(fs...)
+			var first error
+			for _, e := range gobErrs {
+				for err := range e {
+					if first == nil {
+						first = err
+					}
+				}
+			}
+			if first != nil {
+				errs <- first
+			}
+		}()
 
+		return res, errs
 	}
 
 }
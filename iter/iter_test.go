@@ -1,14 +1,30 @@
 package iter_test
 
 import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"os"
+	"path/filepath"
 	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/frankill/gotools"
 	"github.com/frankill/gotools/array"
+	"github.com/frankill/gotools/db"
+	"github.com/frankill/gotools/file"
 	"github.com/frankill/gotools/iter"
+	"github.com/frankill/gotools/query"
 )
 
 // TestFormArray 测试 FormArray 函数的正确性。
@@ -716,3 +732,1022 @@ func TestMerge(t *testing.T) {
 func TestPipe(t *testing.T) {
 
 }
+
+func TestFromGlobTxt(t *testing.T) {
+	dir := t.TempDir()
+
+	for i, data := range []string{"a\nb\n", "c\n", "d\ne\nf\n"} {
+		if err := os.WriteFile(fmt.Sprintf("%s/part-%d.txt", dir, i), []byte(data), 0644); err != nil {
+			t.Fatalf("Failed to write test file: %v", err)
+		}
+	}
+
+	ch, errs := iter.FromGlobTxt(iter.G(dir + "/part-*.txt").SetParallel(2).SetOrdered(true))(0)
+
+	result := iter.Collect(ch)
+	for err := range errs {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	data := make([]string, len(result))
+	for i, r := range result {
+		data[i] = r.Data
+	}
+
+	expected := []string{"a", "b", "c", "d", "e", "f"}
+	if !reflect.DeepEqual(data, expected) {
+		t.Errorf("Expected %v, got %v", expected, data)
+	}
+
+	if result[4].Line != 2 || result[4].File != dir+"/part-2.txt" {
+		t.Errorf("Expected part-2.txt line 2, got %s line %d", result[4].File, result[4].Line)
+	}
+}
+
+func TestFromTail(t *testing.T) {
+	path := t.TempDir() + "/app.log"
+	if err := os.WriteFile(path, []byte("skip\na\nb"), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch, _ := iter.FromTail(iter.Tail(path).SetInterval(10*time.Millisecond))(ctx, 1)
+
+	if v := <-ch; v != "a" {
+		t.Fatalf("Expected a, got %s", v)
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	f.WriteString("c\n")
+	f.Close()
+
+	if v := <-ch; v != "bc" {
+		t.Fatalf("Expected bc, got %s", v)
+	}
+
+	// 模拟日志轮转
+	os.Rename(path, path+".1")
+	os.WriteFile(path, []byte("d\n"), 0644)
+
+	if v := <-ch; v != "d" {
+		t.Fatalf("Expected d, got %s", v)
+	}
+
+	cancel()
+	for range ch {
+	}
+}
+
+func TestFromTailRotateWithoutNewline(t *testing.T) {
+	path := t.TempDir() + "/app.log"
+	if err := os.WriteFile(path, []byte("a\nb"), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch, _ := iter.FromTail(iter.Tail(path).SetInterval(10*time.Millisecond))(ctx, 0)
+
+	if v := <-ch; v != "a" {
+		t.Fatalf("Expected a, got %s", v)
+	}
+
+	// 旧文件最后一行 b 没有换行符
+	os.Rename(path, path+".1")
+	os.WriteFile(path, []byte("c\n"), 0644)
+
+	if v := <-ch; v != "b" {
+		t.Fatalf("Expected b, got %s", v)
+	}
+	if v := <-ch; v != "c" {
+		t.Fatalf("Expected c, got %s", v)
+	}
+
+	cancel()
+	for range ch {
+	}
+}
+
+func TestFromNdjson(t *testing.T) {
+	path := t.TempDir() + "/data.ndjson"
+	data := `{"id":1,"level":"info","user":{"name":"a"}}
+{"id":2,"level":"debug"}
+not json
+{"id":3.5,"level":"info"}
+{"level":"warn","user":{"name":"b/c"}}
+`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	schema, err := iter.ParseJsonSchema([]byte(`{
+		"type": "object",
+		"required": ["id", "level"],
+		"properties": {
+			"id": {"type": "integer", "minimum": 1},
+			"level": {"enum": ["info", "warn", "error"]}
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("Failed to parse schema: %v", err)
+	}
+
+	var lines []int
+	ch, errs := iter.FromNdjson[map[string]any](path, schema, func(err *iter.LineError) {
+		lines = append(lines, err.Line)
+	})(0)
+
+	// 错误行通过错误通道报告，读取继续
+	var errLines []int
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for err := range errs {
+			var le *iter.LineError
+			if !errors.As(err, &le) {
+				t.Errorf("Expected *LineError, got %v", err)
+				continue
+			}
+			errLines = append(errLines, le.Line)
+		}
+	}()
+
+	result := iter.Collect(ch)
+	<-done
+
+	if len(result) != 1 || result[0]["id"] != float64(1) {
+		t.Errorf("Expected only id 1, got %v", result)
+	}
+	if !reflect.DeepEqual(lines, []int{2, 3, 4, 5}) || !reflect.DeepEqual(errLines, lines) {
+		t.Errorf("Expected invalid lines [2 3 4 5], got %v %v", lines, errLines)
+	}
+
+	pch, perrs := iter.FromNdjsonPointer(path, nil, "/id", "/user/name", "/user")(0)
+	var perr []error
+	pdone := make(chan struct{})
+	go func() {
+		defer close(pdone)
+		for err := range perrs {
+			perr = append(perr, err)
+		}
+	}()
+
+	expected := [][]any{
+		{float64(1), "a", map[string]any{"name": "a"}},
+		{float64(2), nil, nil},
+		{3.5, nil, nil},
+		{nil, "b/c", map[string]any{"name": "b/c"}},
+	}
+	if got := iter.Collect(pch); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+	<-pdone
+	if len(perr) != 1 {
+		t.Errorf("Expected 1 invalid line, got %v", perr)
+	}
+}
+
+type avroUser struct {
+	ID    int64  `avro:"id"`
+	Name  string `avro:"name"`
+	Age   *int32 `avro:"age"`
+	Debug string `avro:"-"`
+}
+
+type avroUserV2 struct {
+	ID    int64  `avro:"id"`
+	Name  string `avro:"name"`
+	Email string `avro:"email"`
+}
+
+func TestAvro(t *testing.T) {
+	path := t.TempDir() + "/users.avro"
+
+	age := int32(30)
+	data := []avroUser{{ID: 1, Name: "a", Age: &age}, {ID: 2, Name: "b"}}
+
+	if err := iter.ToAvro[avroUser](iter.Avro(path).SetCodec("snappy"))(iter.FromArray(data)); err != nil {
+		t.Fatalf("ToAvro failed: %v", err)
+	}
+
+	ch, errs := iter.FromAvro[avroUser](path)("")
+	result := iter.Collect(ch)
+	if err := <-errs; err != nil {
+		t.Fatalf("FromAvro failed: %v", err)
+	}
+	if !reflect.DeepEqual(result, data) {
+		t.Errorf("Expected %v, got %v", data, result)
+	}
+
+	// reader schema 新增带默认值的字段，删除 age 字段
+	schema := `{"type":"record","name":"avroUser","fields":[
+		{"name":"id","type":"long"},
+		{"name":"name","type":"string"},
+		{"name":"email","type":"string","default":"n/a"}]}`
+
+	ch2, errs2 := iter.FromAvro[avroUserV2](path)(schema)
+	result2 := iter.Collect(ch2)
+	if err := <-errs2; err != nil {
+		t.Fatalf("FromAvro with reader schema failed: %v", err)
+	}
+
+	expected := []avroUserV2{{ID: 1, Name: "a", Email: "n/a"}, {ID: 2, Name: "b", Email: "n/a"}}
+	if !reflect.DeepEqual(result2, expected) {
+		t.Errorf("Expected %v, got %v", expected, result2)
+	}
+
+	// 不同的匿名结构体使用字段路径命名，相同的匿名结构体引用已定义的名称
+	type point struct{ X, Y int32 }
+	type shape struct {
+		From point
+		To   point
+		Meta struct{ Tag string }
+		Tags []struct{ Key, Value string }
+		More struct{ Tag string }
+	}
+
+	s, err := iter.AvroSchema[shape]()
+	if err != nil {
+		t.Fatalf("AvroSchema failed: %v", err)
+	}
+	for _, want := range []string{`"name":"point"`, `"type":"point"`, `"name":"record_Meta"`, `"name":"record_Tags_item"`, `"type":"record_Meta"`} {
+		if !strings.Contains(s, want) {
+			t.Errorf("Schema missing %s: %s", want, s)
+		}
+	}
+
+	shapes := []shape{{From: point{1, 2}, To: point{3, 4}, Tags: []struct{ Key, Value string }{{"k", "v"}}}}
+	shapePath := t.TempDir() + "/shapes.avro"
+	if err := iter.ToAvro[shape](iter.Avro(shapePath))(iter.FromArray(shapes)); err != nil {
+		t.Fatalf("ToAvro nested failed: %v", err)
+	}
+	ch3, errs3 := iter.FromAvro[shape](shapePath)("")
+	if result := iter.Collect(ch3); !reflect.DeepEqual(result, shapes) {
+		t.Errorf("Expected %v, got %v", shapes, result)
+	}
+	if err := <-errs3; err != nil {
+		t.Fatalf("FromAvro nested failed: %v", err)
+	}
+}
+
+func TestZipArchive(t *testing.T) {
+	path := t.TempDir() + "/drop.zip"
+
+	ch := iter.FromArray([]iter.FileRecord[[]string]{
+		{File: "2024/a.csv", Data: []string{"1", "x"}},
+		{File: "2024/b.csv", Data: []string{"2", "y"}},
+		{File: "2024/a.csv", Data: []string{"3", "z"}},
+		{File: "readme.txt", Data: []string{"skip"}},
+	})
+
+	if err := iter.ToZip(path, "id", "name")(ch); err != nil {
+		t.Fatalf("ToZip failed: %v", err)
+	}
+
+	// 临时文件写在输出目录中，结束后应被清理
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("Expected only the zip file in output dir, got %d entries", len(entries))
+	}
+
+	res, errs := iter.FromArchiveCsv(iter.Archive(path).SetPattern("*.csv"))(true)
+	result := iter.Collect(res)
+	if err := <-errs; err != nil {
+		t.Fatalf("FromArchiveCsv failed: %v", err)
+	}
+
+	expected := []iter.FileRecord[[]string]{
+		{File: "2024/a.csv", Line: 2, Data: []string{"1", "x"}},
+		{File: "2024/a.csv", Line: 3, Data: []string{"3", "z"}},
+		{File: "2024/b.csv", Line: 2, Data: []string{"2", "y"}},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+
+	// 成员数超过同时打开的文件数上限时交错写入
+	var many []iter.FileRecord[[]string]
+	for round := 0; round < 2; round++ {
+		for i := 0; i < 100; i++ {
+			many = append(many, iter.FileRecord[[]string]{File: fmt.Sprintf("m%03d.csv", i), Data: []string{fmt.Sprint(round)}})
+		}
+	}
+	if err := iter.ToZip(path)(iter.FromArray(many)); err != nil {
+		t.Fatalf("ToZip with many members failed: %v", err)
+	}
+	res, errs = iter.FromArchiveCsv(iter.Archive(path))(false)
+	counts := map[string]string{}
+	for r := range res {
+		counts[r.File] += r.Data[0]
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("FromArchiveCsv failed: %v", err)
+	}
+	if len(counts) != 100 || counts["m000.csv"] != "01" || counts["m099.csv"] != "01" {
+		t.Errorf("Unexpected members %d %v", len(counts), counts["m000.csv"])
+	}
+}
+
+func TestCsvEncoding(t *testing.T) {
+	dir := t.TempDir()
+	data := [][]string{{"1", "张三"}, {"2", "北京市"}}
+
+	for _, tc := range []struct {
+		enc string
+		bom bool
+	}{
+		{file.GBK, false},
+		{file.GB18030, true},
+		{file.UTF16LE, true},
+		{file.UTF8, true},
+	} {
+		path := dir + "/" + tc.enc + ".csv"
+		if err := iter.ToTable(iter.T(path).SetEncoding(tc.enc, tc.bom).SetHeader("id", "名称"))(iter.FromArray(data)); err != nil {
+			t.Fatalf("%s: ToTable failed: %v", tc.enc, err)
+		}
+
+		ch, errs := iter.FromTableT(iter.T(path).SetEncoding(file.Auto, false))(true)
+		result := iter.Collect(ch)
+		if err := <-errs; err != nil {
+			t.Fatalf("%s: FromTableT failed: %v", tc.enc, err)
+		}
+		if !reflect.DeepEqual(result, data) {
+			t.Errorf("%s: Expected %v, got %v", tc.enc, data, result)
+		}
+	}
+}
+
+func TestTextEncoding(t *testing.T) {
+	dir := t.TempDir()
+	lines := []string{"张三", "北京市"}
+
+	gz := dir + "/gbk.txt.gz"
+	if err := iter.ToGzipT(iter.T(gz).SetEncoding(file.GBK, false))(iter.FromArray(lines)); err != nil {
+		t.Fatalf("ToGzipT failed: %v", err)
+	}
+	ch, errs := iter.FromGzipT(iter.T(gz).SetEncoding(file.Auto, false))(0)
+	if result := iter.Collect(ch); !reflect.DeepEqual(result, lines) {
+		t.Errorf("Expected %v, got %v", lines, result)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("FromGzipT failed: %v", err)
+	}
+
+	type row struct {
+		Name string `json:"name"`
+	}
+	rows := []row{{"张三"}, {"北京市"}}
+
+	js := dir + "/utf16.json"
+	if err := iter.ToJsonT[row](iter.T(js).SetEncoding(file.UTF16LE, true))(iter.FromArray(rows)); err != nil {
+		t.Fatalf("ToJsonT failed: %v", err)
+	}
+	jch, jerrs := iter.FromJsonT[row](iter.T(js).SetEncoding(file.Auto, false))(0)
+	if result := iter.Collect(jch); !reflect.DeepEqual(result, rows) {
+		t.Errorf("Expected %v, got %v", rows, result)
+	}
+	if err := <-jerrs; err != nil {
+		t.Fatalf("FromJsonT failed: %v", err)
+	}
+
+	log := dir + "/gbk.log"
+	if err := iter.ToTxtT(iter.T(log).SetEncoding(file.GBK, false))(iter.FromArray(lines)); err != nil {
+		t.Fatalf("ToTxtT failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tch, _ := iter.FromTail(iter.Tail(log).SetEncoding(file.GBK).SetInterval(10*time.Millisecond))(ctx, 0)
+	for _, want := range lines {
+		if v := <-tch; v != want {
+			t.Errorf("Expected %s, got %s", want, v)
+		}
+	}
+	cancel()
+	for range tch {
+	}
+
+	_, terrs := iter.FromTail(iter.Tail(log).SetEncoding(file.UTF16LE))(context.Background(), 0)
+	if err := <-terrs; err == nil {
+		t.Errorf("Expected unsupported encoding error for tail")
+	}
+}
+
+func TestFromTableT(t *testing.T) {
+	path := t.TempDir() + "/big.txt"
+
+	var data [][]string
+	for i := 0; i < 500; i++ {
+		data = append(data, []string{fmt.Sprint(i), fmt.Sprintf("line\n%d||\"quoted\"", i), "x"})
+	}
+
+	cfg := iter.T(path).SetSeq("||").SetEscape('\\')
+	if err := iter.ToTable(cfg)(iter.FromArray(data)); err != nil {
+		t.Fatalf("ToTable failed: %v", err)
+	}
+
+	ch, errs := iter.FromTableT(cfg.SetParallel(4, true))(false)
+	result := iter.Collect(ch)
+	for err := range errs {
+		t.Fatalf("FromTableT failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(result, data) {
+		t.Errorf("Expected %d ordered rows, got %d", len(data), len(result))
+	}
+
+	ch, errs = iter.FromTableT(cfg.SetParallel(3, false))(true)
+	go iter.ErrorCH(errs)
+	if n := iter.Count(ch); n != len(data)-1 {
+		t.Errorf("Expected %d rows, got %d", len(data)-1, n)
+	}
+
+	// 默认配置按 CSV 顺序读取
+	csvPath := t.TempDir() + "/big.csv"
+	if err := iter.ToCsv(csvPath, false)(iter.FromArray(data)); err != nil {
+		t.Fatalf("ToCsv failed: %v", err)
+	}
+	for _, parallel := range []int{1, 4} {
+		ch, errs = iter.FromTableT(iter.T(csvPath).SetParallel(parallel, true))(false)
+		if result := iter.Collect(ch); !reflect.DeepEqual(result, data) {
+			t.Errorf("parallel %d: Expected %d ordered rows, got %d", parallel, len(data), len(result))
+		}
+		if err := <-errs; err != nil {
+			t.Fatalf("FromTableT failed: %v", err)
+		}
+	}
+}
+
+func TestToPartition(t *testing.T) {
+	dir := t.TempDir()
+
+	var data [][]string
+	for i := 0; i < 30; i++ {
+		data = append(data, []string{fmt.Sprint(i), []string{"east", "west", "north"}[i%3], "2024-05-01"})
+	}
+
+	p := file.NewPartitionWriter(dir).SetExt(".csv.gz").SetHeader("id", "region", "dt").SetMaxOpen(2).SetRoll(4, 0)
+	if err := iter.ToPartition(p, file.ColumnPartition([]string{"dt", "region"}, 2, 1))(iter.FromArray(data)); err != nil {
+		t.Fatalf("ToPartition failed: %v", err)
+	}
+
+	// 每个分区 10 行，每 4 行滚动一次，共 3 个分区 x 3 个文件
+	if n := len(p.Files()); n != 9 {
+		t.Fatalf("Expected 9 files, got %d: %v", n, p.Files())
+	}
+
+	ch, errs := iter.FromGlobCsv(iter.G(dir + "/dt=2024-05-01/region=east/part-*.csv.gz").SetOrdered(true))(true)
+	var ids []string
+	for r := range ch {
+		ids = append(ids, r.Data[0])
+	}
+	for err := range errs {
+		t.Fatalf("FromGlobCsv failed: %v", err)
+	}
+
+	expected := []string{"0", "3", "6", "9", "12", "15", "18", "21", "24", "27"}
+	if !reflect.DeepEqual(ids, expected) {
+		t.Errorf("Expected %v, got %v", expected, ids)
+	}
+
+	// 分区路径不能离开输出目录，分区值中的 .. 和 / 会被转义
+	for _, bad := range []string{"../escape", "a/../../b", "/abs", `..\b`} {
+		if err := p.Write(bad, []string{"1"}); err == nil {
+			t.Errorf("Expected error for partition %q", bad)
+		}
+	}
+	if part := file.HivePartition([]string{"dt"}, []string{"../x"}); part != "dt=..%2Fx" {
+		t.Errorf("Unexpected hive partition %s", part)
+	}
+	if err := p.Close(); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+}
+
+func TestSplitter(t *testing.T) {
+	dir := t.TempDir()
+	path := dir + "/data.csv.gz"
+
+	data := [][]string{{"id", "text"}}
+	for i := 0; i < 25; i++ {
+		data = append(data, []string{fmt.Sprint(i), fmt.Sprintf("multi\nline, %d", i)})
+	}
+
+	if err := iter.ToCsv(dir+"/data.csv", false)(iter.FromArray(data)); err != nil {
+		t.Fatalf("ToCsv failed: %v", err)
+	}
+	raw, _ := os.ReadFile(dir + "/data.csv")
+	os.Remove(dir + "/data.csv")
+	f, _ := os.Create(path)
+	gz := gzip.NewWriter(f)
+	gz.Write(raw)
+	gz.Close()
+	f.Close()
+
+	parts, err := file.NewSplitter().SetRows(10).SetTemplate(dir+"/out/{name}-{n:3}.csv.gz").SplitDir(dir, "*.csv.gz", 2)
+	if err != nil {
+		t.Fatalf("SplitDir failed: %v", err)
+	}
+
+	expected := []file.SplitPart{
+		{Path: dir + "/out/data-001.csv.gz", Rows: 10},
+		{Path: dir + "/out/data-002.csv.gz", Rows: 10},
+		{Path: dir + "/out/data-003.csv.gz", Rows: 5},
+	}
+	if !reflect.DeepEqual(parts, expected) {
+		t.Fatalf("Expected %v, got %v", expected, parts)
+	}
+
+	// 多个源文件时模板缺少 {name} 会互相覆盖，应直接报错
+	os.WriteFile(dir+"/other.csv.gz", raw, 0644)
+	if _, err := file.NewSplitter().SetTemplate(dir+"/x/{n}.csv.gz").SplitDir(dir, "*.csv.gz", 2); err == nil {
+		t.Errorf("Expected template error")
+	}
+	os.Remove(dir + "/other.csv.gz")
+
+	ch, errs := iter.FromGlobCsv(iter.G(dir + "/out/*.csv.gz").SetOrdered(true))(true)
+	var result [][]string
+	for r := range ch {
+		result = append(result, r.Data)
+	}
+	for err := range errs {
+		t.Fatalf("FromGlobCsv failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(result, data[1:]) {
+		t.Errorf("Expected %v, got %v", data[1:], result)
+	}
+
+	// 旧接口按原始行拆分，不解析引号，内容逐字节保留
+	tsv := dir + "/legacy.tsv"
+	os.WriteFile(tsv, []byte("id\ttext\n1\tsay \"hi\" there\n2\tb\n3\tc"), 0644)
+	if err := file.SplitFileByLines(tsv, 2, true, false); err != nil {
+		t.Fatalf("SplitFileByLines failed: %v", err)
+	}
+	for name, want := range map[string]string{
+		"legacy_1.tsv": "id\ttext\n1\tsay \"hi\" there\n2\tb\n",
+		"legacy_2.tsv": "id\ttext\n3\tc",
+	} {
+		if b, _ := os.ReadFile(dir + "/" + name); string(b) != want {
+			t.Errorf("%s: expected %q, got %q", name, want, b)
+		}
+	}
+}
+
+func TestToAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := dir + "/out.csv"
+
+	csvSink := func(p string) func(chan []string) error { return iter.ToCsv(p, false, "id") }
+
+	err := iter.ToAtomic(path, iter.Atomic().SetSuccess(true), csvSink)(iter.FromArray([][]string{{"1"}, {"2"}}))
+	if err != nil {
+		t.Fatalf("ToAtomic failed: %v", err)
+	}
+
+	if b, _ := os.ReadFile(path); string(b) != "id\n1\n2\n" {
+		t.Errorf("Unexpected content %q", b)
+	}
+	if ok, _ := file.IsExists(dir + "/" + file.SuccessMarker); !ok {
+		t.Errorf("Expected %s marker", file.SuccessMarker)
+	}
+
+	// 取消后原文件保持不变，临时文件被删除
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan []string)
+	go func() {
+		ch <- []string{"3"}
+		cancel()
+		time.Sleep(10 * time.Millisecond)
+		ch <- []string{"4"}
+		close(ch)
+	}()
+
+	err = iter.ToAtomic(path, iter.Atomic().SetContext(ctx), csvSink)(ch)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+
+	if b, _ := os.ReadFile(path); string(b) != "id\n1\n2\n" {
+		t.Errorf("Unexpected content after cancel %q", b)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Errorf("Expected only out.csv and marker, got %d entries", len(entries))
+	}
+
+	// 写入失败时同样不会留下文件
+	err = iter.ToAtomic(dir+"/fail.gob", iter.Atomic(), func(p string) func(chan func()) error {
+		return iter.ToGob[func()](p, true)
+	})(iter.FromArray([]func(){func() {}}))
+	if err == nil {
+		t.Fatal("Expected gob encode error")
+	}
+	if ok, _ := file.IsExists(dir + "/fail.gob"); ok {
+		t.Error("fail.gob should not exist")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("Temp file not removed, got %d entries", len(entries))
+	}
+
+	// 带标记的重写失败时，旧的标记文件已被删除
+	err = iter.ToAtomic(dir+"/fail.gob", iter.Atomic().SetSuccess(true), func(p string) func(chan func()) error {
+		return iter.ToGob[func()](p, true)
+	})(iter.FromArray([]func(){func() {}}))
+	if err == nil {
+		t.Fatal("Expected gob encode error")
+	}
+	if ok, _ := file.IsExists(dir + "/" + file.SuccessMarker); ok {
+		t.Errorf("Stale %s marker should be removed", file.SuccessMarker)
+	}
+
+	// 新文件权限为 0644，已有文件保留原权限，配置为 nil 时使用默认配置
+	if err := iter.ToAtomic(dir+"/mode.csv", nil, csvSink)(iter.FromArray([][]string{{"1"}})); err != nil {
+		t.Fatalf("ToAtomic with nil config failed: %v", err)
+	}
+	if info, _ := os.Stat(dir + "/mode.csv"); info.Mode().Perm() != 0644 {
+		t.Errorf("Expected mode 0644, got %v", info.Mode().Perm())
+	}
+	os.Chmod(dir+"/mode.csv", 0640)
+	if err := iter.ToAtomic(dir+"/mode.csv", nil, csvSink)(iter.FromArray([][]string{{"2"}})); err != nil {
+		t.Fatalf("ToAtomic rewrite failed: %v", err)
+	}
+	if info, _ := os.Stat(dir + "/mode.csv"); info.Mode().Perm() != 0640 {
+		t.Errorf("Expected mode 0640, got %v", info.Mode().Perm())
+	}
+}
+
+func TestInferSchema(t *testing.T) {
+	path := t.TempDir() + "/infer.csv"
+
+	data := [][]string{{"id", "price", "ok", "day", "ts", "zip", "region", "note"}}
+	for i := 0; i < 200; i++ {
+		note := fmt.Sprintf("note %d", i)
+		if i%50 == 0 {
+			note = "NULL"
+		}
+		data = append(data, []string{
+			fmt.Sprint(i * 100000000), fmt.Sprintf("%d.5", i), []string{"true", "false"}[i%2],
+			"2024-05-01", "2024-05-01 12:30:00.123", "0" + fmt.Sprint(1000+i),
+			[]string{"east", "west"}[i%2], note,
+		})
+	}
+
+	if err := iter.ToCsv(path, false)(iter.FromArray(data)); err != nil {
+		t.Fatalf("ToCsv failed: %v", err)
+	}
+
+	s, err := file.InferSchema(path, nil)
+	if err != nil {
+		t.Fatalf("InferSchema failed: %v", err)
+	}
+
+	types := make([]string, len(s.Columns))
+	for i, c := range s.Columns {
+		types[i] = c.Type
+	}
+	expected := []string{file.TypeInt, file.TypeFloat, file.TypeBool, file.TypeDate, file.TypeDateTime, file.TypeString, file.TypeString, file.TypeString}
+	if !reflect.DeepEqual(types, expected) {
+		t.Fatalf("Expected %v, got %v", expected, types)
+	}
+
+	if s.Rows != 200 || s.Columns[6].Cardinality != 2 || !s.Columns[7].Nullable || s.Columns[7].MaxLength != 8 {
+		t.Errorf("Unexpected schema %+v", s)
+	}
+
+	mysql := s.MysqlDDL("t")
+	for _, want := range []string{"`id` BIGINT NOT NULL", "`ts` DATETIME(3) NOT NULL", "`zip` VARCHAR(5) NOT NULL", "`note` VARCHAR(8) NULL"} {
+		if !strings.Contains(mysql, want) {
+			t.Errorf("MysqlDDL missing %q:\n%s", want, mysql)
+		}
+	}
+
+	ck := s.CKDDL("t", "day", "id")
+	for _, want := range []string{"`region` LowCardinality(String)", "`note` Nullable(String)", "`ok` Bool", "ORDER BY (`day`, `id`)"} {
+		if !strings.Contains(ck, want) {
+			t.Errorf("CKDDL missing %q:\n%s", want, ck)
+		}
+	}
+
+	for n, want := range map[int]string{255: "VARCHAR(255)", 256: "TEXT", 20000: "MEDIUMTEXT", 5000000: "LONGTEXT"} {
+		if got := (file.ColumnSchema{Type: file.TypeString, MaxLength: n}).MysqlType(); got != want {
+			t.Errorf("MaxLength %d: expected %s, got %s", n, want, got)
+		}
+	}
+
+	col := file.ColumnSchema{Type: file.TypeString, Count: 100, Cardinality: 2, Nullable: true}
+	if got := col.CKType(); got != "LowCardinality(Nullable(String))" {
+		t.Errorf("Expected LowCardinality(Nullable(String)), got %s", got)
+	}
+
+	// NaN、Inf 不按浮点数推断
+	if err := iter.ToCsv(path, false)(iter.FromArray([][]string{{"v"}, {"1.5"}, {"NaN"}, {"Inf"}})); err != nil {
+		t.Fatalf("ToCsv failed: %v", err)
+	}
+	if s, err := file.InferSchema(path, nil); err != nil || s.Columns[0].Type != file.TypeString {
+		t.Errorf("Expected string column for NaN/Inf, got %+v %v", s, err)
+	}
+}
+
+func TestMergeDedupeDiff(t *testing.T) {
+	dir := t.TempDir()
+
+	parts := [][][]string{
+		{{"3", "c", "1"}, {"1", "a", "1"}},
+		{{"2", "b", "1"}, {"1", "a", "2"}},
+	}
+	var srcs []string
+	for i, p := range parts {
+		src := fmt.Sprintf("%s/part-%d.csv", dir, i)
+		if err := iter.ToCsv(src, false, "id", "name", "v")(iter.FromArray(p)); err != nil {
+			t.Fatalf("ToCsv failed: %v", err)
+		}
+		srcs = append(srcs, src)
+	}
+
+	n, err := file.MergeFiles(dir+"/all.csv.gz", srcs, true, ",", '"')
+	if err != nil || n != 4 {
+		t.Fatalf("MergeFiles = %d, %v", n, err)
+	}
+
+	n, err = file.SortDedupeFile(dir+"/all.csv.gz", dir+"/old.csv", true, ",", '"', 0)
+	if err != nil || n != 3 {
+		t.Fatalf("SortDedupeFile = %d, %v", n, err)
+	}
+
+	// 排序稳定，主键重复时保留先出现的行
+	ch, errs := iter.FromCsv(dir + "/old.csv")(true)
+	rows := iter.Collect(iter.Map(func(x []string) string { return strings.Join(x, ",") })(ch))
+	for err := range errs {
+		t.Fatalf("FromCsv failed: %v", err)
+	}
+	if !reflect.DeepEqual(rows, []string{"1,a,1", "2,b,1", "3,c,1"}) {
+		t.Errorf("Expected sorted unique rows, got %v", rows)
+	}
+
+	newData := [][]string{{"4", "d", "1"}, {"2", "b", "9"}, {"1", "a", "1"}, {"1", "a", "2"}}
+	if err := iter.ToCsv(dir+"/new.csv", false, "id", "name", "v")(iter.FromArray(newData)); err != nil {
+		t.Fatalf("ToCsv failed: %v", err)
+	}
+
+	diffs, errs := file.DiffCsv(dir+"/old.csv", dir+"/new.csv", 0)
+	var got []string
+	for d := range diffs {
+		got = append(got, fmt.Sprintf("%s:%s:%v", d.Kind, d.Key[0], d.Columns))
+	}
+	for err := range errs {
+		t.Fatalf("DiffCsv failed: %v", err)
+	}
+
+	expected := []string{"added:1:[]", "changed:2:[v]", "removed:3:[]", "added:4:[]"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+
+	// 外部排序无法创建临时目录时返回错误
+	t.Setenv("TMPDIR", dir+"/missing")
+
+	if _, err := file.SortDedupeFile(dir+"/new.csv", dir+"/out.csv", true, ",", '"', 0); err == nil {
+		t.Error("Expected SortDedupeFile to return the sort error")
+	}
+
+	diffs, errs = file.DiffCsv(dir+"/old.csv", dir+"/new.csv", 0)
+	iter.Count(diffs)
+	if err := <-errs; err == nil {
+		t.Error("Expected DiffCsv to return the sort error")
+	}
+}
+
+func TestFromMysqlErrors(t *testing.T) {
+
+	ch, errs := iter.FromMysql[struct{ ID int }]("not a dsn")(query.NewSQLBuilder().From("t"))
+	for range ch {
+	}
+	if err := <-errs; err == nil {
+		t.Errorf("Expected error from FromMysql")
+	}
+
+	if err := iter.ToMysqlInset("not a dsn", query.NewMysqlInsert("t", false, false))(make(chan []any)); err == nil {
+		t.Errorf("Expected error from ToMysqlInset")
+	}
+}
+
+func TestToMysqlStruct(t *testing.T) {
+
+	type Base struct {
+		Created string `mysql:"created_at"`
+	}
+	type User struct {
+		ID    int    `mysql:"id,omitempty"`
+		Name  string `mysql:"name,upsert"`
+		Age   int    `mysql:"age"`
+		Cache string `mysql:"-"`
+		*Base
+	}
+
+	var (
+		stmt string
+		args []any
+	)
+	m := &db.MysqlDB{DB: db.DB{DryRun: func(s string, a []any) { stmt, args = s, a }}}
+
+	ch := make(chan User, 2)
+	ch <- User{ID: 1, Name: "a", Age: 2, Base: &Base{Created: "2024-01-01"}}
+	ch <- User{Name: "b", Age: 3}
+	close(ch)
+
+	if err := iter.ToMysqlStructDB[User](m, "users")(ch); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "INSERT INTO `users` (`name`, `age`, `created_at`) VALUES (?, ?, ?), (?, ?, ?) ON DUPLICATE KEY UPDATE `name` = VALUES(`name`)"
+	if stmt != expected {
+		t.Errorf("Expected SQL: %s, but got: %s", expected, stmt)
+	}
+	if !reflect.DeepEqual(args, []any{"a", 2, "2024-01-01", "b", 3, nil}) {
+		t.Errorf("Unexpected args %v", args)
+	}
+}
+
+func TestSplitRange(t *testing.T) {
+
+	build := func(lo, hi int64, n int) []string {
+		var res []string
+		for _, c := range iter.SplitRange("id", lo, hi, n) {
+			sql, _ := query.BuildCond(c, nil)
+			res = append(res, sql)
+		}
+		return res
+	}
+
+	tests := []struct {
+		lo, hi   int64
+		n        int
+		expected []string
+	}{
+		{1, 10, 3, []string{"id >= 1 AND id < 5", "id >= 5 AND id < 9", "id >= 9 AND id <= 10"}},
+		{7, 7, 4, []string{"id >= 7 AND id <= 7"}},
+		{math.MaxInt64 - 5, math.MaxInt64, 2, []string{
+			fmt.Sprintf("id >= %d AND id < %d", int64(math.MaxInt64-5), int64(math.MaxInt64-2)),
+			fmt.Sprintf("id >= %d AND id <= %d", int64(math.MaxInt64-2), int64(math.MaxInt64)),
+		}},
+		{math.MinInt64, math.MaxInt64, 2, []string{
+			fmt.Sprintf("id >= %d AND id < 0", int64(math.MinInt64)),
+			fmt.Sprintf("id >= 0 AND id <= %d", int64(math.MaxInt64)),
+		}},
+	}
+
+	for _, tc := range tests {
+		if actual := build(tc.lo, tc.hi, tc.n); !reflect.DeepEqual(actual, tc.expected) {
+			t.Errorf("splitRange(%d, %d, %d): expected %v, got %v", tc.lo, tc.hi, tc.n, tc.expected, actual)
+		}
+	}
+}
+
+func TestKeysetAfter(t *testing.T) {
+
+	sql, args := query.BuildCond(iter.KeysetAfter([]string{"a", "b", "c"}, []any{1, "x", 3}), query.QuestionPlaceholder)
+
+	expected := "a > ? OR (a = ? AND b > ?) OR (a = ? AND b = ? AND c > ?)"
+	if sql != expected {
+		t.Errorf("Expected SQL: %s, but got: %s", expected, sql)
+	}
+	if !reflect.DeepEqual(args, []any{1, 1, "x", 1, "x", 3}) {
+		t.Errorf("Unexpected args %v", args)
+	}
+}
+
+// keysetDriver 测试用的数据库驱动，表中 id 为 1 到 7，按 id > ? 和 LIMIT 返回数据并记录执行的语句
+type keysetDriver struct{}
+
+type keysetConn struct{}
+
+type keysetStmt struct{ query string }
+
+type keysetRows struct {
+	ids []int64
+	i   int
+}
+
+var (
+	keysetMu    sync.Mutex
+	keysetStmts []string
+	keysetLimit = regexp.MustCompile(`LIMIT (\d+)`)
+)
+
+func (keysetDriver) Open(string) (driver.Conn, error)    { return keysetConn{}, nil }
+func (keysetConn) Prepare(q string) (driver.Stmt, error) { return &keysetStmt{q}, nil }
+func (keysetConn) Close() error                          { return nil }
+func (keysetConn) Begin() (driver.Tx, error)             { return nil, errors.New("not supported") }
+func (*keysetStmt) Close() error                         { return nil }
+func (*keysetStmt) NumInput() int                        { return -1 }
+func (*keysetStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+func (*keysetRows) Columns() []string { return []string{"id", "name"} }
+func (*keysetRows) Close() error      { return nil }
+
+func (s *keysetStmt) Query(args []driver.Value) (driver.Rows, error) {
+
+	keysetMu.Lock()
+	keysetStmts = append(keysetStmts, s.query)
+	keysetMu.Unlock()
+
+	var last int64
+	if len(args) > 0 {
+		last = args[0].(int64)
+	}
+	limit, _ := strconv.Atoi(keysetLimit.FindStringSubmatch(s.query)[1])
+
+	rows := &keysetRows{}
+	for id := last + 1; id <= 7 && len(rows.ids) < limit; id++ {
+		rows.ids = append(rows.ids, id)
+	}
+	return rows, nil
+}
+
+func (r *keysetRows) Next(dest []driver.Value) error {
+
+	if r.i >= len(r.ids) {
+		return io.EOF
+	}
+	dest[0] = r.ids[r.i]
+	dest[1] = fmt.Sprintf("n%d", r.ids[r.i])
+	r.i++
+	return nil
+}
+
+func init() {
+	sql.Register("keyset", keysetDriver{})
+}
+
+func TestFromMysqlKeysetDB(t *testing.T) {
+
+	con, err := sql.Open("keyset", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer con.Close()
+
+	m := &db.MysqlDB{DB: db.DB{Con: con}}
+
+	keysetMu.Lock()
+	keysetStmts = nil
+	keysetMu.Unlock()
+
+	type row struct {
+		ID   int64  `mysql:"id"`
+		Name string `mysql:"name"`
+	}
+
+	var progress [][]any
+	k := iter.Keyset("id").SetPageSize(3).SetProgress(func(last []any) { progress = append(progress, last) })
+
+	ch, errs := iter.FromMysqlKeysetDB[row](m, k)(query.NewSQLBuilder().Select("id", "name").From("t"))
+	rows := iter.Collect(ch)
+	if err := <-errs; err != nil {
+		t.Fatalf("FromMysqlKeysetDB failed: %v", err)
+	}
+
+	if len(rows) != 7 || rows[0] != (row{1, "n1"}) || rows[6] != (row{7, "n7"}) {
+		t.Errorf("Unexpected rows %v", rows)
+	}
+	if !reflect.DeepEqual(progress, [][]any{{int64(3)}, {int64(6)}, {int64(7)}}) {
+		t.Errorf("Unexpected progress %v", progress)
+	}
+
+	expected := []string{
+		"SELECT id, name FROM t ORDER BY id LIMIT 3",
+		"SELECT id, name FROM t WHERE id > ? ORDER BY id LIMIT 3",
+		"SELECT id, name FROM t WHERE id > ? ORDER BY id LIMIT 3",
+	}
+	if !reflect.DeepEqual(keysetStmts, expected) {
+		t.Errorf("Expected %v, got %v", expected, keysetStmts)
+	}
+
+	// 从断点恢复
+	ch, errs = iter.FromMysqlKeysetDB[row](m, iter.Keyset("id").SetAfter(int64(5)))(query.NewSQLBuilder().Select("id", "name").From("t"))
+	rows = iter.Collect(ch)
+	if err := <-errs; err != nil || len(rows) != 2 || rows[0].ID != 6 {
+		t.Errorf("Unexpected resumed rows %v %v", rows, err)
+	}
+
+	// 查询中不能包含 ORDER BY 或 LIMIT
+	for _, q := range []*query.SQLBuilder{
+		query.NewSQLBuilder().From("t").OrderBy("name"),
+		query.NewSQLBuilder().From("t").Limit(10),
+	} {
+		ch, errs = iter.FromMysqlKeysetDB[row](m, iter.Keyset("id"))(q)
+		iter.Collect(ch)
+		if err := <-errs; err == nil {
+			t.Errorf("Expected error for %s", q.Build())
+		}
+	}
+}
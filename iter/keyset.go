@@ -0,0 +1,378 @@
+package iter
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/frankill/gotools/db"
+	"github.com/frankill/gotools/query"
+)
+
+// KeysetField 键集分页配置
+type KeysetField struct {
+	Keys     []string         // 主键列，组合主键按索引顺序排列
+	PageSize int              // 每页行数
+	Parallel int              // 按第一个主键的最小、最大值切分范围并行读取，第一个主键必须为整数
+	After    []any            // 从该键之后开始读取，用于断点恢复，为空时从头读取
+	Progress func(last []any) // 每读完一页后以该页最后一行的键回调，可保存下来用于恢复
+	Ctx      context.Context  // 取消时停止读取
+}
+
+// Keyset 键集分页配置，默认每页 10000 行、不并行
+func Keyset(keys ...string) *KeysetField {
+
+	return &KeysetField{
+		Keys:     keys,
+		PageSize: 10000,
+		Parallel: 1,
+		Ctx:      context.Background(),
+	}
+}
+
+func (k *KeysetField) SetPageSize(n int) *KeysetField {
+	k.PageSize = n
+
+	return k
+}
+
+func (k *KeysetField) SetParallel(n int) *KeysetField {
+	k.Parallel = n
+
+	return k
+}
+
+func (k *KeysetField) SetAfter(values ...any) *KeysetField {
+	k.After = values
+
+	return k
+}
+
+func (k *KeysetField) SetProgress(fn func(last []any)) *KeysetField {
+	k.Progress = fn
+
+	return k
+}
+
+func (k *KeysetField) SetContext(ctx context.Context) *KeysetField {
+	k.Ctx = ctx
+
+	return k
+}
+
+// keysetAfter 生成 (k1, k2, ...) > (v1, v2, ...) 的展开形式:
+// k1 > v1 OR (k1 = v1 AND k2 > v2) OR ...
+func keysetAfter(keys []string, last []any) query.Cond {
+
+	conds := make([]query.Cond, len(keys))
+	for i := range keys {
+		and := make([]query.Cond, 0, i+1)
+		for j := 0; j < i; j++ {
+			and = append(and, query.Eq(keys[j], last[j]))
+		}
+		and = append(and, query.Gt(keys[i], last[i]))
+		conds[i] = query.AllOf(and...)
+	}
+
+	return query.AnyOf(conds...)
+}
+
+// keyColumn 返回键在结果列中的位置，键可以带表名前缀，如 t.id
+func keyColumn(columns []string, key string) int {
+
+	if i := strings.LastIndex(key, "."); i >= 0 {
+		key = key[i+1:]
+	}
+	key = strings.Trim(key, "`")
+
+	for i, c := range columns {
+		if strings.EqualFold(c, key) {
+			return i
+		}
+	}
+	return -1
+}
+
+// teeScanner 在扫描到结构体字段的同时保存原始值，用于记录每页最后一行的键
+type teeScanner struct {
+	dest any
+	val  any
+}
+
+func (t *teeScanner) Scan(src any) error {
+
+	if b, ok := src.([]byte); ok {
+		src = string(b)
+	}
+	t.val = src
+
+	if sc, ok := t.dest.(sql.Scanner); ok {
+		return sc.Scan(src)
+	}
+	*(t.dest.(*any)) = src
+	return nil
+}
+
+// keysetRanges 按第一个主键的最小、最大值切分为 n 个范围
+func keysetRanges(ctx context.Context, con *sql.DB, q *query.SQLBuilder, key string, n int) ([]query.Cond, error) {
+
+	col := key
+	if i := strings.LastIndex(col, "."); i >= 0 {
+		col = col[i+1:]
+	}
+
+	stmt, args := query.NewSQLBuilder().
+		Select(fmt.Sprintf("MIN(%s)", col), fmt.Sprintf("MAX(%s)", col)).
+		From(q.Copy().As("_k")).
+		BuildArgsFor(query.MySQL)
+
+	var minValue, maxValue sql.NullString
+	if err := con.QueryRowContext(ctx, stmt, args...).Scan(&minValue, &maxValue); err != nil {
+		return nil, err
+	}
+	if !minValue.Valid {
+		return nil, nil
+	}
+
+	lo, err := strconv.ParseInt(minValue.String, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("parallel keyset requires an integer key %s: %w", key, err)
+	}
+	hi, err := strconv.ParseInt(maxValue.String, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("parallel keyset requires an integer key %s: %w", key, err)
+	}
+
+	return splitRange(key, lo, hi, n), nil
+}
+
+// splitRange 将 [lo, hi] 切分为最多 n 个左闭右开的范围，最后一个范围包含 hi
+func splitRange(key string, lo, hi int64, n int) []query.Cond {
+
+	// 以无符号数计算跨度，避免 hi - lo 超出 int64 范围
+	width := uint64(hi) - uint64(lo)
+	step := width / uint64(max(n, 1))
+	if step < math.MaxUint64 {
+		step++
+	}
+
+	var ranges []query.Cond
+	for off := uint64(0); ; off += step {
+		start := int64(uint64(lo) + off)
+		if width-off < step {
+			ranges = append(ranges, query.AllOf(query.Gte(key, start), query.Lte(key, hi)))
+			break
+		}
+		end := int64(uint64(lo) + off + step)
+		ranges = append(ranges, query.AllOf(query.Gte(key, start), query.Lt(key, end)))
+	}
+
+	return ranges
+}
+
+// keysetScan 在范围 rng 内按键集分页读取，直到没有更多数据
+func keysetScan[T any](ctx context.Context, con *sql.DB, q *query.SQLBuilder, k *KeysetField, rng query.Cond, loc *time.Location, ch chan T) error {
+
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	last := k.After
+
+	for {
+		page := q.Copy()
+		if rng != nil {
+			page.WhereCond(rng)
+		}
+		if len(last) > 0 {
+			page.WhereCond(keysetAfter(k.Keys, last))
+		}
+		page.OrderBy(k.Keys...).Limit(k.PageSize)
+
+		stmt, args := page.BuildArgsFor(query.MySQL)
+
+		n, err := func() (int, error) {
+
+			rows, err := con.QueryContext(ctx, stmt, args...)
+			if err != nil {
+				return 0, err
+			}
+			defer rows.Close()
+
+			columns, err := rows.Columns()
+			if err != nil {
+				return 0, err
+			}
+
+			tees := make([]*teeScanner, len(k.Keys))
+			idx := make([]int, len(k.Keys))
+			for i, key := range k.Keys {
+				if idx[i] = keyColumn(columns, key); idx[i] < 0 {
+					return 0, fmt.Errorf("keyset column %s not in query result", key)
+				}
+			}
+
+			scanner := db.NewStructScanner(t, "mysql", columns, loc)
+
+			n := 0
+			for rows.Next() {
+				instance := new(T)
+				dest := scanner.Dest(reflect.ValueOf(instance).Elem())
+				for i, c := range idx {
+					tees[i] = &teeScanner{dest: dest[c]}
+					dest[c] = tees[i]
+				}
+
+				if err := rows.Scan(dest...); err != nil {
+					return n, err
+				}
+
+				select {
+				case ch <- *instance:
+				case <-ctx.Done():
+					return n, ctx.Err()
+				}
+
+				n++
+				last = make([]any, len(tees))
+				for i, v := range tees {
+					last[i] = v.val
+				}
+			}
+
+			return n, rows.Err()
+		}()
+
+		if err != nil {
+			return err
+		}
+
+		if n > 0 && k.Progress != nil {
+			k.Progress(last)
+		}
+
+		if n < k.PageSize {
+			return nil
+		}
+	}
+}
+
+// FromMysqlKeyset 以键集分页的方式从 MySQL 读取大表，每页执行一次
+// WHERE (keys) > (last) ORDER BY keys LIMIT n，不会长时间占用一个查询或事务，翻页速度不随页数下降。
+// q 中不能包含 ORDER BY、LIMIT，否则返回错误，查询结果中必须包含所有键列，列到结构体字段的映射与 FromMysql 相同。
+// Parallel 大于 1 时按第一个主键切分范围并发读取，输出顺序不再按键有序，Progress 回调的键也不能用于恢复。
+// 参数:
+//
+//   - con - MySQL 连接字符串，连接通过 db.DefaultRegistry 按 DSN 共享
+//   - k - 键集分页配置
+//
+// 返回:
+//
+//   - 一个函数，接受查询语句，返回数据通道和错误通道
+func FromMysqlKeyset[T any](con string, k *KeysetField) func(q *query.SQLBuilder) (chan T, chan error) {
+
+	return func(q *query.SQLBuilder) (chan T, chan error) {
+
+		m, err := db.DefaultRegistry.Mysql(con)
+		if err != nil {
+			return fromErr[T](err)
+		}
+
+		return FromMysqlKeysetDB[T](m, k)(q)
+	}
+}
+
+// FromMysqlKeysetDB 与 FromMysqlKeyset 相同，使用已有的连接，读取结束后不关闭连接
+// 参数:
+//
+//   - m - MySQL 连接
+//   - k - 键集分页配置
+//
+// 返回:
+//
+//   - 一个函数，接受查询语句，返回数据通道和错误通道
+func FromMysqlKeysetDB[T any](m *db.MysqlDB, k *KeysetField) func(q *query.SQLBuilder) (chan T, chan error) {
+
+	return func(q *query.SQLBuilder) (chan T, chan error) {
+
+		ch := make(chan T, bufferSize)
+		errs := make(chan error, 1)
+
+		go func() {
+
+			defer close(ch)
+			defer close(errs)
+
+			// 并行时会替换 Progress，不能修改调用方的配置
+			k := k
+
+			if len(k.Keys) == 0 || k.PageSize <= 0 {
+				errs <- fmt.Errorf("keyset requires keys and a positive page size")
+				return
+			}
+			if len(k.After) > 0 && len(k.After) != len(k.Keys) {
+				errs <- fmt.Errorf("keyset has %d keys but %d start values", len(k.Keys), len(k.After))
+				return
+			}
+			if paged, err := query.HasOrderOrLimit(q.Build()); err != nil {
+				errs <- err
+				return
+			} else if paged {
+				errs <- fmt.Errorf("keyset query cannot contain ORDER BY or LIMIT")
+				return
+			}
+
+			ctx := k.Ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			ctx, cancel := context.WithCancel(ctx)
+			defer cancel()
+
+			var err error
+			ranges := []query.Cond{nil}
+			if k.Parallel > 1 {
+				// 各范围并发回调 Progress，需要串行化
+				if p := k.Progress; p != nil {
+					var mu sync.Mutex
+					kk := *k
+					kk.Progress = func(last []any) {
+						mu.Lock()
+						defer mu.Unlock()
+						p(last)
+					}
+					k = &kk
+				}
+				if ranges, err = keysetRanges(ctx, m.Con, q, k.Keys[0], k.Parallel); err != nil {
+					errs <- err
+					return
+				}
+			}
+
+			var (
+				wg   sync.WaitGroup
+				once sync.Once
+			)
+
+			for _, rng := range ranges {
+				wg.Add(1)
+				go func(rng query.Cond) {
+					defer wg.Done()
+					if err := keysetScan(ctx, m.Con, q, k, rng, m.Loc, ch); err != nil {
+						once.Do(func() {
+							errs <- err
+							cancel()
+						})
+					}
+				}(rng)
+			}
+
+			wg.Wait()
+		}()
+
+		return ch, errs
+	}
+}
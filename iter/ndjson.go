@@ -0,0 +1,427 @@
+package iter
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/frankill/gotools/file"
+)
+
+// LineError 带行号的错误信息
+type LineError struct {
+	Path string
+	Line int
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("%s line %d: %v", e.Path, e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error { return e.Err }
+
+// JsonSchema JSON Schema 的子集，支持 type、properties、required、items、enum、
+// minimum、maximum、minLength、maxLength，可以直接从 JSON Schema 文件反序列化得到
+type JsonSchema struct {
+	Type       SchemaType             `json:"type,omitempty"`
+	Properties map[string]*JsonSchema `json:"properties,omitempty"`
+	Required   []string               `json:"required,omitempty"`
+	Items      *JsonSchema            `json:"items,omitempty"`
+	Enum       []any                  `json:"enum,omitempty"`
+	Minimum    *float64               `json:"minimum,omitempty"`
+	Maximum    *float64               `json:"maximum,omitempty"`
+	MinLength  *int                   `json:"minLength,omitempty"`
+	MaxLength  *int                   `json:"maxLength,omitempty"`
+}
+
+// SchemaType JSON Schema 的 type 字段，可以是单个类型或类型列表
+type SchemaType []string
+
+func (t *SchemaType) UnmarshalJSON(b []byte) error {
+	var one string
+	if err := json.Unmarshal(b, &one); err == nil {
+		*t = SchemaType{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return err
+	}
+	*t = many
+	return nil
+}
+
+// ParseJsonSchema 从 JSON 文本解析 JsonSchema
+func ParseJsonSchema(data []byte) (*JsonSchema, error) {
+	var s JsonSchema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Validate 校验由 json.Unmarshal 解码得到的值是否满足 schema
+func (s *JsonSchema) Validate(v any) error {
+	return s.validate("", v)
+}
+
+func (s *JsonSchema) validate(path string, v any) error {
+
+	if s == nil {
+		return nil
+	}
+
+	show := path
+	if show == "" {
+		show = "/"
+	}
+
+	if len(s.Type) > 0 {
+		ok := false
+		for _, t := range s.Type {
+			if jsonTypeIs(v, t) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return fmt.Errorf("%s: expected type %s, got %s", show, strings.Join(s.Type, "|"), jsonTypeOf(v))
+		}
+	}
+
+	if len(s.Enum) > 0 {
+		ok := false
+		for _, e := range s.Enum {
+			if reflect.DeepEqual(e, v) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return fmt.Errorf("%s: value %v is not in enum %v", show, v, s.Enum)
+		}
+	}
+
+	switch x := v.(type) {
+	case float64:
+		if s.Minimum != nil && x < *s.Minimum {
+			return fmt.Errorf("%s: %v is less than minimum %v", show, x, *s.Minimum)
+		}
+		if s.Maximum != nil && x > *s.Maximum {
+			return fmt.Errorf("%s: %v is greater than maximum %v", show, x, *s.Maximum)
+		}
+	case string:
+		n := utf8.RuneCountInString(x)
+		if s.MinLength != nil && n < *s.MinLength {
+			return fmt.Errorf("%s: length %d is less than minLength %d", show, n, *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			return fmt.Errorf("%s: length %d is greater than maxLength %d", show, n, *s.MaxLength)
+		}
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := x[name]; !ok {
+				return fmt.Errorf("%s: missing required field %q", show, name)
+			}
+		}
+		for name, sub := range s.Properties {
+			if fv, ok := x[name]; ok {
+				if err := sub.validate(path+"/"+escapePointer(name), fv); err != nil {
+					return err
+				}
+			}
+		}
+	case []any:
+		if s.Items != nil {
+			for i, item := range x {
+				if err := s.Items.validate(path+"/"+strconv.Itoa(i), item); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func jsonTypeIs(v any, t string) bool {
+	switch t {
+	case "integer":
+		f, ok := v.(float64)
+		return ok && f == math.Trunc(f)
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	default:
+		return jsonTypeOf(v) == t
+	}
+}
+
+func jsonTypeOf(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+func escapePointer(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+}
+
+// parsePointer 将 JSON pointer（RFC 6901）拆分为路径片段
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid json pointer %q", pointer)
+	}
+	parts := strings.Split(pointer[1:], "/")
+	for i, p := range parts {
+		parts[i] = strings.ReplaceAll(strings.ReplaceAll(p, "~1", "/"), "~0", "~")
+	}
+	return parts, nil
+}
+
+// pointerDoc 一行 JSON 按路径逐层解码的结果，同一层只解码一次，多个 pointer 共用
+type pointerDoc struct {
+	objects map[string]map[string]json.RawMessage
+	arrays  map[string][]json.RawMessage
+}
+
+// node 解码 prefix 处的对象或数组，已解码过时直接返回
+func (d *pointerDoc) node(prefix string, raw json.RawMessage) (map[string]json.RawMessage, []json.RawMessage, error) {
+
+	if m, ok := d.objects[prefix]; ok {
+		return m, nil, nil
+	}
+	if a, ok := d.arrays[prefix]; ok {
+		return nil, a, nil
+	}
+
+	raw = json.RawMessage(strings.TrimSpace(string(raw)))
+	if len(raw) == 0 {
+		return nil, nil, nil
+	}
+
+	switch raw[0] {
+	case '{':
+		var m map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &m); err != nil {
+			return nil, nil, err
+		}
+		d.objects[prefix] = m
+		return m, nil, nil
+	case '[':
+		var a []json.RawMessage
+		if err := json.Unmarshal(raw, &a); err != nil {
+			return nil, nil, err
+		}
+		d.arrays[prefix] = a
+		return nil, a, nil
+	}
+
+	return nil, nil, nil
+}
+
+// extract 按路径取值，只解码路径上经过的对象和数组，路径不存在时返回 nil
+func (d *pointerDoc) extract(root json.RawMessage, parts []string) (any, error) {
+
+	raw := root
+	prefix := ""
+
+	for _, p := range parts {
+		m, a, err := d.node(prefix, raw)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case m != nil:
+			next, ok := m[p]
+			if !ok {
+				return nil, nil
+			}
+			raw = next
+		case a != nil:
+			i, err := strconv.Atoi(p)
+			if err != nil || i < 0 || i >= len(a) {
+				return nil, nil
+			}
+			raw = a[i]
+		default:
+			return nil, nil
+		}
+		prefix += "/" + escapePointer(p)
+	}
+
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// FromNdjson 从 NDJSON 文件中逐行读取数据，T 可以是结构体或 map[string]any。
+// 无法解析或不满足 schema 的行以 *LineError 写入错误通道并跳过，继续读取，onBad 不为 nil 时同时回调。
+// 错误通道需要与数据通道同时读取，如 go ErrorCH(errs)，否则错误行较多时读取会阻塞。
+// 参数:
+//
+//   - path - 文件路径，.gz 文件自动解压
+//   - schema - 校验规则，为 nil 时不校验
+//   - onBad - 错误行回调，可以为 nil
+//   - skip - 跳过的行数
+//
+// 返回:
+//
+//   - 一个通道，用于接收从文件中读取的数据
+//   - 一个通道，用于接收错误信息
+func FromNdjson[T any](path string, schema *JsonSchema, onBad func(err *LineError)) func(skip int) (chan T, chan error) {
+
+	return func(skip int) (chan T, chan error) {
+
+		return fromNdjson(path, skip, onBad, func(b []byte) (T, error) {
+
+			var t T
+
+			if schema != nil {
+				var v any
+				if err := json.Unmarshal(b, &v); err != nil {
+					return t, err
+				}
+				if err := schema.Validate(v); err != nil {
+					return t, err
+				}
+			}
+
+			err := json.Unmarshal(b, &t)
+			return t, err
+		})
+	}
+}
+
+// FromNdjsonPointer 从 NDJSON 文件中按 JSON pointer 提取字段，每行只解码一次路径经过的对象和数组，多个 pointer 共用。
+// 每行输出一个切片，顺序与 pointers 一致，路径不存在时对应位置为 nil。
+// 无法解析的行的处理与 FromNdjson 相同。
+// 参数:
+//
+//   - path - 文件路径，.gz 文件自动解压
+//   - onBad - 错误行回调，可以为 nil
+//   - pointers - JSON pointer 列表，如 /user/id、/items/0/price
+//   - skip - 跳过的行数
+//
+// 返回:
+//
+//   - 一个通道，用于接收提取的字段
+//   - 一个通道，用于接收错误信息
+func FromNdjsonPointer(path string, onBad func(err *LineError), pointers ...string) func(skip int) (chan []any, chan error) {
+
+	return func(skip int) (chan []any, chan error) {
+
+		parts := make([][]string, len(pointers))
+		for i, p := range pointers {
+			ps, err := parsePointer(p)
+			if err != nil {
+				ch := make(chan []any)
+				errs := make(chan error, 1)
+				errs <- err
+				close(ch)
+				close(errs)
+				return ch, errs
+			}
+			parts[i] = ps
+		}
+
+		return fromNdjson(path, skip, onBad, func(b []byte) ([]any, error) {
+			// 根节点只解码一层，同时校验整行是否为合法 JSON，各 pointer 共用解码结果
+			d := &pointerDoc{objects: map[string]map[string]json.RawMessage{}, arrays: map[string][]json.RawMessage{}}
+			if _, _, err := d.node("", b); err != nil {
+				return nil, err
+			}
+			if len(d.objects) == 0 && len(d.arrays) == 0 && !json.Valid(b) {
+				return nil, fmt.Errorf("invalid json")
+			}
+
+			res := make([]any, len(parts))
+			for i, p := range parts {
+				v, err := d.extract(b, p)
+				if err != nil {
+					return nil, err
+				}
+				res[i] = v
+			}
+			return res, nil
+		})
+	}
+}
+
+func fromNdjson[T any](path string, skip int, onBad func(err *LineError), decode func(b []byte) (T, error)) (chan T, chan error) {
+
+	ch := make(chan T, bufferSize)
+	errs := make(chan error, bufferSize)
+
+	go func() {
+		defer close(ch)
+		defer close(errs)
+
+		f, err := file.Open(path)
+		if err != nil {
+			errs <- err
+			return
+		}
+		defer f.Close()
+
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+		line := 0
+		for i := 0; i < skip && scanner.Scan(); i++ {
+			line++
+		}
+
+		for scanner.Scan() {
+			line++
+
+			b := scanner.Bytes()
+			if len(strings.TrimSpace(string(b))) == 0 {
+				continue
+			}
+
+			t, err := decode(b)
+			if err != nil {
+				le := &LineError{Path: path, Line: line, Err: err}
+				if onBad != nil {
+					onBad(le)
+				}
+				errs <- le
+				continue
+			}
+
+			ch <- t
+		}
+
+		if err := scanner.Err(); err != nil {
+			errs <- err
+		}
+	}()
+
+	return ch, errs
+}
@@ -1,7 +1,9 @@
 package iter
 
 import (
+	"context"
 	"log"
+	"sync"
 )
 
 // Pipeline 表示一系列处理步骤，可以对数据进行处理
@@ -80,3 +82,95 @@ func SetParallel(parallel int) {
 	defer bufferMutex.Unlock()
 	parallerNum = parallel
 }
+
+// fanIn 以最多 parallel 个协程执行 n 个任务，并将各任务通过 emit 发送的数据汇总到一个通道。
+// ordered 为 true 时按任务编号顺序输出，否则各任务的数据交错输出。
+// 任务返回错误时写入错误通道，skipErr 为 false 时取消其余任务，emit 返回 false 表示已取消，任务应尽快返回。
+func fanIn[T any](n, parallel int, ordered, skipErr bool, run func(i int, emit func(T) bool) error) (chan T, chan error) {
+
+	ch := make(chan T, bufferSize)
+	errs := make(chan error, n+1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	sem := make(chan struct{}, max(parallel, 1))
+
+	outs := make([]chan T, n)
+	if ordered {
+		for i := range outs {
+			outs[i] = make(chan T, bufferSize)
+		}
+	}
+
+	var wg sync.WaitGroup
+
+	go func() {
+		defer close(errs)
+
+	launch:
+		for i := 0; i < n; i++ {
+
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				if ordered {
+					for _, o := range outs[i:] {
+						close(o)
+					}
+				}
+				break launch
+			}
+
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				defer func() { <-sem }()
+
+				out := ch
+				if ordered {
+					out = outs[i]
+					defer close(out)
+				}
+
+				emit := func(v T) bool {
+					select {
+					case out <- v:
+						return true
+					case <-ctx.Done():
+						return false
+					}
+				}
+
+				if err := run(i, emit); err != nil {
+					errs <- err
+					if !skipErr {
+						cancel()
+					}
+				}
+			}(i)
+		}
+
+		wg.Wait()
+		if !ordered {
+			cancel()
+			close(ch)
+		}
+	}()
+
+	if ordered {
+		go func() {
+			defer close(ch)
+			defer cancel()
+			for _, o := range outs {
+				for v := range o {
+					select {
+					case ch <- v:
+					case <-ctx.Done():
+					}
+				}
+			}
+		}()
+	}
+
+	return ch, errs
+}
@@ -0,0 +1,45 @@
+package iter
+
+import (
+	"errors"
+
+	"github.com/frankill/gotools/file"
+)
+
+// ToPartition 方法将通道中的数据按分区写入多个文件
+// 参数:
+//
+//   - p - 分区写入配置，见 file.NewPartitionWriter
+//   - key - 根据记录返回分区路径，如 dt=2024-05-01/region=east，可使用 file.ColumnPartition 按列生成
+//
+// 返回:
+//
+//   - 一个函数，用于执行文件写入操作，写入完成后关闭所有文件
+func ToPartition(p *file.PartitionWriter, key func(x []string) string) func(ch chan []string) error {
+
+	return ToPartitionBy(p, key, func(x []string) []string { return x })
+}
+
+// ToPartitionBy 方法将通道中的任意类型数据按分区写入多个文件
+// 参数:
+//
+//   - p - 分区写入配置，见 file.NewPartitionWriter
+//   - key - 根据记录返回分区路径，如 dt=2024-05-01/region=east
+//   - row - 将记录转换为一行数据
+//
+// 返回:
+//
+//   - 一个函数，用于执行文件写入操作，写入完成后关闭所有文件
+func ToPartitionBy[T any](p *file.PartitionWriter, key func(x T) string, row func(x T) []string) func(ch chan T) error {
+
+	return func(ch chan T) error {
+
+		for x := range ch {
+			if err := p.Write(key(x), row(x)); err != nil {
+				return errors.Join(err, p.Close())
+			}
+		}
+
+		return p.Close()
+	}
+}
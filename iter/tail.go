@@ -0,0 +1,248 @@
+package iter
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/frankill/gotools/file"
+)
+
+// TailField 持续读取文件配置
+type TailField struct {
+	Path     string
+	Offset   int64              // 起始字节偏移量，小于 0 时从文件末尾开始
+	Interval time.Duration      // 无新数据时的轮询间隔
+	OnOffset func(offset int64) // 每发送一行后回调该行结束处的偏移量，可用于持久化
+	Encoding string             // 文件编码，按行解码，只支持以 \n 字节分行的编码，不支持 UTF-16 和 Auto
+}
+
+// Tail 持续读取文件配置，默认从文件开头读取，轮询间隔 1 秒
+func Tail(path string) *TailField {
+
+	return &TailField{
+		Path:     path,
+		Offset:   0,
+		Interval: time.Second,
+		Encoding: file.UTF8,
+	}
+}
+
+// SetOffset 设置起始字节偏移量，小于 0 时从文件末尾开始
+func (t *TailField) SetOffset(offset int64) *TailField {
+	t.Offset = offset
+
+	return t
+}
+
+// SetInterval 设置轮询间隔
+func (t *TailField) SetInterval(interval time.Duration) *TailField {
+	t.Interval = interval
+
+	return t
+}
+
+// SetEncoding 设置文件编码，如 file.GBK、file.GB18030
+func (t *TailField) SetEncoding(enc string) *TailField {
+	t.Encoding = enc
+
+	return t
+}
+
+// SetOnOffset 设置偏移量回调
+func (t *TailField) SetOnOffset(f func(offset int64)) *TailField {
+	t.OnOffset = f
+
+	return t
+}
+
+// FromTail 类似 tail -F 持续读取文件新追加的行，文件被轮转或截断后自动从新文件开头继续读取
+// 参数:
+//
+//   - t - 持续读取文件配置
+//   - ctx - 上下文，取消后停止读取并关闭通道
+//   - skip - 跳过的行数
+//
+// 返回:
+//
+//   - 一个通道，用于接收文件中的每一行数据（不含换行符）
+//   - 一个通道，用于接收错误信息
+func FromTail(t *TailField) func(ctx context.Context, skip int) (chan string, chan error) {
+
+	return func(ctx context.Context, skip int) (chan string, chan error) {
+
+		ch := make(chan string, bufferSize)
+		errs := make(chan error, 1)
+
+		go func() {
+			defer close(ch)
+			defer close(errs)
+
+			enc, err := file.NormalizeEncoding(t.Encoding)
+			if err == nil && (enc == file.UTF16LE || enc == file.UTF16BE || enc == file.Auto) {
+				err = fmt.Errorf("tail does not support encoding %s", enc)
+			}
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			interval := t.Interval
+			if interval <= 0 {
+				interval = time.Second
+			}
+
+			wait := func() bool {
+				timer := time.NewTimer(interval)
+				defer timer.Stop()
+				select {
+				case <-ctx.Done():
+					return false
+				case <-timer.C:
+					return true
+				}
+			}
+
+			var f *os.File
+
+			// 等待文件出现
+			for {
+				f, err = os.Open(t.Path)
+				if err == nil {
+					break
+				}
+				if !os.IsNotExist(err) {
+					errs <- err
+					return
+				}
+				if !wait() {
+					return
+				}
+			}
+			defer func() { f.Close() }()
+
+			offset := t.Offset
+			if offset < 0 {
+				offset, err = f.Seek(0, io.SeekEnd)
+			} else {
+				offset, err = f.Seek(offset, io.SeekStart)
+			}
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			reader := bufio.NewReader(f)
+			var partial strings.Builder
+
+			// emit 发送暂存的一行，上下文取消时返回 false
+			emit := func() bool {
+				line := partial.String()
+				partial.Reset()
+
+				if skip > 0 {
+					skip--
+					return true
+				}
+
+				b, err := file.DecodeBytes([]byte(line), enc)
+				if err != nil {
+					errs <- err
+					return false
+				}
+				text := strings.TrimRight(string(b), "\r\n")
+
+				select {
+				case ch <- text:
+				case <-ctx.Done():
+					return false
+				}
+				if t.OnOffset != nil {
+					t.OnOffset(offset)
+				}
+				return true
+			}
+
+			for {
+				line, err := reader.ReadString('\n')
+
+				if err == nil {
+					offset += int64(len(line))
+					partial.WriteString(line)
+					if !emit() {
+						return
+					}
+					continue
+				}
+
+				if !errors.Is(err, io.EOF) {
+					errs <- err
+					return
+				}
+
+				// 行尚未写完，暂存等待后续数据
+				offset += int64(len(line))
+				partial.WriteString(line)
+
+				if !wait() {
+					return
+				}
+
+				info, err := os.Stat(t.Path)
+				if err != nil {
+					if os.IsNotExist(err) {
+						// 轮转过程中文件可能暂时不存在
+						continue
+					}
+					errs <- err
+					return
+				}
+
+				cur, err := f.Stat()
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				if !os.SameFile(info, cur) {
+					// 文件已轮转，先读完旧文件剩余内容再切换
+					if _, err := reader.Peek(1); err == nil {
+						continue
+					}
+					nf, err := os.Open(t.Path)
+					if err != nil {
+						continue
+					}
+					// 旧文件最后一行没有换行符，切换前作为完整的一行发送
+					if partial.Len() > 0 && !emit() {
+						nf.Close()
+						return
+					}
+					f.Close()
+					f = nf
+					offset = 0
+					reader.Reset(f)
+					continue
+				}
+
+				if info.Size() < offset {
+					// 文件被截断，从头开始
+					if _, err := f.Seek(0, io.SeekStart); err != nil {
+						errs <- err
+						return
+					}
+					offset = 0
+					partial.Reset()
+					reader.Reset(f)
+				}
+			}
+		}()
+
+		return ch, errs
+	}
+}
@@ -7,7 +7,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"reflect"
 	"strconv"
 
 	"github.com/frankill/gotools/array"
@@ -46,6 +48,24 @@ func ToRedisList[T any](host, pwd string, dbNUM int) func(key string, ch chan T)
 //
 //   - 一个函数，接受一个通道作为参数，写入通道中的数据到 gzip 文件中，并返回错误信息。
 func ToGzip(path string, append bool) func(ch chan string) error {
+
+	return toGzip(path, file.UTF8, false, append)
+}
+
+// ToGzipT 方法按表格配置将通道中的数据按指定编码压缩写入 gzip 文件
+// 参数:
+//
+//   - t - 表格配置，使用其中的 Path、Encoding、BOM、Append，BOM 仅在文件为空时写入
+//
+// 返回:
+//
+//   - 一个函数，接受一个通道作为参数，写入通道中的数据到 gzip 文件中，并返回错误信息。
+func ToGzipT(t *TableField) func(ch chan string) error {
+
+	return toGzip(t.Path, t.Encoding, t.BOM, t.Append)
+}
+
+func toGzip(path string, enc string, bom bool, append bool) func(ch chan string) error {
 	return func(ch chan string) error {
 		var f *os.File
 		var err error
@@ -60,20 +80,33 @@ func ToGzip(path string, append bool) func(ch chan string) error {
 		}
 		defer f.Close()
 
+		bom, err = emptyFile(f, bom)
+		if err != nil {
+			return err
+		}
+
 		gz, err := gzip.NewWriterLevel(f, gzip.BestSpeed)
 		if err != nil {
 			return err
 		}
 		defer gz.Close()
 
+		w, err := file.NewEncodeWriter(gz, enc, bom)
+		if err != nil {
+			return err
+		}
+
 		for t := range ch {
-			_, err = gz.Write([]byte(t + "\n"))
+			_, err = io.WriteString(w, t+"\n")
 			if err != nil {
 				return err
 			}
 		}
 
-		return nil
+		if err := w.Close(); err != nil {
+			return err
+		}
+		return gz.Close()
 	}
 }
 
@@ -89,6 +122,24 @@ func ToGzip(path string, append bool) func(ch chan string) error {
 //   - 一个函数，用于执行 JSON 文件写入操作。
 func ToJson[T any](path string, append bool) func(ch chan T) error {
 
+	return toJson[T](path, file.UTF8, false, append)
+}
+
+// ToJsonT 方法按表格配置将通道中的数据按指定编码逐行写入 JSON 文件
+// 参数:
+//
+//   - t - 表格配置，使用其中的 Path、Encoding、BOM、Append，BOM 仅在文件为空时写入
+//
+// 返回:
+//
+//   - 一个函数，用于执行 JSON 文件写入操作。
+func ToJsonT[T any](t *TableField) func(ch chan T) error {
+
+	return toJson[T](t.Path, t.Encoding, t.BOM, t.Append)
+}
+
+func toJson[T any](path string, enc string, bom bool, append bool) func(ch chan T) error {
+
 	return func(ch chan T) error {
 
 		if path == "" {
@@ -108,8 +159,13 @@ func ToJson[T any](path string, append bool) func(ch chan T) error {
 		}
 		defer f.Close()
 
+		w, err := encodeFile(f, enc, bom)
+		if err != nil {
+			return err
+		}
+
 		// 创建 JSON 编码器
-		encoder := json.NewEncoder(f)
+		encoder := json.NewEncoder(w)
 
 		for t := range ch {
 
@@ -118,7 +174,7 @@ func ToJson[T any](path string, append bool) func(ch chan T) error {
 			}
 		}
 
-		return nil
+		return w.Close()
 	}
 
 }
@@ -135,6 +191,24 @@ func ToJson[T any](path string, append bool) func(ch chan T) error {
 //   - 一个函数，用于执行文件写入操作。
 func ToTxt(path string, append bool) func(ch chan string) error {
 
+	return toTxt(path, file.UTF8, false, append)
+}
+
+// ToTxtT 方法按表格配置将通道中的数据按指定编码写入到文本文件中
+// 参数:
+//
+//   - t - 表格配置，使用其中的 Path、Encoding、BOM、Append，BOM 仅在文件为空时写入
+//
+// 返回:
+//
+//   - 一个函数，用于执行文件写入操作。
+func ToTxtT(t *TableField) func(ch chan string) error {
+
+	return toTxt(t.Path, t.Encoding, t.BOM, t.Append)
+}
+
+func toTxt(path string, enc string, bom bool, append bool) func(ch chan string) error {
+
 	return func(ch chan string) error {
 
 		if path == "" {
@@ -155,19 +229,49 @@ func ToTxt(path string, append bool) func(ch chan string) error {
 		}
 		defer f.Close()
 
+		w, err := encodeFile(f, enc, bom)
+		if err != nil {
+			return err
+		}
+
 		for t := range ch {
 
-			if _, err := f.WriteString(t + "\n"); err != nil {
+			if _, err := io.WriteString(w, t+"\n"); err != nil {
 				return err
 			}
 		}
 
-		return nil
+		return w.Close()
+	}
+
+}
+
+// encodeFile 返回按 enc 编码写入 f 的 Writer，bom 只在文件为空时写入
+func encodeFile(f *os.File, enc string, bom bool) (io.WriteCloser, error) {
+
+	bom, err := emptyFile(f, bom)
+	if err != nil {
+		return nil, err
+	}
+
+	return file.NewEncodeWriter(f, enc, bom)
+}
+
+// emptyFile bom 为 true 时判断 f 是否为空文件，用于只在文件开头写入 BOM
+func emptyFile(f *os.File, bom bool) (bool, error) {
+
+	if !bom {
+		return false, nil
 	}
 
+	info, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	return info.Size() == 0, nil
 }
 
-// ToMysqlInset 方法将通道中的数据插入到 MySQL 数据库中
+// ToMysqlInset 方法将通道中的数据插入到 MySQL 数据库中，连接通过 db.DefaultRegistry 按 DSN 共享
 // 参数:
 //
 //   - con mysql 连接字符串
@@ -181,21 +285,30 @@ func ToMysqlInset(con string, q query.SqlInsert) func(ch chan []any) error {
 
 	return func(ch chan []any) error {
 
-		con := db.NewMysqlDB(con)
-
-		defer con.Close()
-
-		err := con.Insert(q)(ch)
+		m, err := db.DefaultRegistry.Mysql(con)
 		if err != nil {
 			return err
 		}
 
-		return nil
+		return ToMysqlDB(m, q)(ch)
 	}
 
 }
 
-// ToCKInsert 方法将通道中的数据插入到 ClickHouse 数据库中
+// ToMysqlDB 与 ToMysqlInset 相同，使用已有的连接，写入结束后不关闭连接
+// 参数:
+//
+//   - m - MySQL 连接
+//   - q - 插入语句
+//
+// 返回:
+//
+//   - 一个函数， 用于执行数据库插入操作。
+func ToMysqlDB(m *db.MysqlDB, q query.SqlInsert) func(ch chan []any) error {
+	return m.Insert(q)
+}
+
+// ToCKInsert 方法将通道中的数据插入到 ClickHouse 数据库中，连接通过 db.DefaultRegistry 共享
 // 参数:
 //
 //   - ck *db.CKinfo - *db.CKinfo 类型的结构体，用于构建 ck 客户端信息
@@ -209,18 +322,137 @@ func ToCK(ck *db.CKinfo, q query.SqlInsert) func(ch chan []any) error {
 
 	return func(ch chan []any) error {
 
-		con := db.NewCK(ck)
+		c, err := db.DefaultRegistry.CK(ck)
+		if err != nil {
+			return err
+		}
+
+		return ToCKDB(c, q)(ch)
+	}
+
+}
+
+// ToCKDB 与 ToCK 相同，使用已有的连接，写入结束后不关闭连接
+// 参数:
+//
+//   - c - ClickHouse 连接
+//   - q - 插入语句
+//
+// 返回:
+//
+//   - 一个函数， 用于执行数据库插入操作。
+func ToCKDB(c *db.CK, q query.SqlInsert) func(ch chan []any) error {
+	return c.Insert(q)
+}
+
+// structInsert 根据 T 的标签生成插入语句和列映射
+func structInsert[T any](d query.Dialect, tag string, table string) (*query.Insert, *db.InsertPlan) {
+
+	plan := db.StructInsertPlan(reflect.TypeOf((*T)(nil)).Elem(), tag)
+
+	return query.NewInsert(d, table).AddColumn(plan.Columns...).AddUpdateColumn(plan.Update...), plan
+}
+
+// structSink 将结构体通道按 plan 转换为行通道后交给 sink 写入
+func structSink[T any](plan *db.InsertPlan, sink func(ch chan []any) error) func(ch chan T) error {
+
+	return func(ch chan T) error {
+
+		rows := make(chan []any, bufferSize)
+		done := make(chan struct{})
+		defer close(done)
+
+		go func() {
+			defer close(rows)
+			for v := range ch {
+				select {
+				case rows <- plan.Values(v):
+				case <-done:
+					return
+				}
+			}
+		}()
+
+		return sink(rows)
+	}
+}
+
+// ToMysqlStruct 方法将通道中的结构体插入到 MySQL 表中，列取自 mysql 标签，连接通过 db.DefaultRegistry 按 DSN 共享。
+// 标签为 - 或带 omitempty、auto 选项的字段不插入，带 upsert 选项的字段在主键或唯一键冲突时更新，见 db.StructInsertPlan。
+// 参数:
+//
+//   - con - MySQL 连接字符串
+//   - table - 表名
+//
+// 返回:
+//
+//   - 一个函数， 用于执行数据库插入操作。
+func ToMysqlStruct[T any](con string, table string) func(ch chan T) error {
 
-		defer con.Close()
+	return func(ch chan T) error {
 
-		err := con.Insert(q)(ch)
+		m, err := db.DefaultRegistry.Mysql(con)
 		if err != nil {
 			return err
 		}
 
-		return nil
+		return ToMysqlStructDB[T](m, table)(ch)
+	}
+}
+
+// ToMysqlStructDB 与 ToMysqlStruct 相同，使用已有的连接，写入结束后不关闭连接
+// 参数:
+//
+//   - m - MySQL 连接
+//   - table - 表名
+//
+// 返回:
+//
+//   - 一个函数， 用于执行数据库插入操作。
+func ToMysqlStructDB[T any](m *db.MysqlDB, table string) func(ch chan T) error {
+
+	q, plan := structInsert[T](query.MySQL, "mysql", table)
+
+	return structSink[T](plan, m.Insert(q))
+}
+
+// ToCKStruct 方法将通道中的结构体插入到 ClickHouse 表中，列取自 ch 标签，连接通过 db.DefaultRegistry 共享。
+// 标签为 - 或带 omitempty、auto 选项的字段不插入，ClickHouse 不支持 upsert 选项。
+// 参数:
+//
+//   - ck - ClickHouse 连接信息
+//   - table - 表名
+//
+// 返回:
+//
+//   - 一个函数， 用于执行数据库插入操作。
+func ToCKStruct[T any](ck *db.CKinfo, table string) func(ch chan T) error {
+
+	return func(ch chan T) error {
+
+		c, err := db.DefaultRegistry.CK(ck)
+		if err != nil {
+			return err
+		}
+
+		return ToCKStructDB[T](c, table)(ch)
 	}
+}
+
+// ToCKStructDB 与 ToCKStruct 相同，使用已有的连接，写入结束后不关闭连接
+// 参数:
+//
+//   - c - ClickHouse 连接
+//   - table - 表名
+//
+// 返回:
+//
+//   - 一个函数， 用于执行数据库插入操作。
+func ToCKStructDB[T any](c *db.CK, table string) func(ch chan T) error {
+
+	q, plan := structInsert[T](query.ClickHouse, "ch", table)
 
+	return structSink[T](plan, c.Insert(q))
 }
 
 // ToES 将数据写入 ElasticSearch。
@@ -278,7 +510,6 @@ func ToCsv(path string, append bool, header ...string) func(ch chan []string) er
 		defer f.Close()
 
 		writer := csv.NewWriter(f)
-		defer writer.Flush()
 
 		if len(header) > 0 {
 			if err := writer.Write(header); err != nil {
@@ -292,12 +523,14 @@ func ToCsv(path string, append bool, header ...string) func(ch chan []string) er
 			}
 		}
 
-		return nil
+		writer.Flush()
+
+		return writer.Error()
 	}
 
 }
 
-// TableField 表格配置
+// TableField 表格配置，其中的 Path、Encoding、BOM、Append 也用于 FromTxtT、ToTxtT 等文本文件读写
 type TableField struct {
 	Path     string
 	Seq      string
@@ -305,6 +538,10 @@ type TableField struct {
 	Header   []string
 	Append   bool
 	Escape   byte
+	Encoding string
+	BOM      bool
+	Parallel int  // 读取时并发解析的协程数，见 FromTableT
+	Ordered  bool // 并发读取时是否按文件中的原始顺序输出
 }
 
 // T 表格
@@ -317,9 +554,29 @@ func T(path string) *TableField {
 		Header:   []string{},
 		Append:   false,
 		Escape:   '"',
+		Encoding: file.UTF8,
+		BOM:      false,
+		Parallel: 1,
+		Ordered:  true,
 	}
 }
 
+// SetParallel 设置读取时并发解析的协程数，ordered 为 false 时各段记录交错输出，吞吐更高
+func (t *TableField) SetParallel(parallel int, ordered bool) *TableField {
+	t.Parallel = parallel
+	t.Ordered = ordered
+
+	return t
+}
+
+// SetEncoding 设置文件编码，bom 为 true 时在空文件开头写入 BOM
+func (t *TableField) SetEncoding(enc string, bom bool) *TableField {
+	t.Encoding = enc
+	t.BOM = bom
+
+	return t
+}
+
 func (t *TableField) SetEscape(escape byte) *TableField {
 	t.Escape = escape
 
@@ -390,9 +647,12 @@ func ToTable(t *TableField) func(ch chan []string) error {
 			return errors.New("seq cannot be empty")
 		}
 
-		writer := file.NewWriter(f, t.Seq, t.UseQuote, t.Escape)
+		w, err := encodeFile(f, t.Encoding, t.BOM)
+		if err != nil {
+			return err
+		}
 
-		defer writer.Flush()
+		writer := file.NewWriter(w, t.Seq, t.UseQuote, t.Escape)
 
 		if len(t.Header) > 0 {
 			if err := writer.Write(t.Header); err != nil {
@@ -407,7 +667,12 @@ func ToTable(t *TableField) func(ch chan []string) error {
 				return err
 			}
 		}
-		return nil
+
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+
+		return w.Close()
 	}
 
 }
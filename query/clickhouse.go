@@ -0,0 +1,143 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ckClauses ClickHouse 特有的子句
+type ckClauses struct {
+	final      bool
+	sample     string
+	arrayJoins []string
+	prewhere   []expr
+	withTotals bool
+	limitBy    int
+	limitByOn  []string
+	settings   []setting
+}
+
+type setting struct {
+	key   string
+	value any
+}
+
+func (c ckClauses) copy() ckClauses {
+	c.arrayJoins = append([]string{}, c.arrayJoins...)
+	c.prewhere = append([]expr{}, c.prewhere...)
+	c.limitByOn = append([]string{}, c.limitByOn...)
+	c.settings = append([]setting{}, c.settings...)
+	return c
+}
+
+// Final 方法用于在 FROM 之后添加 FINAL，仅用于 ClickHouse
+func (sb *SQLBuilder) Final() *SQLBuilder {
+	sb.ck.final = true
+	return sb
+}
+
+// Sample 方法用于添加 SAMPLE 子句，如 Sample("0.1")、Sample("1/10 OFFSET 1/2")，仅用于 ClickHouse
+func (sb *SQLBuilder) Sample(sample string) *SQLBuilder {
+	sb.ck.sample = sample
+	return sb
+}
+
+// ArrayJoin 方法用于添加 ARRAY JOIN 子句，如 ArrayJoin("tags AS tag")，仅用于 ClickHouse
+func (sb *SQLBuilder) ArrayJoin(exprs ...string) *SQLBuilder {
+	sb.ck.arrayJoins = append(sb.ck.arrayJoins, "ARRAY JOIN "+strings.Join(exprs, ", "))
+	return sb
+}
+
+// LeftArrayJoin 方法用于添加 LEFT ARRAY JOIN 子句，仅用于 ClickHouse
+func (sb *SQLBuilder) LeftArrayJoin(exprs ...string) *SQLBuilder {
+	sb.ck.arrayJoins = append(sb.ck.arrayJoins, "LEFT ARRAY JOIN "+strings.Join(exprs, ", "))
+	return sb
+}
+
+// Prewhere 方法用于添加 PREWHERE 子句条件，仅用于 ClickHouse
+func (sb *SQLBuilder) Prewhere(clauses ...string) *SQLBuilder {
+	for _, c := range clauses {
+		sb.ck.prewhere = append(sb.ck.prewhere, rawExpr(c))
+	}
+	return sb
+}
+
+// PrewhereArgs 方法用于添加带参数的 PREWHERE 子句条件，args 对应 clause 中引号外的 ? 占位符
+func (sb *SQLBuilder) PrewhereArgs(clause string, args ...any) *SQLBuilder {
+	sb.ck.prewhere = append(sb.ck.prewhere, clauseExpr(clause, args...))
+	return sb
+}
+
+// PrewhereCond 方法用于添加条件表达式到 PREWHERE 子句，多个条件以 AND 连接
+func (sb *SQLBuilder) PrewhereCond(conds ...Cond) *SQLBuilder {
+	for _, c := range conds {
+		sb.ck.prewhere = append(sb.ck.prewhere, condExpr(c))
+	}
+	return sb
+}
+
+// WithTotals 方法用于在 GROUP BY 之后添加 WITH TOTALS，仅用于 ClickHouse
+func (sb *SQLBuilder) WithTotals() *SQLBuilder {
+	sb.ck.withTotals = true
+	return sb
+}
+
+// LimitBy 方法用于添加 LIMIT n BY 子句，每组最多保留 n 行，仅用于 ClickHouse
+func (sb *SQLBuilder) LimitBy(n int, fields ...string) *SQLBuilder {
+	sb.ck.limitBy = n
+	sb.ck.limitByOn = fields
+	return sb
+}
+
+// Settings 方法用于添加 SETTINGS 子句，value 以字面量写入，仅用于 ClickHouse
+func (sb *SQLBuilder) Settings(key string, value any) *SQLBuilder {
+	for i, s := range sb.ck.settings {
+		if s.key == key {
+			sb.ck.settings[i].value = value
+			return sb
+		}
+	}
+	sb.ck.settings = append(sb.ck.settings, setting{key: key, value: value})
+	return sb
+}
+
+// writeSource 写入 FROM 之后的 FINAL、SAMPLE、ARRAY JOIN
+func (c ckClauses) writeSource(w *sqlWriter) {
+	if c.final {
+		w.write(" FINAL")
+	}
+	if c.sample != "" {
+		w.write(" SAMPLE ", c.sample)
+	}
+	for _, a := range c.arrayJoins {
+		w.write(" ", a)
+	}
+}
+
+// writeLimitBy 写入 LIMIT n BY 子句
+func (c ckClauses) writeLimitBy(w *sqlWriter) {
+	if c.limitBy > 0 && len(c.limitByOn) > 0 {
+		w.write(fmt.Sprintf(" LIMIT %d BY ", c.limitBy), strings.Join(c.limitByOn, ", "))
+	}
+}
+
+// writeSettings 写入 SETTINGS 子句
+func (c ckClauses) writeSettings(w *sqlWriter) {
+
+	if len(c.settings) == 0 {
+		return
+	}
+
+	lit := Literal
+	if w.d != nil {
+		lit = w.d.Literal
+	}
+
+	w.write(" SETTINGS ")
+	for i, s := range c.settings {
+		if i > 0 {
+			w.write(", ")
+		}
+		w.write(s.key, " = ", lit(s.value))
+	}
+}
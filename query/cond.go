@@ -0,0 +1,195 @@
+package query
+
+// Cond 条件表达式，由 Eq、In、Like、IsNull 等构造，通过 Not、AnyOf、AllOf 任意嵌套。
+// 值以参数的形式写入，可用于 SQLBuilder 的 WhereCond 和 HavingCond。
+type Cond interface {
+	writeCond(w *sqlWriter)
+}
+
+// exprCond 单个条件
+type exprCond struct {
+	e expr
+}
+
+func (c exprCond) writeCond(w *sqlWriter) {
+	w.expr(c.e)
+}
+
+// junction 以 AND 或 OR 连接的条件组
+type junction struct {
+	op    string
+	conds []Cond
+}
+
+func (c junction) writeCond(w *sqlWriter) {
+
+	if len(c.conds) == 0 {
+		// 空的 AllOf 恒为真，空的 AnyOf 恒为假
+		if c.op == "AND" {
+			w.write("1 = 1")
+		} else {
+			w.write("1 = 0")
+		}
+		return
+	}
+
+	for i, v := range c.conds {
+		if i > 0 {
+			w.write(" ", c.op, " ")
+		}
+		writeNested(w, v)
+	}
+}
+
+// notCond 取反
+type notCond struct {
+	c Cond
+}
+
+func (c notCond) writeCond(w *sqlWriter) {
+	w.write("NOT (")
+	c.c.writeCond(w)
+	w.write(")")
+}
+
+// writeNested 写入嵌套在其他条件中的条件，多于一项的条件组加括号
+func writeNested(w *sqlWriter, c Cond) {
+	if j, ok := c.(junction); ok && len(j.conds) > 1 {
+		w.write("(")
+		j.writeCond(w)
+		w.write(")")
+		return
+	}
+	c.writeCond(w)
+}
+
+// condExpr 将条件转换为 expr，以便与字符串条件一起写入 WHERE、HAVING
+func condExpr(c Cond) expr {
+	return expr{parts: []string{"", ""}, args: []any{nested{c}}}
+}
+
+// nested 作为 expr 的参数时按 writeNested 写入
+type nested struct {
+	c Cond
+}
+
+func cmpCond(field, op string, value any) Cond {
+	return exprCond{expr{parts: []string{field + " " + op + " ", ""}, args: []any{value}}}
+}
+
+// Expr 由 SQL 片段构造条件，args 对应 sql 中引号外的 ? 占位符
+func Expr(sql string, args ...any) Cond {
+	return exprCond{argExpr(sql, args...)}
+}
+
+// Eq 生成 field = value，value 为 nil 时生成 field IS NULL
+func Eq(field string, value any) Cond {
+	if value == nil {
+		return IsNull(field)
+	}
+	return cmpCond(field, "=", value)
+}
+
+// Neq 生成 field != value，value 为 nil 时生成 field IS NOT NULL
+func Neq(field string, value any) Cond {
+	if value == nil {
+		return IsNotNull(field)
+	}
+	return cmpCond(field, "!=", value)
+}
+
+// Gt 生成 field > value
+func Gt(field string, value any) Cond {
+	return cmpCond(field, ">", value)
+}
+
+// Gte 生成 field >= value
+func Gte(field string, value any) Cond {
+	return cmpCond(field, ">=", value)
+}
+
+// Lt 生成 field < value
+func Lt(field string, value any) Cond {
+	return cmpCond(field, "<", value)
+}
+
+// Lte 生成 field <= value
+func Lte(field string, value any) Cond {
+	return cmpCond(field, "<=", value)
+}
+
+// Between 生成 field BETWEEN lower AND upper
+func Between(field string, lower, upper any) Cond {
+	return exprCond{expr{parts: []string{field + " BETWEEN ", " AND ", ""}, args: []any{lower, upper}}}
+}
+
+// Like 生成 field LIKE pattern
+func Like(field string, pattern string) Cond {
+	return cmpCond(field, "LIKE", pattern)
+}
+
+// NotLike 生成 field NOT LIKE pattern
+func NotLike(field string, pattern string) Cond {
+	return cmpCond(field, "NOT LIKE", pattern)
+}
+
+// IsNull 生成 field IS NULL
+func IsNull(field string) Cond {
+	return exprCond{rawExpr(field + " IS NULL")}
+}
+
+// IsNotNull 生成 field IS NOT NULL
+func IsNotNull(field string) Cond {
+	return exprCond{rawExpr(field + " IS NOT NULL")}
+}
+
+// in 生成 IN 或 NOT IN 条件，values 为切片、*SQLBuilder 或单个值
+func in(field, op string, values any) Cond {
+
+	if sub, ok := values.(*SQLBuilder); ok {
+		return exprCond{expr{parts: []string{field + " " + op + " (", ")"}, args: []any{sub.Copy()}}}
+	}
+
+	if list, ok := listArgs(values); ok {
+		return exprCond{inExpr(field, op, list)}
+	}
+
+	return exprCond{inExpr(field, op, []any{values})}
+}
+
+// In 生成 field IN (...)，values 为切片、子查询或单个值，切片为空时条件恒为假
+func In(field string, values any) Cond {
+	return in(field, "IN", values)
+}
+
+// NotIn 生成 field NOT IN (...)，切片为空时条件恒为真
+func NotIn(field string, values any) Cond {
+	return in(field, "NOT IN", values)
+}
+
+// Exists 生成 EXISTS (subquery)
+func Exists(q *SQLBuilder) Cond {
+	return exprCond{expr{parts: []string{"EXISTS (", ")"}, args: []any{q.Copy()}}}
+}
+
+// Not 生成 NOT (cond)
+func Not(c Cond) Cond {
+	return notCond{c}
+}
+
+// AllOf 以 AND 连接多个条件，没有条件时恒为真
+func AllOf(conds ...Cond) Cond {
+	return junction{op: "AND", conds: conds}
+}
+
+// AnyOf 以 OR 连接多个条件，没有条件时恒为假
+func AnyOf(conds ...Cond) Cond {
+	return junction{op: "OR", conds: conds}
+}
+
+// BuildCond 单独构建条件，返回 SQL 片段及参数，ph 为 nil 时参数以字面量写入
+func BuildCond(c Cond, ph Placeholder) (string, []any) {
+	w := &sqlWriter{ph: ph}
+	c.writeCond(w)
+	return w.sb.String(), w.args
+}
@@ -0,0 +1,415 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dialect 数据库方言，决定标识符引用、占位符、LIMIT/OFFSET、upsert、字面量和类型名的写法
+type Dialect interface {
+	// Name 返回方言名称，如 mysql
+	Name() string
+	// Quote 引用标识符，a.b 按段分别引用，* 保持不变
+	Quote(ident string) string
+	// Placeholder 返回第 n 个（从 1 开始）参数的占位符
+	Placeholder(n int) string
+	// LimitOffset 返回 LIMIT/OFFSET 子句，带前导空格，两者均为 0 时返回空字符串
+	LimitOffset(limit, offset int) string
+	// Upsert 返回追加在 INSERT ... VALUES 之后的冲突更新子句，keys 为冲突判断列（MySQL 不需要），不支持时返回空字符串
+	Upsert(keys []string, update []string) string
+	// Literal 将值格式化为 SQL 字面量
+	Literal(v any) string
+	// TypeName 返回 Go 类型对应的列类型
+	TypeName(t reflect.Type) string
+}
+
+var (
+	// MySQL 方言
+	MySQL Dialect = mysqlDialect{}
+	// ClickHouse 方言
+	ClickHouse Dialect = clickhouseDialect{}
+	// PostgreSQL 方言
+	PostgreSQL Dialect = postgresDialect{}
+	// SQLite 方言
+	SQLite Dialect = sqliteDialect{}
+)
+
+// GetDialect 按名称返回方言，支持 mysql、clickhouse、postgres、sqlite
+func GetDialect(name string) (Dialect, error) {
+	switch strings.ToLower(name) {
+	case "mysql":
+		return MySQL, nil
+	case "clickhouse", "ck":
+		return ClickHouse, nil
+	case "postgres", "postgresql", "pg":
+		return PostgreSQL, nil
+	case "sqlite", "sqlite3":
+		return SQLite, nil
+	}
+	return nil, fmt.Errorf("unknown dialect %s", name)
+}
+
+// maxLimit 只有 OFFSET 时使用的 LIMIT
+const maxLimit = "18446744073709551615"
+
+var (
+	backslashEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+	standardEscaper  = strings.NewReplacer(`'`, `''`)
+)
+
+// quoteIdent 以 q 引用标识符的每一段，标识符中的 q 会被双写
+func quoteIdent(ident string, q string) string {
+
+	if ident == "*" || ident == "" {
+		return ident
+	}
+
+	parts := strings.Split(ident, ".")
+	for i, p := range parts {
+		if p == "*" {
+			continue
+		}
+		parts[i] = q + strings.ReplaceAll(p, q, q+q) + q
+	}
+	return strings.Join(parts, ".")
+}
+
+// limitOffset 生成 LIMIT n OFFSET m，only 为只有 OFFSET 时使用的 LIMIT，为空时省略 LIMIT
+func limitOffset(limit, offset int, only string) string {
+
+	var sb strings.Builder
+	if limit > 0 {
+		sb.WriteString(" LIMIT " + strconv.Itoa(limit))
+	} else if offset > 0 && only != "" {
+		sb.WriteString(" LIMIT " + only)
+	}
+	if offset > 0 {
+		sb.WriteString(" OFFSET " + strconv.Itoa(offset))
+	}
+	return sb.String()
+}
+
+// literal 格式化字面量，str、boolean、tm 分别处理字符串、布尔值和时间，数字直接输出
+func literal(v any, str func(string) string, boolean func(bool) string, tm func(time.Time) string) string {
+
+	switch x := v.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return str(x)
+	case []byte:
+		return str(string(x))
+	case bool:
+		return boolean(x)
+	case time.Time:
+		return tm(x)
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Pointer:
+		if rv.IsNil() {
+			return "NULL"
+		}
+		return literal(rv.Elem().Interface(), str, boolean, tm)
+	case reflect.String:
+		return str(rv.String())
+	case reflect.Bool:
+		return boolean(rv.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return fmt.Sprint(v)
+	}
+
+	return str(fmt.Sprint(v))
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// mysqlDialect MySQL 方言，字符串使用反斜杠转义
+type mysqlDialect struct{}
+
+func (mysqlDialect) Name() string { return "mysql" }
+
+func (mysqlDialect) Quote(ident string) string { return quoteIdent(ident, "`") }
+
+func (mysqlDialect) Placeholder(int) string { return "?" }
+
+func (mysqlDialect) LimitOffset(limit, offset int) string {
+	return limitOffset(limit, offset, maxLimit)
+}
+
+func (d mysqlDialect) Upsert(keys []string, update []string) string {
+	if len(update) == 0 {
+		return ""
+	}
+	sets := make([]string, len(update))
+	for i, c := range update {
+		sets[i] = fmt.Sprintf("%s = VALUES(%s)", d.Quote(c), d.Quote(c))
+	}
+	return " ON DUPLICATE KEY UPDATE " + strings.Join(sets, ", ")
+}
+
+func (mysqlDialect) Literal(v any) string {
+	return literal(v,
+		func(s string) string { return "'" + backslashEscaper.Replace(s) + "'" },
+		func(b bool) string { return strings.ToUpper(strconv.FormatBool(b)) },
+		func(t time.Time) string { return "'" + t.Format("2006-01-02 15:04:05.999999") + "'" },
+	)
+}
+
+func (d mysqlDialect) TypeName(t reflect.Type) string {
+
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t {
+	case timeType:
+		return "DATETIME"
+	case rawMessageType:
+		return "JSON"
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return "TINYINT(1)"
+	case reflect.Int8:
+		return "TINYINT"
+	case reflect.Uint8:
+		return "TINYINT UNSIGNED"
+	case reflect.Int16:
+		return "SMALLINT"
+	case reflect.Uint16:
+		return "SMALLINT UNSIGNED"
+	case reflect.Int32:
+		return "INT"
+	case reflect.Uint32:
+		return "INT UNSIGNED"
+	case reflect.Int, reflect.Int64:
+		return "BIGINT"
+	case reflect.Uint, reflect.Uint64:
+		return "BIGINT UNSIGNED"
+	case reflect.Float32:
+		return "FLOAT"
+	case reflect.Float64:
+		return "DOUBLE"
+	case reflect.String:
+		return "VARCHAR(255)"
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "BLOB"
+		}
+	}
+	return "JSON"
+}
+
+// clickhouseDialect ClickHouse 方言，不支持 upsert
+type clickhouseDialect struct{}
+
+func (clickhouseDialect) Name() string { return "clickhouse" }
+
+func (clickhouseDialect) Quote(ident string) string { return quoteIdent(ident, "`") }
+
+func (clickhouseDialect) Placeholder(int) string { return "?" }
+
+func (clickhouseDialect) LimitOffset(limit, offset int) string {
+	return limitOffset(limit, offset, maxLimit)
+}
+
+func (clickhouseDialect) Upsert(keys []string, update []string) string { return "" }
+
+func (clickhouseDialect) Literal(v any) string {
+	return literal(v,
+		func(s string) string { return "'" + backslashEscaper.Replace(s) + "'" },
+		strconv.FormatBool,
+		func(t time.Time) string { return "'" + t.Format("2006-01-02 15:04:05.999999") + "'" },
+	)
+}
+
+func (d clickhouseDialect) TypeName(t reflect.Type) string {
+
+	if t.Kind() == reflect.Pointer {
+		return "Nullable(" + d.TypeName(t.Elem()) + ")"
+	}
+
+	switch t {
+	case timeType:
+		return "DateTime64(3)"
+	case rawMessageType:
+		return "String"
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return "Bool"
+	case reflect.Int8:
+		return "Int8"
+	case reflect.Uint8:
+		return "UInt8"
+	case reflect.Int16:
+		return "Int16"
+	case reflect.Uint16:
+		return "UInt16"
+	case reflect.Int32:
+		return "Int32"
+	case reflect.Uint32:
+		return "UInt32"
+	case reflect.Int, reflect.Int64:
+		return "Int64"
+	case reflect.Uint, reflect.Uint64:
+		return "UInt64"
+	case reflect.Float32:
+		return "Float32"
+	case reflect.Float64:
+		return "Float64"
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "String"
+		}
+		return "Array(" + d.TypeName(t.Elem()) + ")"
+	case reflect.Map:
+		return "Map(" + d.TypeName(t.Key()) + ", " + d.TypeName(t.Elem()) + ")"
+	}
+	return "String"
+}
+
+// postgresDialect PostgreSQL 方言，占位符为 $n
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string { return "postgres" }
+
+func (postgresDialect) Quote(ident string) string { return quoteIdent(ident, `"`) }
+
+func (postgresDialect) Placeholder(n int) string { return "$" + strconv.Itoa(n) }
+
+func (postgresDialect) LimitOffset(limit, offset int) string { return limitOffset(limit, offset, "") }
+
+func (d postgresDialect) Upsert(keys []string, update []string) string {
+	return conflictUpsert(d, keys, update)
+}
+
+func (postgresDialect) Literal(v any) string {
+	return literal(v,
+		func(s string) string { return "'" + standardEscaper.Replace(s) + "'" },
+		func(b bool) string { return strings.ToUpper(strconv.FormatBool(b)) },
+		func(t time.Time) string { return "TIMESTAMP '" + t.Format("2006-01-02 15:04:05.999999") + "'" },
+	)
+}
+
+func (d postgresDialect) TypeName(t reflect.Type) string {
+
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t {
+	case timeType:
+		return "TIMESTAMP"
+	case rawMessageType:
+		return "JSONB"
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return "BOOLEAN"
+	case reflect.Int8, reflect.Uint8, reflect.Int16:
+		return "SMALLINT"
+	case reflect.Uint16, reflect.Int32:
+		return "INTEGER"
+	case reflect.Uint32, reflect.Int, reflect.Int64:
+		return "BIGINT"
+	case reflect.Uint, reflect.Uint64:
+		return "NUMERIC(20)"
+	case reflect.Float32:
+		return "REAL"
+	case reflect.Float64:
+		return "DOUBLE PRECISION"
+	case reflect.String:
+		return "TEXT"
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "BYTEA"
+		}
+	}
+	return "JSONB"
+}
+
+// sqliteDialect SQLite 方言，布尔值以 1、0 表示
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string { return "sqlite" }
+
+func (sqliteDialect) Quote(ident string) string { return quoteIdent(ident, `"`) }
+
+func (sqliteDialect) Placeholder(int) string { return "?" }
+
+func (sqliteDialect) LimitOffset(limit, offset int) string { return limitOffset(limit, offset, "-1") }
+
+func (d sqliteDialect) Upsert(keys []string, update []string) string {
+	return conflictUpsert(d, keys, update)
+}
+
+func (sqliteDialect) Literal(v any) string {
+	return literal(v,
+		func(s string) string { return "'" + standardEscaper.Replace(s) + "'" },
+		func(b bool) string {
+			if b {
+				return "1"
+			}
+			return "0"
+		},
+		func(t time.Time) string { return "'" + t.Format("2006-01-02 15:04:05.999999") + "'" },
+	)
+}
+
+func (sqliteDialect) TypeName(t reflect.Type) string {
+
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if t == timeType {
+		return "DATETIME"
+	}
+
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "INTEGER"
+	case reflect.Float32, reflect.Float64:
+		return "REAL"
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 && t != rawMessageType {
+			return "BLOB"
+		}
+	}
+	return "TEXT"
+}
+
+// conflictUpsert 生成 PostgreSQL、SQLite 的 ON CONFLICT 子句，没有冲突判断列或更新列时返回空字符串
+func conflictUpsert(d Dialect, keys []string, update []string) string {
+
+	if len(keys) == 0 || len(update) == 0 {
+		return ""
+	}
+
+	target := make([]string, len(keys))
+	for i, k := range keys {
+		target[i] = d.Quote(k)
+	}
+
+	sets := make([]string, len(update))
+	for i, c := range update {
+		sets[i] = fmt.Sprintf("%s = EXCLUDED.%s", d.Quote(c), d.Quote(c))
+	}
+	return " ON CONFLICT (" + strings.Join(target, ", ") + ") DO UPDATE SET " + strings.Join(sets, ", ")
+}
@@ -0,0 +1,159 @@
+package query
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Placeholder 返回第 n 个（从 1 开始）参数的占位符
+type Placeholder func(n int) string
+
+var (
+	// QuestionPlaceholder MySQL、ClickHouse、SQLite 使用的 ? 占位符
+	QuestionPlaceholder Placeholder = func(int) string { return "?" }
+	// DollarPlaceholder PostgreSQL 使用的 $1、$2 ... 占位符
+	DollarPlaceholder Placeholder = func(n int) string { return "$" + strconv.Itoa(n) }
+)
+
+// expr SQL 片段及其参数，parts 比 args 多一个，参数位于相邻片段之间。
+// 参数为 *SQLBuilder 时作为子查询展开，为 nested 时作为条件展开。
+type expr struct {
+	parts []string
+	args  []any
+}
+
+func rawExpr(s string) expr {
+	return expr{parts: []string{s}}
+}
+
+// clauseExpr 将 clause 放入括号中作为参数化条件，避免其中的 OR 与其他条件的 AND 混淆
+func clauseExpr(clause string, args ...any) expr {
+	return argExpr("("+clause+")", args...)
+}
+
+// argExpr 将 sql 中引号外的 ? 视为参数位置
+func argExpr(sql string, args ...any) expr {
+
+	if len(args) == 0 {
+		return rawExpr(sql)
+	}
+
+	var (
+		e     expr
+		quote byte
+		last  int
+	)
+
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '?' && len(e.args) < len(args):
+			e.parts = append(e.parts, sql[last:i])
+			e.args = append(e.args, args[len(e.args)])
+			last = i + 1
+		}
+	}
+	e.parts = append(e.parts, sql[last:])
+
+	return e
+}
+
+// sqlWriter 拼接 SQL 并收集参数，ph 为 nil 时参数以字面量写入，d 不为 nil 时按方言写入字面量和 LIMIT/OFFSET
+type sqlWriter struct {
+	sb   strings.Builder
+	args []any
+	ph   Placeholder
+	d    Dialect
+}
+
+func (w *sqlWriter) write(s ...string) {
+	for _, v := range s {
+		w.sb.WriteString(v)
+	}
+}
+
+func (w *sqlWriter) expr(e expr) {
+	for i, p := range e.parts {
+		w.sb.WriteString(p)
+		if i < len(e.args) {
+			w.arg(e.args[i])
+		}
+	}
+}
+
+func (w *sqlWriter) arg(v any) {
+
+	switch x := v.(type) {
+	case *SQLBuilder:
+		x.writeTo(w)
+		return
+	case nested:
+		writeNested(w, x.c)
+		return
+	}
+
+	if w.ph == nil {
+		if _, ok := v.(rowArg); ok {
+			w.sb.WriteString("?")
+		} else if w.d != nil {
+			w.sb.WriteString(w.d.Literal(v))
+		} else {
+			w.sb.WriteString(Literal(v))
+		}
+		return
+	}
+
+	w.args = append(w.args, v)
+	w.sb.WriteString(w.ph(len(w.args)))
+}
+
+// Literal 将值格式化为 MySQL 字面量，与 MySQL.Literal 相同，字符串中的 \ 和 ' 会被转义
+func Literal(v any) string {
+	return MySQL.Literal(v)
+}
+
+// listArgs 将切片展开为参数列表，不是切片时返回 nil
+func listArgs(values any) ([]any, bool) {
+
+	rv := reflect.ValueOf(values)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, false
+	}
+	if rv.Type().Elem().Kind() == reflect.Uint8 {
+		return nil, false
+	}
+
+	res := make([]any, rv.Len())
+	for i := range res {
+		res[i] = rv.Index(i).Interface()
+	}
+	return res, true
+}
+
+// inExpr 生成 field IN (?, ?, ...)，列表为空时 IN 生成恒假的 1 = 0，NOT IN 生成恒真的 1 = 1
+func inExpr(field string, op string, values []any) expr {
+
+	if len(values) == 0 {
+		if op == "NOT IN" {
+			return rawExpr("1 = 1")
+		}
+		return rawExpr("1 = 0")
+	}
+
+	e := expr{parts: []string{field + " " + op + " ("}, args: values}
+	for i := 1; i < len(values); i++ {
+		e.parts = append(e.parts, ", ")
+	}
+	e.parts = append(e.parts, ")")
+
+	return e
+}
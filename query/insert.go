@@ -13,6 +13,8 @@ type SqlInsert interface {
 	AddValues(vals ...[]any)
 	Build() (string, []any)
 	Clear()
+	// Clone 返回不含数据的副本，用于并发写入时每批单独构建语句
+	Clone() SqlInsert
 }
 
 type CKInsert struct {
@@ -39,8 +41,16 @@ func (c *CKInsert) AddValues(vals ...[]any) {
 
 }
 
+func (c *CKInsert) Clone() SqlInsert {
+	return &CKInsert{
+		TableName: c.TableName,
+		Columns:   append([]string{}, c.Columns...),
+	}
+}
+
+// Build 生成 ClickHouse 批量写入使用的语句，数据由驱动按行追加
 func (c *CKInsert) Build() (string, []any) {
-	return fmt.Sprintf("INSERT INTO %s (%s) ", c.TableName, strings.Join(c.Columns, ", ")), nil
+	return NewInsert(ClickHouse, c.TableName).AddColumn(c.Columns...).Build()
 }
 
 type MysqlInsert struct {
@@ -112,7 +122,7 @@ func (m *MysqlInsert) Build() (string, []any) {
 	if (len(m.Columns) == 1 && m.Columns[0] == "*") || len(m.Columns) == 0 {
 		builder.WriteString(fmt.Sprintf(" INTO %s VALUES ", m.TableName))
 	} else {
-		builder.WriteString(fmt.Sprintf(" INTO `%s` (`%s`) VALUES ", m.TableName, strings.Join(m.Columns, "`, `")))
+		builder.WriteString(fmt.Sprintf(" INTO %s (%s) VALUES ", MySQL.Quote(m.TableName), quoteColumns(MySQL, m.Columns)))
 	}
 
 	var perch string
@@ -127,20 +137,126 @@ func (m *MysqlInsert) Build() (string, []any) {
 		builder.WriteString(strings.Join(array.Repeat(perch, max(len(m.InsertValues), 1)), ", "))
 	}
 
-	if m.IsUpdate && len(m.UpdateColumns) > 0 {
-		builder.WriteString(" ON DUPLICATE KEY UPDATE ")
+	if m.IsUpdate {
+		builder.WriteString(MySQL.Upsert(nil, m.UpdateColumns))
+	}
 
-		var updateStrings []string
-		for _, col := range m.UpdateColumns {
-			updateStrings = append(updateStrings, fmt.Sprintf("`%s` = VALUES(`%s`)", col, col))
-		}
+	return builder.String(), op.Concat(m.InsertValues...)
+}
+
+func (m *MysqlInsert) Clear() {
+	m.InsertValues = [][]any{}
+}
+
+func (m *MysqlInsert) Clone() SqlInsert {
+	c := *m
+	c.Columns = append([]string{}, m.Columns...)
+	c.UpdateColumns = append([]string{}, m.UpdateColumns...)
+	c.InsertValues = nil
+	return &c
+}
+
+// Insert 按方言构建 INSERT 语句，实现 SqlInsert，可用于 DB.Insert 和 CK.Insert
+type Insert struct {
+	TableName     string
+	Columns       []string
+	UpdateColumns []string
+	ConflictKeys  []string
+	InsertValues  [][]any
+	Dialect       Dialect
+}
 
-		builder.WriteString(strings.Join(updateStrings, ", "))
+// NewInsert 创建 Insert，d 为 nil 时使用 MySQL 方言
+func NewInsert(d Dialect, tableName string) *Insert {
+	if d == nil {
+		d = MySQL
+	}
+	return &Insert{
+		TableName: tableName,
+		Dialect:   d,
 	}
+}
+
+func (m *Insert) AddColumn(col ...string) *Insert {
+	m.Columns = append(m.Columns, col...)
+	return m
+}
+
+// AddUpdateColumn 添加冲突时更新的列，生成的子句由方言决定，ClickHouse 不支持
+func (m *Insert) AddUpdateColumn(col ...string) *Insert {
+	m.UpdateColumns = append(m.UpdateColumns, col...)
+	return m
+}
+
+// SetConflict 设置冲突判断列，PostgreSQL、SQLite 的 upsert 需要指定
+func (m *Insert) SetConflict(keys ...string) *Insert {
+	m.ConflictKeys = keys
+	return m
+}
+
+func (m *Insert) AddValues(vals ...[]any) {
+	m.InsertValues = append(m.InsertValues, vals...)
+}
+
+func (m *Insert) AddValue(vals ...any) *Insert {
+	m.InsertValues = append(m.InsertValues, vals)
+	return m
+}
+
+// Build 生成 INSERT 语句及参数，没有数据时生成一行占位符，用于预编译
+func (m *Insert) Build() (string, []any) {
+
+	var builder strings.Builder
+
+	builder.WriteString("INSERT INTO " + m.Dialect.Quote(m.TableName))
+	if len(m.Columns) > 0 && !(len(m.Columns) == 1 && m.Columns[0] == "*") {
+		builder.WriteString(" (" + quoteColumns(m.Dialect, m.Columns) + ")")
+	}
+	builder.WriteString(" VALUES ")
+
+	width := len(m.Columns)
+	if len(m.InsertValues) > 0 {
+		width = len(m.InsertValues[0])
+	}
+
+	n := 0
+	for i := 0; i < max(len(m.InsertValues), 1); i++ {
+		if i > 0 {
+			builder.WriteString(", ")
+		}
+		builder.WriteString("(")
+		for j := 0; j < width; j++ {
+			if j > 0 {
+				builder.WriteString(", ")
+			}
+			n++
+			builder.WriteString(m.Dialect.Placeholder(n))
+		}
+		builder.WriteString(")")
+	}
+
+	builder.WriteString(m.Dialect.Upsert(m.ConflictKeys, m.UpdateColumns))
 
 	return builder.String(), op.Concat(m.InsertValues...)
 }
 
-func (m *MysqlInsert) Clear() {
+func (m *Insert) Clear() {
 	m.InsertValues = [][]any{}
 }
+
+func (m *Insert) Clone() SqlInsert {
+	c := *m
+	c.Columns = append([]string{}, m.Columns...)
+	c.UpdateColumns = append([]string{}, m.UpdateColumns...)
+	c.ConflictKeys = append([]string{}, m.ConflictKeys...)
+	c.InsertValues = nil
+	return &c
+}
+
+func quoteColumns(d Dialect, cols []string) string {
+	res := make([]string, len(cols))
+	for i, c := range cols {
+		res[i] = d.Quote(c)
+	}
+	return strings.Join(res, ", ")
+}
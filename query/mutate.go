@@ -0,0 +1,265 @@
+package query
+
+import (
+	"fmt"
+)
+
+// Mutation UPDATE、DELETE 语句，由 UpdateBuilder、DeleteBuilder 实现
+type Mutation interface {
+	Build() string
+	BuildArgs() (string, []any)
+	BuildArgsFor(d Dialect) (string, []any)
+}
+
+// rowArg 按行绑定的参数，执行时由 BindRow 替换为每行数据中第 i 个值
+type rowArg struct {
+	i int
+}
+
+// BindRow 将 args 中按行绑定的参数替换为 row 中对应的值，其余参数保持不变
+func BindRow(args []any, row []any) ([]any, error) {
+
+	res := make([]any, len(args))
+	for i, v := range args {
+		r, ok := v.(rowArg)
+		if !ok {
+			res[i] = v
+			continue
+		}
+		if r.i >= len(row) {
+			return nil, fmt.Errorf("row has %d values, need at least %d", len(row), r.i+1)
+		}
+		res[i] = row[r.i]
+	}
+	return res, nil
+}
+
+func isClickHouse(d Dialect) bool {
+	return d != nil && d.Name() == ClickHouse.Name()
+}
+
+// mutation UpdateBuilder 与 DeleteBuilder 共用的表名、条件和方言
+type mutation struct {
+	tableName    string
+	whereClauses []expr
+	dialect      Dialect
+	rowArgs      int
+}
+
+func (m *mutation) keys(cols []string) {
+	for _, c := range cols {
+		m.whereClauses = append(m.whereClauses, expr{parts: []string{c + " = ", ""}, args: []any{rowArg{m.rowArgs}}})
+		m.rowArgs++
+	}
+}
+
+func (m *mutation) build(d Dialect, write func(w *sqlWriter, d Dialect)) (string, []any) {
+
+	if m.dialect != nil {
+		d = m.dialect
+	}
+
+	ph := QuestionPlaceholder
+	if d != nil {
+		ph = d.Placeholder
+	}
+
+	w := &sqlWriter{ph: ph, d: d}
+	write(w, d)
+
+	return w.sb.String(), w.args
+}
+
+func (m *mutation) writeWhere(w *sqlWriter, required bool) {
+	if len(m.whereClauses) == 0 {
+		if required {
+			w.write(" WHERE 1")
+		}
+		return
+	}
+	writeConds(w, " WHERE ", m.whereClauses)
+}
+
+// UpdateBuilder 用于构建 UPDATE 语句，ClickHouse 方言下生成 ALTER TABLE ... UPDATE
+type UpdateBuilder struct {
+	mutation
+	sets []expr
+}
+
+// NewUpdateBuilder 返回一个新的 UpdateBuilder 实例
+func NewUpdateBuilder(tableName string) *UpdateBuilder {
+	return &UpdateBuilder{mutation: mutation{tableName: tableName}}
+}
+
+// Dialect 方法用于指定方言
+func (ub *UpdateBuilder) Dialect(d Dialect) *UpdateBuilder {
+	ub.dialect = d
+	return ub
+}
+
+// Set 方法用于设置列的值，value 作为参数
+func (ub *UpdateBuilder) Set(col string, value any) *UpdateBuilder {
+	ub.sets = append(ub.sets, expr{parts: []string{col + " = ", ""}, args: []any{value}})
+	return ub
+}
+
+// SetExpr 方法用于以表达式设置列的值，如 SetExpr("n", "n + ?", 1)
+func (ub *UpdateBuilder) SetExpr(col string, sql string, args ...any) *UpdateBuilder {
+	e := argExpr(sql, args...)
+	e.parts[0] = col + " = " + e.parts[0]
+	ub.sets = append(ub.sets, e)
+	return ub
+}
+
+// Columns 方法用于添加按行绑定的列，值在执行时由每行数据提供，见 DB.UpdateBatch
+func (ub *UpdateBuilder) Columns(cols ...string) *UpdateBuilder {
+	for _, c := range cols {
+		ub.sets = append(ub.sets, expr{parts: []string{c + " = ", ""}, args: []any{rowArg{ub.rowArgs}}})
+		ub.rowArgs++
+	}
+	return ub
+}
+
+// Keys 方法用于添加按行绑定的主键条件 key = ?，每行数据中的值按 Columns、Keys 的调用顺序排列
+func (ub *UpdateBuilder) Keys(cols ...string) *UpdateBuilder {
+	ub.keys(cols)
+	return ub
+}
+
+// Where 方法用于添加 WHERE 子句条件
+func (ub *UpdateBuilder) Where(clauses ...string) *UpdateBuilder {
+	for _, c := range clauses {
+		ub.whereClauses = append(ub.whereClauses, rawExpr(c))
+	}
+	return ub
+}
+
+// WhereArgs 方法用于添加带参数的 WHERE 子句条件，args 对应 clause 中引号外的 ? 占位符
+func (ub *UpdateBuilder) WhereArgs(clause string, args ...any) *UpdateBuilder {
+	ub.whereClauses = append(ub.whereClauses, clauseExpr(clause, args...))
+	return ub
+}
+
+// WhereCond 方法用于添加条件表达式到 WHERE 子句，多个条件以 AND 连接
+func (ub *UpdateBuilder) WhereCond(conds ...Cond) *UpdateBuilder {
+	for _, c := range conds {
+		ub.whereClauses = append(ub.whereClauses, condExpr(c))
+	}
+	return ub
+}
+
+// Build 方法用于构建 UPDATE 语句，参数以字面量的形式写入语句中，按行绑定的参数写为 ?
+func (ub *UpdateBuilder) Build() string {
+	w := &sqlWriter{d: ub.dialect}
+	ub.writeTo(w, ub.dialect)
+	return w.sb.String()
+}
+
+// BuildArgs 方法用于构建参数化的 UPDATE 语句
+func (ub *UpdateBuilder) BuildArgs() (string, []any) {
+	return ub.BuildArgsFor(nil)
+}
+
+// BuildArgsFor 方法与 BuildArgs 相同，没有通过 Dialect 指定方言时使用 d
+func (ub *UpdateBuilder) BuildArgsFor(d Dialect) (string, []any) {
+	return ub.build(d, ub.writeTo)
+}
+
+func (ub *UpdateBuilder) writeTo(w *sqlWriter, d Dialect) {
+
+	if isClickHouse(d) {
+		w.write("ALTER TABLE ", ub.tableName, " UPDATE ")
+	} else {
+		w.write("UPDATE ", ub.tableName, " SET ")
+	}
+
+	for i, s := range ub.sets {
+		if i > 0 {
+			w.write(", ")
+		}
+		w.expr(s)
+	}
+
+	ub.writeWhere(w, isClickHouse(d))
+}
+
+// DeleteBuilder 用于构建 DELETE 语句，ClickHouse 方言下默认生成 ALTER TABLE ... DELETE
+type DeleteBuilder struct {
+	mutation
+	lightweight bool
+}
+
+// NewDeleteBuilder 返回一个新的 DeleteBuilder 实例
+func NewDeleteBuilder(tableName string) *DeleteBuilder {
+	return &DeleteBuilder{mutation: mutation{tableName: tableName}}
+}
+
+// Dialect 方法用于指定方言
+func (del *DeleteBuilder) Dialect(d Dialect) *DeleteBuilder {
+	del.dialect = d
+	return del
+}
+
+// Lightweight 方法用于在 ClickHouse 方言下生成轻量删除 DELETE FROM，而不是 ALTER TABLE ... DELETE
+func (del *DeleteBuilder) Lightweight(b bool) *DeleteBuilder {
+	del.lightweight = b
+	return del
+}
+
+// Keys 方法用于添加按行绑定的主键条件 key = ?，值在执行时由每行数据提供，见 DB.UpdateBatch
+func (del *DeleteBuilder) Keys(cols ...string) *DeleteBuilder {
+	del.keys(cols)
+	return del
+}
+
+// Where 方法用于添加 WHERE 子句条件
+func (del *DeleteBuilder) Where(clauses ...string) *DeleteBuilder {
+	for _, c := range clauses {
+		del.whereClauses = append(del.whereClauses, rawExpr(c))
+	}
+	return del
+}
+
+// WhereArgs 方法用于添加带参数的 WHERE 子句条件，args 对应 clause 中引号外的 ? 占位符
+func (del *DeleteBuilder) WhereArgs(clause string, args ...any) *DeleteBuilder {
+	del.whereClauses = append(del.whereClauses, clauseExpr(clause, args...))
+	return del
+}
+
+// WhereCond 方法用于添加条件表达式到 WHERE 子句，多个条件以 AND 连接
+func (del *DeleteBuilder) WhereCond(conds ...Cond) *DeleteBuilder {
+	for _, c := range conds {
+		del.whereClauses = append(del.whereClauses, condExpr(c))
+	}
+	return del
+}
+
+// Build 方法用于构建 DELETE 语句，参数以字面量的形式写入语句中，按行绑定的参数写为 ?
+func (del *DeleteBuilder) Build() string {
+	w := &sqlWriter{d: del.dialect}
+	del.writeTo(w, del.dialect)
+	return w.sb.String()
+}
+
+// BuildArgs 方法用于构建参数化的 DELETE 语句
+func (del *DeleteBuilder) BuildArgs() (string, []any) {
+	return del.BuildArgsFor(nil)
+}
+
+// BuildArgsFor 方法与 BuildArgs 相同，没有通过 Dialect 指定方言时使用 d
+func (del *DeleteBuilder) BuildArgsFor(d Dialect) (string, []any) {
+	return del.build(d, del.writeTo)
+}
+
+func (del *DeleteBuilder) writeTo(w *sqlWriter, d Dialect) {
+
+	ck := isClickHouse(d)
+
+	if ck && !del.lightweight {
+		w.write("ALTER TABLE ", del.tableName, " DELETE")
+	} else {
+		w.write("DELETE FROM ", del.tableName)
+	}
+
+	del.writeWhere(w, ck)
+}
@@ -0,0 +1,528 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// TokenKind 词法单元的类型
+type TokenKind int
+
+const (
+	TokenIdent       TokenKind = iota // 标识符或关键字
+	TokenQuotedIdent                  // 以 ` 或 " 引用的标识符，Text 为去掉引号后的名称
+	TokenString                       // 字符串字面量，Text 包含引号
+	TokenNumber                       // 数字
+	TokenPlaceholder                  // 参数占位符 ? 或 $n
+	TokenSymbol                       // 括号、逗号、运算符等
+)
+
+// Token 词法单元，Pos、End 为在原语句中的字节位置
+type Token struct {
+	Kind TokenKind
+	Text string
+	Pos  int
+	End  int
+}
+
+// Is 判断是否为指定关键字，忽略大小写
+func (t Token) Is(keyword string) bool {
+	return t.Kind == TokenIdent && strings.EqualFold(t.Text, keyword)
+}
+
+// ParseError 解析错误，Pos 为出错位置
+type ParseError struct {
+	Pos int
+	Msg string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("sql parse error at %d: %s", e.Pos, e.Msg)
+}
+
+// Tokenize 将 SQL 语句切分为词法单元，忽略空白和注释。
+// 支持 '...' 字符串（以反斜杠转义或双写单引号）、`...` 和 "..." 引用的标识符、-- 和 /* */ 注释。
+func Tokenize(sql string) ([]Token, error) {
+
+	var tokens []Token
+
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		start := i
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			i++
+			continue
+
+		case c == '-' && i+1 < len(sql) && sql[i+1] == '-':
+			for i < len(sql) && sql[i] != '\n' {
+				i++
+			}
+			continue
+
+		case c == '/' && i+1 < len(sql) && sql[i+1] == '*':
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				return nil, &ParseError{Pos: start, Msg: "unterminated comment"}
+			}
+			i += end + 4
+			continue
+
+		case c == '\'':
+			i++
+			for {
+				if i >= len(sql) {
+					return nil, &ParseError{Pos: start, Msg: "unterminated string"}
+				}
+				if sql[i] == '\\' {
+					i += 2
+					continue
+				}
+				if sql[i] == '\'' {
+					if i+1 < len(sql) && sql[i+1] == '\'' {
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				i++
+			}
+			tokens = append(tokens, Token{Kind: TokenString, Text: sql[start:i], Pos: start, End: i})
+
+		case c == '`' || c == '"':
+			i++
+			var name strings.Builder
+			for {
+				if i >= len(sql) {
+					return nil, &ParseError{Pos: start, Msg: "unterminated quoted identifier"}
+				}
+				if sql[i] == c {
+					if i+1 < len(sql) && sql[i+1] == c {
+						name.WriteByte(c)
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				name.WriteByte(sql[i])
+				i++
+			}
+			tokens = append(tokens, Token{Kind: TokenQuotedIdent, Text: name.String(), Pos: start, End: i})
+
+		case c == '?':
+			i++
+			tokens = append(tokens, Token{Kind: TokenPlaceholder, Text: "?", Pos: start, End: i})
+
+		case c == '$' && i+1 < len(sql) && sql[i+1] >= '0' && sql[i+1] <= '9':
+			i++
+			for i < len(sql) && sql[i] >= '0' && sql[i] <= '9' {
+				i++
+			}
+			tokens = append(tokens, Token{Kind: TokenPlaceholder, Text: sql[start:i], Pos: start, End: i})
+
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(sql) && sql[i+1] >= '0' && sql[i+1] <= '9':
+			for i < len(sql) && (isIdentByte(sql[i]) || sql[i] == '.' ||
+				(sql[i] == '+' || sql[i] == '-') && (sql[i-1] == 'e' || sql[i-1] == 'E')) {
+				i++
+			}
+			tokens = append(tokens, Token{Kind: TokenNumber, Text: sql[start:i], Pos: start, End: i})
+
+		case isIdentByte(c) || c >= utf8.RuneSelf:
+			for i < len(sql) {
+				if sql[i] < utf8.RuneSelf {
+					if !isIdentByte(sql[i]) && sql[i] != '$' {
+						break
+					}
+					i++
+					continue
+				}
+				r, n := utf8.DecodeRuneInString(sql[i:])
+				if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+					break
+				}
+				i += n
+			}
+			if i == start {
+				return nil, &ParseError{Pos: start, Msg: fmt.Sprintf("unexpected character %q", sql[start])}
+			}
+			tokens = append(tokens, Token{Kind: TokenIdent, Text: sql[start:i], Pos: start, End: i})
+
+		default:
+			i++
+			tokens = append(tokens, Token{Kind: TokenSymbol, Text: sql[start:i], Pos: start, End: i})
+		}
+	}
+
+	return tokens, nil
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// selectInfo 最外层 SELECT 语句的结构
+type selectInfo struct {
+	tokens  []Token
+	depth   []int // 每个词法单元所在的括号深度
+	ctes    []string
+	selectI int // 最外层 SELECT 的位置
+	fromI   int // 最外层 FROM 的位置，没有时为 -1
+	orderI  int // 最外层 ORDER BY 的位置，没有时为 -1
+	complex bool
+}
+
+// 出现在最外层时计数需要包装为子查询的关键字
+var wrapKeywords = []string{
+	"DISTINCT", "GROUP", "HAVING", "UNION", "INTERSECT", "EXCEPT",
+	"LIMIT", "OFFSET", "FETCH", "WINDOW", "QUALIFY", "TOTALS",
+}
+
+func parseSelect(sql string) (*selectInfo, error) {
+
+	tokens, err := Tokenize(sql)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &selectInfo{tokens: tokens, depth: make([]int, len(tokens)), selectI: -1, fromI: -1, orderI: -1}
+
+	depth := 0
+	for i, t := range tokens {
+		if t.Kind == TokenSymbol && t.Text == ")" {
+			depth--
+			if depth < 0 {
+				return nil, &ParseError{Pos: t.Pos, Msg: "unbalanced parenthesis"}
+			}
+		}
+		info.depth[i] = depth
+		if t.Kind == TokenSymbol && t.Text == "(" {
+			depth++
+		}
+	}
+	if depth != 0 {
+		return nil, &ParseError{Pos: len(sql), Msg: "unbalanced parenthesis"}
+	}
+
+	for i, t := range tokens {
+		if info.depth[i] != 0 {
+			continue
+		}
+
+		switch {
+		case t.Is("SELECT"):
+			if info.selectI < 0 {
+				info.selectI = i
+			} else {
+				// UNION 等连接的后续查询
+				info.complex = true
+			}
+		case info.selectI < 0:
+			// WITH name [(cols)] AS (...) 中的公用表表达式名称
+			if isName(t) && i+2 < len(tokens) {
+				j := i + 1
+				if tokens[j].Text == "(" && tokens[j].Kind == TokenSymbol {
+					for j < len(tokens) && !(info.depth[j] == 0 && tokens[j].Text == ")") {
+						j++
+					}
+					j++
+				}
+				if j+1 < len(tokens) && tokens[j].Is("AS") && tokens[j+1].Text == "(" {
+					info.ctes = append(info.ctes, t.Text)
+				}
+			}
+		case t.Is("FROM") && info.fromI < 0:
+			info.fromI = i
+		case t.Is("ORDER") && i+1 < len(tokens) && tokens[i+1].Is("BY") && info.orderI < 0:
+			info.orderI = i
+		default:
+			for _, k := range wrapKeywords {
+				if t.Is(k) {
+					info.complex = true
+				}
+			}
+		}
+	}
+
+	if info.selectI < 0 {
+		return nil, &ParseError{Pos: 0, Msg: "not a SELECT statement"}
+	}
+
+	return info, nil
+}
+
+func isName(t Token) bool {
+	return t.Kind == TokenIdent || t.Kind == TokenQuotedIdent
+}
+
+func hasPlaceholder(tokens []Token) bool {
+	for _, t := range tokens {
+		if t.Kind == TokenPlaceholder {
+			return true
+		}
+	}
+	return false
+}
+
+// 聚合函数名前缀，出现在最外层字段列表中时计数需要包装为子查询，多包装一层不影响结果
+var aggregatePrefixes = []string{
+	"count", "sum", "avg", "min", "max", "any", "uniq", "group", "arg", "quantile", "median",
+	"stddev", "var", "covar", "corr", "topk", "bit_", "json_arrayagg", "json_objectagg",
+	"string_agg", "array_agg", "bool_", "every",
+}
+
+// hasAggregate 判断字段列表中是否调用了聚合函数，标量子查询中的调用不计入
+func hasAggregate(tokens []Token) bool {
+
+	// 每层括号是否为子查询
+	var stack []bool
+	inSub := func() bool {
+		for _, b := range stack {
+			if b {
+				return true
+			}
+		}
+		return false
+	}
+
+	for i, t := range tokens {
+		if t.Kind == TokenSymbol {
+			switch t.Text {
+			case "(":
+				stack = append(stack, i+1 < len(tokens) && tokens[i+1].Is("SELECT"))
+			case ")":
+				if len(stack) > 0 {
+					stack = stack[:len(stack)-1]
+				}
+			}
+			continue
+		}
+
+		if t.Kind != TokenIdent || i+1 >= len(tokens) || tokens[i+1].Text != "(" || inSub() {
+			continue
+		}
+		name := strings.ToLower(t.Text)
+		for _, p := range aggregatePrefixes {
+			if strings.HasPrefix(name, p) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// CountQuery 将 SELECT 语句改写为计数语句，保留原语句中的字面量和大小写，计数使用 ClickHouse 的 count()，
+// 其他数据库请使用 CountQueryFor。
+// 简单查询直接将最外层的字段列表替换为 count() 并去掉 ORDER BY；
+// 含 DISTINCT、GROUP BY、HAVING、UNION、LIMIT 或聚合函数等的查询改写为 SELECT count() FROM (<原语句>) AS _t。
+// 被去掉的部分含有参数占位符时同样包装为子查询，以保证参数顺序不变。
+func CountQuery(sql string) (string, error) {
+
+	return countQuery(sql, "count()")
+}
+
+// CountQueryFor 与 CountQuery 相同，ClickHouse 使用 count()，其他方言使用 count(*)，d 为 nil 时使用 count(*)
+func CountQueryFor(sql string, d Dialect) (string, error) {
+
+	if d != nil && d.Name() == ClickHouse.Name() {
+		return countQuery(sql, "count()")
+	}
+
+	return countQuery(sql, "count(*)")
+}
+
+func countQuery(sql string, count string) (string, error) {
+
+	info, err := parseSelect(sql)
+	if err != nil {
+		return "", err
+	}
+
+	trimmed := strings.TrimRight(strings.TrimSpace(sql), ";")
+	wrap := "SELECT " + count + " FROM (" + trimmed + ") AS _t"
+
+	if info.complex || info.fromI < 0 || hasAggregate(info.tokens[info.selectI+1:info.fromI]) {
+		return wrap, nil
+	}
+
+	tokens := info.tokens
+
+	// ORDER BY 一直到 SETTINGS、FORMAT 或语句结束
+	orderEnd := len(tokens)
+	if info.orderI >= 0 {
+		for j := info.orderI; j < len(tokens); j++ {
+			if info.depth[j] == 0 && (tokens[j].Is("SETTINGS") || tokens[j].Is("FORMAT") || tokens[j].Text == ";") {
+				orderEnd = j
+				break
+			}
+		}
+	}
+
+	if hasPlaceholder(tokens[info.selectI:info.fromI]) ||
+		info.orderI >= 0 && hasPlaceholder(tokens[info.orderI:orderEnd]) {
+		return wrap, nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString(sql[:tokens[info.selectI].End])
+	sb.WriteString(" " + count + " ")
+	if info.orderI < 0 {
+		sb.WriteString(sql[tokens[info.fromI].Pos:])
+	} else {
+		sb.WriteString(strings.TrimRight(sql[tokens[info.fromI].Pos:tokens[info.orderI].Pos], " \t\r\n"))
+		if orderEnd < len(tokens) {
+			sb.WriteString(" " + sql[tokens[orderEnd].Pos:])
+		}
+	}
+
+	return strings.TrimRight(strings.TrimSpace(sb.String()), ";"), nil
+}
+
+// HasOrderOrLimit 判断 SELECT 语句的最外层是否包含 ORDER BY、LIMIT、OFFSET 或 FETCH，子查询中的不计入
+func HasOrderOrLimit(sql string) (bool, error) {
+
+	info, err := parseSelect(sql)
+	if err != nil {
+		return false, err
+	}
+	if info.orderI >= 0 {
+		return true, nil
+	}
+
+	for i, t := range info.tokens {
+		if info.depth[i] == 0 && (t.Is("LIMIT") || t.Is("OFFSET") || t.Is("FETCH")) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// 表名之后不能作为别名的关键字
+var notAlias = map[string]bool{
+	"WHERE": true, "JOIN": true, "LEFT": true, "RIGHT": true, "INNER": true, "OUTER": true, "FULL": true,
+	"CROSS": true, "NATURAL": true, "ON": true, "USING": true, "GROUP": true, "ORDER": true, "LIMIT": true,
+	"HAVING": true, "UNION": true, "INTERSECT": true, "EXCEPT": true, "FINAL": true, "SAMPLE": true,
+	"PREWHERE": true, "ARRAY": true, "SETTINGS": true, "FORMAT": true, "WINDOW": true, "OFFSET": true,
+	"GLOBAL": true, "ANY": true, "ALL": true, "ASOF": true, "SEMI": true, "ANTI": true, "FOR": true,
+	"STRAIGHT_JOIN": true, "LATERAL": true, "PASTE": true,
+}
+
+// ExtractTables 返回 SELECT 语句中引用的所有表，包括 JOIN、子查询和公用表表达式中的表，
+// 公用表表达式本身的名称和表函数不包括在内，结果按出现顺序去重，库名与表名以 . 连接。
+func ExtractTables(sql string) ([]string, error) {
+
+	info, err := parseSelect(sql)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := info.tokens
+
+	ctes := map[string]bool{}
+	for i, t := range tokens {
+		// 子查询中的 WITH 同样需要排除
+		if t.Is("AS") && i > 0 && isName(tokens[i-1]) && i+1 < len(tokens) && tokens[i+1].Text == "(" {
+			j := i - 1
+			if j > 0 && (tokens[j-1].Is("WITH") || tokens[j-1].Is("RECURSIVE") || tokens[j-1].Text == ",") {
+				ctes[strings.ToLower(tokens[j].Text)] = true
+			}
+		}
+	}
+	for _, c := range info.ctes {
+		ctes[strings.ToLower(c)] = true
+	}
+
+	var (
+		res  []string
+		seen = map[string]bool{}
+	)
+
+	// readTable 读取 i 处的表名，返回表名之后的位置
+	readTable := func(i int) int {
+
+		if i >= len(tokens) || !isName(tokens[i]) {
+			return i
+		}
+
+		parts := []string{tokens[i].Text}
+		for i+2 < len(tokens) && tokens[i+1].Text == "." && tokens[i+1].Kind == TokenSymbol && isName(tokens[i+2]) {
+			parts = append(parts, tokens[i+2].Text)
+			i += 2
+		}
+		i++
+
+		// 表函数，如 numbers(10)
+		if i < len(tokens) && tokens[i].Text == "(" && tokens[i].Kind == TokenSymbol {
+			return i
+		}
+
+		name := strings.Join(parts, ".")
+		if len(parts) == 1 && ctes[strings.ToLower(name)] {
+			return i
+		}
+		if !seen[name] {
+			seen[name] = true
+			res = append(res, name)
+		}
+		return i
+	}
+
+	// selects 记录每一层括号中是否出现过 SELECT，只有查询中的 FROM 才是数据源，排除 EXTRACT(x FROM y) 等
+	selects := []bool{false}
+
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+
+		switch {
+		case t.Kind == TokenSymbol && t.Text == "(":
+			selects = append(selects, false)
+			continue
+		case t.Kind == TokenSymbol && t.Text == ")":
+			selects = selects[:len(selects)-1]
+			continue
+		case t.Is("SELECT"):
+			selects[len(selects)-1] = true
+			continue
+		}
+
+		if !selects[len(selects)-1] || !(t.Is("FROM") || t.Is("JOIN")) {
+			continue
+		}
+
+		j := readTable(i + 1)
+		if !t.Is("FROM") {
+			continue
+		}
+
+		// FROM a, b AS x, (subquery) y, c
+		depth := info.depth[i]
+		for j < len(tokens) {
+			if tokens[j].Kind == TokenSymbol && tokens[j].Text == "(" {
+				j++
+				for j < len(tokens) && info.depth[j] > depth {
+					j++
+				}
+				j++
+			}
+			if j < len(tokens) && tokens[j].Is("AS") {
+				j++
+			}
+			if j < len(tokens) && isName(tokens[j]) && !notAlias[strings.ToUpper(tokens[j].Text)] {
+				j++
+			}
+			if j+1 < len(tokens) && info.depth[j] == depth && tokens[j].Text == "," && tokens[j].Kind == TokenSymbol {
+				j = readTable(j + 1)
+				continue
+			}
+			break
+		}
+	}
+
+	return res, nil
+}
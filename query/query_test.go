@@ -2,8 +2,12 @@ package query_test
 
 import (
 	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/frankill/gotools/db"
 	"github.com/frankill/gotools/query"
 )
 
@@ -153,3 +157,410 @@ func TestSQLBuilder_Build(t *testing.T) {
 		})
 	}
 }
+
+func TestSQLBuilder_BuildArgs(t *testing.T) {
+	sub := query.NewSQLBuilder().Select("user_id").From("permissions").Eq("role", "admin")
+
+	b := query.NewSQLBuilder().
+		Select("id", "name").
+		From("users").
+		Eq("name", "O'Brien").
+		In("status", []int{1, 2}).
+		In("id", sub).
+		Between("age", 18, 30).
+		WhereArgs("tag = ? OR note = '?'", "x")
+
+	sql, args := b.BuildArgs()
+	expected := "SELECT id, name FROM users WHERE name = ? AND status IN (?, ?) AND id IN (SELECT user_id FROM permissions WHERE role = ?) AND age BETWEEN ? AND ? AND (tag = ? OR note = '?')"
+	if sql != expected {
+		t.Errorf("Expected SQL: %s, but got: %s", expected, sql)
+	}
+	if !reflect.DeepEqual(args, []any{"O'Brien", 1, 2, "admin", 18, 30, "x"}) {
+		t.Errorf("Unexpected args %v", args)
+	}
+
+	sql, _ = b.Placeholder(query.DollarPlaceholder).BuildArgs()
+	expected = "SELECT id, name FROM users WHERE name = $1 AND status IN ($2, $3) AND id IN (SELECT user_id FROM permissions WHERE role = $4) AND age BETWEEN $5 AND $6 AND (tag = $7 OR note = '?')"
+	if sql != expected {
+		t.Errorf("Expected SQL: %s, but got: %s", expected, sql)
+	}
+
+	// Build 以字面量写入参数并转义引号
+	expected = `SELECT id, name FROM users WHERE name = 'O\'Brien' AND status IN (1, 2) AND id IN (SELECT user_id FROM permissions WHERE role = 'admin') AND age BETWEEN 18 AND 30 AND (tag = 'x' OR note = '?')`
+	if actual := b.Build(); actual != expected {
+		t.Errorf("Expected SQL: %s, but got: %s", expected, actual)
+	}
+
+	// 以 SELECT 开头的字符串同样作为参数，不会拼接为子查询
+	sql, args = query.NewSQLBuilder().From("t").In("name", "SELECT 1; DROP TABLE t").BuildArgs()
+	if sql != "SELECT * FROM t WHERE name IN (?)" || !reflect.DeepEqual(args, []any{"SELECT 1; DROP TABLE t"}) {
+		t.Errorf("Unexpected SQL %s %v", sql, args)
+	}
+}
+
+func TestSQLBuilder_JoinCTEUnion(t *testing.T) {
+
+	orders := query.NewSQLBuilder().Select("user_id", "SUM(amount) AS total").From("orders").GroupBy("user_id").As("o")
+
+	b := query.NewSQLBuilder().
+		Distinct().
+		Select("u.id", "o.total").
+		From("users u").
+		Join(orders, "o.user_id = u.id").
+		LeftJoin("profiles p", "p.user_id = u.id AND p.kind = ?", "main").
+		Exists(query.NewSQLBuilder().Select("1").From("logins l").Where("l.user_id = u.id")).
+		GroupBy("u.id", "o.total").
+		HavingArgs("o.total > ?", 100).
+		OrderBy("o.total DESC").
+		Limit(10)
+
+	sql, args := b.BuildArgs()
+	expected := "SELECT DISTINCT u.id, o.total FROM users u JOIN (SELECT user_id, SUM(amount) AS total FROM orders GROUP BY user_id) AS o ON o.user_id = u.id LEFT JOIN profiles p ON p.user_id = u.id AND p.kind = ? WHERE EXISTS (SELECT 1 FROM logins l WHERE l.user_id = u.id) GROUP BY u.id, o.total HAVING (o.total > ?) ORDER BY o.total DESC LIMIT 10"
+	if sql != expected {
+		t.Errorf("Expected SQL: %s, but got: %s", expected, sql)
+	}
+	if !reflect.DeepEqual(args, []any{"main", 100}) {
+		t.Errorf("Unexpected args %v", args)
+	}
+	if b.TableName() != "users u" {
+		t.Errorf("Unexpected table name %s", b.TableName())
+	}
+
+	// 递归 CTE 与 UNION，ORDER BY 作用于整个结果
+	seq := query.NewSQLBuilder().Select("1").
+		UnionAll(query.NewSQLBuilder().Select("n + 1").From("t").WhereArgs("n < ?", 5))
+	b = query.NewSQLBuilder().WithRecursive("t(n)", seq).Select("n").From("t").
+		Union(query.NewSQLBuilder().Select("n").From("extra").OrderBy("n").Limit(1)).
+		OrderBy("n")
+
+	sql, args = b.BuildArgs()
+	expected = "WITH RECURSIVE t(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM t WHERE (n < ?)) SELECT n FROM t UNION (SELECT n FROM extra ORDER BY n LIMIT 1) ORDER BY n"
+	if sql != expected {
+		t.Errorf("Expected SQL: %s, but got: %s", expected, sql)
+	}
+	if !reflect.DeepEqual(args, []any{5}) {
+		t.Errorf("Unexpected args %v", args)
+	}
+
+	// Copy 之后修改不影响原查询
+	c := b.Copy().OrderBy("x")
+	if c.Build() == b.Build() {
+		t.Errorf("Copy shares state with original")
+	}
+	if !strings.HasPrefix(db.CountQuery(b.Build()), "SELECT count() FROM (WITH RECURSIVE") {
+		t.Errorf("Unexpected count query %s", db.CountQuery(b.Build()))
+	}
+}
+
+func TestCond(t *testing.T) {
+
+	sub := query.NewSQLBuilder().Select("id").From("vip")
+	c := query.AnyOf(
+		query.Eq("a", 1),
+		query.AllOf(query.Gt("b", 2), query.In("c", []string{"x", "y"})),
+		query.Not(query.AnyOf(query.Like("d", "%o'k%"), query.IsNull("e"))),
+		query.In("f", sub),
+	)
+
+	sql, args := query.BuildCond(c, query.QuestionPlaceholder)
+	expected := "a = ? OR (b > ? AND c IN (?, ?)) OR NOT (d LIKE ? OR e IS NULL) OR f IN (SELECT id FROM vip)"
+	if sql != expected {
+		t.Errorf("Expected SQL: %s, but got: %s", expected, sql)
+	}
+	if !reflect.DeepEqual(args, []any{1, 2, "x", "y", "%o'k%"}) {
+		t.Errorf("Unexpected args %v", args)
+	}
+
+	b := query.NewSQLBuilder().Select("g", "count() AS n").From("t").
+		Where("x > 0").
+		WhereCond(c, query.Eq("h", nil)).
+		GroupBy("g").
+		HavingCond(query.AnyOf(query.Gt("n", 10), query.Lt("n", 2)), query.AnyOf())
+
+	sql, _ = b.Placeholder(query.DollarPlaceholder).BuildArgs()
+	expected = "SELECT g, count() AS n FROM t WHERE x > 0 AND (a = $1 OR (b > $2 AND c IN ($3, $4)) OR NOT (d LIKE $5 OR e IS NULL) OR f IN (SELECT id FROM vip)) AND h IS NULL GROUP BY g HAVING (n > $6 OR n < $7) AND 1 = 0"
+	if sql != expected {
+		t.Errorf("Expected SQL: %s, but got: %s", expected, sql)
+	}
+
+	expected = `a = 1 OR (b > 2 AND c IN ('x', 'y')) OR NOT (d LIKE '%o\'k%' OR e IS NULL) OR f IN (SELECT id FROM vip)`
+	if sql, _ = query.BuildCond(c, nil); sql != expected {
+		t.Errorf("Expected SQL: %s, but got: %s", expected, sql)
+	}
+
+	// 空列表：IN 恒为假，NOT IN 恒为真
+	sql, args = query.BuildCond(query.AllOf(query.In("a", []int{}), query.NotIn("b", []string{})), query.QuestionPlaceholder)
+	if sql != "1 = 0 AND 1 = 1" || len(args) != 0 {
+		t.Errorf("Unexpected SQL for empty lists: %s %v", sql, args)
+	}
+	if sql = query.NewSQLBuilder().From("t").In("a", []int{}).Build(); sql != "SELECT * FROM t WHERE 1 = 0" {
+		t.Errorf("Unexpected SQL for empty IN: %s", sql)
+	}
+}
+
+func TestDialect(t *testing.T) {
+
+	b := func() *query.SQLBuilder {
+		return query.NewSQLBuilder().Select("id").From("t").
+			WhereCond(query.Eq("name", "O'Brien"), query.Eq("ok", true)).
+			Offset(20)
+	}
+
+	tests := []struct {
+		d        query.Dialect
+		args     string
+		literal  string
+		quote    string
+		typeName string
+	}{
+		{query.MySQL, "SELECT id FROM t WHERE name = ? AND ok = ? LIMIT 18446744073709551615 OFFSET 20",
+			`SELECT id FROM t WHERE name = 'O\'Brien' AND ok = TRUE LIMIT 18446744073709551615 OFFSET 20`, "`db`.`t`", "BIGINT"},
+		{query.ClickHouse, "SELECT id FROM t WHERE name = ? AND ok = ? LIMIT 18446744073709551615 OFFSET 20",
+			`SELECT id FROM t WHERE name = 'O\'Brien' AND ok = true LIMIT 18446744073709551615 OFFSET 20`, "`db`.`t`", "Nullable(Int64)"},
+		{query.PostgreSQL, "SELECT id FROM t WHERE name = $1 AND ok = $2 OFFSET 20",
+			`SELECT id FROM t WHERE name = 'O''Brien' AND ok = TRUE OFFSET 20`, `"db"."t"`, "BIGINT"},
+		{query.SQLite, "SELECT id FROM t WHERE name = ? AND ok = ? LIMIT -1 OFFSET 20",
+			`SELECT id FROM t WHERE name = 'O''Brien' AND ok = 1 LIMIT -1 OFFSET 20`, `"db"."t"`, "INTEGER"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.d.Name(), func(t *testing.T) {
+			if sql, _ := b().BuildArgsFor(tc.d); sql != tc.args {
+				t.Errorf("Expected SQL: %s, but got: %s", tc.args, sql)
+			}
+			if sql := b().Dialect(tc.d).Build(); sql != tc.literal {
+				t.Errorf("Expected SQL: %s, but got: %s", tc.literal, sql)
+			}
+			if q := tc.d.Quote("db.t"); q != tc.quote {
+				t.Errorf("Expected %s, but got: %s", tc.quote, q)
+			}
+			if n := tc.d.TypeName(reflect.TypeOf(new(int64))); n != tc.typeName {
+				t.Errorf("Expected %s, but got: %s", tc.typeName, n)
+			}
+		})
+	}
+
+	// Literal 与 MySQL.Literal 使用同一套规则
+	for _, v := range []any{"O'Brien", true, 1.5, nil} {
+		if got, want := query.Literal(v), query.MySQL.Literal(v); got != want {
+			t.Errorf("Literal(%v) = %s, MySQL.Literal = %s", v, got, want)
+		}
+	}
+
+	// 查询自身的方言优先于 BuildArgsFor 的参数
+	if sql, _ := b().Dialect(query.PostgreSQL).BuildArgsFor(query.MySQL); sql != tests[2].args {
+		t.Errorf("Unexpected SQL: %s", sql)
+	}
+
+	ins := query.NewInsert(query.PostgreSQL, "users").AddColumn("id", "name").AddUpdateColumn("name").SetConflict("id")
+	ins.AddValues([]any{1, "a"}, []any{2, "b"})
+	sql, args := ins.Build()
+	expected := `INSERT INTO "users" ("id", "name") VALUES ($1, $2), ($3, $4) ON CONFLICT ("id") DO UPDATE SET "name" = EXCLUDED."name"`
+	if sql != expected || len(args) != 4 {
+		t.Errorf("Expected SQL: %s, but got: %s %v", expected, sql, args)
+	}
+
+	my := query.NewMysqlInsert("users", false, false).AddColumn("id", "name").AddUpdateColumn("name")
+	if sql, _ := my.Build(); sql != "INSERT INTO `users` (`id`, `name`) VALUES (?, ?) ON DUPLICATE KEY UPDATE `name` = VALUES(`name`)" {
+		t.Errorf("Unexpected SQL: %s", sql)
+	}
+	if sql, _ := query.NewCKInsert("logs").AddColumn("ts", "msg").Build(); sql != "INSERT INTO `logs` (`ts`, `msg`) VALUES (?, ?)" {
+		t.Errorf("Unexpected SQL: %s", sql)
+	}
+}
+
+func TestMutation(t *testing.T) {
+
+	up := query.NewUpdateBuilder("users").
+		Set("status", "active").
+		SetExpr("n", "n + ?", 1).
+		Columns("name").
+		Keys("id").
+		WhereCond(query.Gt("age", 18))
+
+	sql, args := up.BuildArgs()
+	expected := "UPDATE users SET status = ?, n = n + ?, name = ? WHERE id = ? AND age > ?"
+	if sql != expected {
+		t.Errorf("Expected SQL: %s, but got: %s", expected, sql)
+	}
+	bound, err := query.BindRow(args, []any{"bob", 7})
+	if err != nil || !reflect.DeepEqual(bound, []any{"active", 1, "bob", 7, 18}) {
+		t.Errorf("Unexpected args %v %v", bound, err)
+	}
+	if _, err := query.BindRow(args, []any{"bob"}); err == nil {
+		t.Errorf("Expected error for short row")
+	}
+
+	expected = "ALTER TABLE users UPDATE status = 'active', n = n + 1, name = ? WHERE id = ? AND age > 18"
+	if sql := up.Dialect(query.ClickHouse).Build(); sql != expected {
+		t.Errorf("Expected SQL: %s, but got: %s", expected, sql)
+	}
+
+	del := query.NewDeleteBuilder("logs")
+	if sql, _ := del.BuildArgsFor(query.ClickHouse); sql != "ALTER TABLE logs DELETE WHERE 1" {
+		t.Errorf("Unexpected SQL: %s", sql)
+	}
+	del.Lightweight(true).WhereArgs("ts < ?", "2024-01-01")
+	if sql, _ := del.BuildArgsFor(query.ClickHouse); sql != "DELETE FROM logs WHERE (ts < ?)" {
+		t.Errorf("Unexpected SQL: %s", sql)
+	}
+	if sql, _ := del.BuildArgsFor(query.PostgreSQL); sql != "DELETE FROM logs WHERE (ts < $1)" {
+		t.Errorf("Unexpected SQL: %s", sql)
+	}
+
+	// DryRun 模式只返回语句，不访问数据库
+	var stmts []string
+	con := &db.DB{Dialect: query.MySQL, DryRun: func(stmt string, args []any) {
+		stmts = append(stmts, fmt.Sprint(stmt, args))
+	}}
+
+	ch := make(chan []any, 2)
+	ch <- []any{"a", 1}
+	ch <- []any{"b", 2}
+	close(ch)
+
+	if err := con.UpdateBatch(query.NewUpdateBuilder("users").Columns("name").Keys("id"))(ch); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := con.Exec(query.NewDeleteBuilder("users").WhereCond(query.Eq("id", 3))); err != nil {
+		t.Fatal(err)
+	}
+
+	expectedStmts := []string{
+		"UPDATE users SET name = ? WHERE id = ?[a 1]",
+		"UPDATE users SET name = ? WHERE id = ?[b 2]",
+		"DELETE FROM users WHERE id = ?[3]",
+	}
+	if !reflect.DeepEqual(stmts, expectedStmts) {
+		t.Errorf("Unexpected statements %q", stmts)
+	}
+}
+
+func TestSQLBuilder_ClickHouse(t *testing.T) {
+
+	b := query.NewSQLBuilder().
+		Dialect(query.ClickHouse).
+		Select("user_id", "tag", "count() AS n").
+		From("events").
+		Final().
+		Sample("1/10").
+		ArrayJoin("tags AS tag").
+		PrewhereArgs("dt >= ? OR hot = 1", "2024-01-01").
+		WhereCond(query.In("type", []string{"click", "view"})).
+		GroupBy("user_id", "tag").
+		WithTotals().
+		OrderBy("n DESC").
+		LimitBy(3, "user_id").
+		Limit(100).
+		Settings("max_threads", 8).
+		Settings("use_uncompressed_cache", true)
+
+	sql, args := b.BuildArgs()
+	expected := "SELECT user_id, tag, count() AS n FROM events FINAL SAMPLE 1/10 ARRAY JOIN tags AS tag PREWHERE (dt >= ? OR hot = 1) WHERE type IN (?, ?) GROUP BY user_id, tag WITH TOTALS ORDER BY n DESC LIMIT 3 BY user_id LIMIT 100 SETTINGS max_threads = 8, use_uncompressed_cache = true"
+	if sql != expected {
+		t.Errorf("Expected SQL: %s, but got: %s", expected, sql)
+	}
+	if !reflect.DeepEqual(args, []any{"2024-01-01", "click", "view"}) {
+		t.Errorf("Unexpected args %v", args)
+	}
+
+	// Copy 之后修改不影响原查询
+	c := b.Copy().Settings("max_threads", 2).LeftArrayJoin("ids")
+	if strings.Contains(b.Build(), "max_threads = 2") || strings.Contains(b.Build(), "LEFT ARRAY JOIN") {
+		t.Errorf("Copy shares state with original: %s", b.Build())
+	}
+	if !strings.Contains(c.Build(), "ARRAY JOIN tags AS tag LEFT ARRAY JOIN ids") {
+		t.Errorf("Unexpected SQL: %s", c.Build())
+	}
+
+	if !strings.Contains(db.CountQuery(b.Build()), "FROM (SELECT user_id, tag, count() AS n FROM events FINAL") {
+		t.Errorf("Unexpected count query %s", db.CountQuery(b.Build()))
+	}
+}
+
+func TestCountQuery(t *testing.T) {
+
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		{"SELECT id, Name FROM Users WHERE name = 'O\\'Brien' AND tag = 'FROM x' ORDER BY id",
+			"SELECT count() FROM Users WHERE name = 'O\\'Brien' AND tag = 'FROM x'"},
+		{"select (select max(a) from t2) m, b from t1 where c in (select c from t3) order by b settings max_threads = 1;",
+			"select count() from t1 where c in (select c from t3) settings max_threads = 1"},
+		{"SELECT a, count() FROM t GROUP BY a",
+			"SELECT count() FROM (SELECT a, count() FROM t GROUP BY a) AS _t"},
+		{"SELECT a FROM t LIMIT 10",
+			"SELECT count() FROM (SELECT a FROM t LIMIT 10) AS _t"},
+		{"SELECT if(a > ?, 1, 0) FROM t WHERE b = ?",
+			"SELECT count() FROM (SELECT if(a > ?, 1, 0) FROM t WHERE b = ?) AS _t"},
+		{"WITH x AS (SELECT * FROM t) SELECT * FROM x -- comment",
+			"WITH x AS (SELECT * FROM t) SELECT count() FROM x -- comment"},
+		{"SELECT max(a) FROM t",
+			"SELECT count() FROM (SELECT max(a) FROM t) AS _t"},
+		{"SELECT round(SUM(a) / 2, 1) AS s FROM t WHERE b > 0",
+			"SELECT count() FROM (SELECT round(SUM(a) / 2, 1) AS s FROM t WHERE b > 0) AS _t"},
+	}
+
+	for _, tc := range tests {
+		actual, err := query.CountQuery(tc.sql)
+		if err != nil {
+			t.Errorf("%s: %v", tc.sql, err)
+			continue
+		}
+		if actual != tc.expected {
+			t.Errorf("Expected SQL: %s, but got: %s", tc.expected, actual)
+		}
+	}
+
+	for _, sql := range []string{"SELECT 'abc FROM t", "SELECT (a FROM t", "UPDATE t SET a = 1", "SELECT a) FROM t"} {
+		if _, err := query.CountQuery(sql); err == nil {
+			t.Errorf("Expected parse error for %s", sql)
+		}
+	}
+
+	// 非 ClickHouse 方言使用 count(*)
+	if actual, _ := query.CountQueryFor("SELECT max(a) FROM t", query.MySQL); actual != "SELECT count(*) FROM (SELECT max(a) FROM t) AS _t" {
+		t.Errorf("Unexpected MySQL count query %s", actual)
+	}
+	if actual, _ := query.CountQueryFor("SELECT a FROM t ORDER BY a", query.ClickHouse); actual != "SELECT count() FROM t" {
+		t.Errorf("Unexpected ClickHouse count query %s", actual)
+	}
+}
+
+func TestExtractTables(t *testing.T) {
+
+	sql := `WITH RECURSIVE tree AS (SELECT id FROM nodes UNION ALL SELECT n.id FROM nodes n JOIN tree ON n.pid = tree.id)
+SELECT EXTRACT(YEAR FROM o.ts), u.name FROM ` + "`shop`.`orders`" + ` o, (SELECT * FROM db.users) u, numbers(10) n2
+LEFT JOIN "Items" i ON i.oid = o.id
+WHERE o.id IN (SELECT oid FROM refunds) AND o.uid IN (SELECT id FROM tree)`
+
+	tables, err := query.ExtractTables(sql)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"nodes", "shop.orders", "db.users", "Items", "refunds"}
+	if !reflect.DeepEqual(tables, expected) {
+		t.Errorf("Expected %v, got %v", expected, tables)
+	}
+
+	if name := query.ExtractTableName("select * from a, b"); name != "a" {
+		t.Errorf("Unexpected table %s", name)
+	}
+	if _, err := query.ExtractTables("SELECT * FROM `t"); err == nil {
+		t.Errorf("Expected parse error")
+	}
+
+	// 子查询位于语句末尾且没有别名
+	for sql, expected := range map[string][]string{
+		"SELECT * FROM (SELECT 1)":                {},
+		"SELECT * FROM (SELECT * FROM b)":         {"b"},
+		"SELECT * FROM a, (SELECT * FROM b)":      {"a", "b"},
+		"SELECT * FROM a, (SELECT * FROM b) AS x": {"a", "b"},
+	} {
+		tables, err := query.ExtractTables(sql)
+		if err != nil || len(tables) != len(expected) || (len(tables) > 0 && !reflect.DeepEqual(tables, expected)) {
+			t.Errorf("%s: expected %v, got %v %v", sql, expected, tables, err)
+		}
+	}
+}
@@ -3,35 +3,67 @@ package query
 import (
 	"encoding/json"
 	"fmt"
-	"regexp"
 	"strings"
 
 	"github.com/olivere/elastic/v7"
 )
 
+// ExtractTableName 返回 SQL 语句中引用的第一个表，解析失败或没有表时返回空字符串，见 ExtractTables
 func ExtractTableName(sql string) string {
-	re := regexp.MustCompile(`\bFROM\s+(\w+)`)
-	matches := re.FindStringSubmatch(sql)
-	if len(matches) > 1 {
-		return matches[1]
+	tables, err := ExtractTables(sql)
+	if err != nil || len(tables) == 0 {
+		return ""
 	}
-	return ""
+	return tables[0]
 }
 
 // SQLBuilder 结构体用于构建 SQL 查询
 type SQLBuilder struct {
 	selectFields []string
 	tableName    string
-	whereClauses []string
+	from         expr
+	whereClauses []expr
 	groupBy      []string
 	orderBy      []string
 	limit        int
 	offset       int
 	sql          string
+	sqlArgs      []any
+	placeholder  Placeholder
+	dialect      Dialect
+	distinct     bool
+	alias        string
+	joins        []join
+	having       []expr
+	ctes         []cte
+	recursive    bool
+	unions       []union
+	ck           ckClauses
 }
 
-func (sb *SQLBuilder) SQL(sql string) *SQLBuilder {
+// join JOIN 子句
+type join struct {
+	kind string
+	src  expr
+	on   expr
+}
+
+// cte WITH 子句中的公用表表达式
+type cte struct {
+	name string
+	q    *SQLBuilder
+}
+
+// union UNION 子句
+type union struct {
+	all bool
+	q   *SQLBuilder
+}
+
+// SQL 方法直接指定查询语句，args 对应语句中引号外的 ? 占位符
+func (sb *SQLBuilder) SQL(sql string, args ...any) *SQLBuilder {
 	sb.sql = sql
+	sb.sqlArgs = args
 	return sb
 
 }
@@ -43,13 +75,23 @@ func (sb *SQLBuilder) TableName() string {
 func (sb *SQLBuilder) Clear() {
 
 	sb.sql = ""
+	sb.sqlArgs = nil
 	sb.selectFields = nil
 	sb.tableName = ""
+	sb.from = expr{}
 	sb.whereClauses = nil
 	sb.groupBy = nil
 	sb.orderBy = nil
 	sb.limit = 0
 	sb.offset = 0
+	sb.distinct = false
+	sb.alias = ""
+	sb.joins = nil
+	sb.having = nil
+	sb.ctes = nil
+	sb.recursive = false
+	sb.unions = nil
+	sb.ck = ckClauses{}
 
 }
 
@@ -60,7 +102,8 @@ func (sb *SQLBuilder) Copy() *SQLBuilder {
 	newSb.selectFields = make([]string, len(sb.selectFields))
 	copy(newSb.selectFields, sb.selectFields)
 	newSb.tableName = sb.tableName
-	newSb.whereClauses = make([]string, len(sb.whereClauses))
+	newSb.from = sb.from
+	newSb.whereClauses = make([]expr, len(sb.whereClauses))
 	copy(newSb.whereClauses, sb.whereClauses)
 	newSb.groupBy = make([]string, len(sb.groupBy))
 	copy(newSb.groupBy, sb.groupBy)
@@ -69,6 +112,17 @@ func (sb *SQLBuilder) Copy() *SQLBuilder {
 	newSb.limit = sb.limit
 	newSb.offset = sb.offset
 	newSb.sql = sb.sql
+	newSb.sqlArgs = append([]any{}, sb.sqlArgs...)
+	newSb.placeholder = sb.placeholder
+	newSb.dialect = sb.dialect
+	newSb.distinct = sb.distinct
+	newSb.alias = sb.alias
+	newSb.joins = append([]join{}, sb.joins...)
+	newSb.having = append([]expr{}, sb.having...)
+	newSb.ctes = append([]cte{}, sb.ctes...)
+	newSb.recursive = sb.recursive
+	newSb.unions = append([]union{}, sb.unions...)
+	newSb.ck = sb.ck.copy()
 	return newSb
 }
 
@@ -77,6 +131,18 @@ func NewSQLBuilder() *SQLBuilder {
 	return &SQLBuilder{}
 }
 
+// Placeholder 方法用于指定 BuildArgs 使用的占位符，默认为 QuestionPlaceholder
+func (sb *SQLBuilder) Placeholder(p Placeholder) *SQLBuilder {
+	sb.placeholder = p
+	return sb
+}
+
+// Dialect 方法用于指定方言，决定占位符、字面量和 LIMIT/OFFSET 的写法，Placeholder 指定的占位符优先
+func (sb *SQLBuilder) Dialect(d Dialect) *SQLBuilder {
+	sb.dialect = d
+	return sb
+}
+
 // TransformSelect 方法用于对 SELECT 字段进行转换处理
 func (sb *SQLBuilder) TransformSelect(transformFunc func(string) string) *SQLBuilder {
 	transformedFields := make([]string, len(sb.selectFields))
@@ -93,100 +159,197 @@ func (sb *SQLBuilder) Select(fields ...string) *SQLBuilder {
 	return sb
 }
 
-// From 方法用于指定查询的表名
+// Distinct 方法用于生成 SELECT DISTINCT
+func (sb *SQLBuilder) Distinct() *SQLBuilder {
+	sb.distinct = true
+	return sb
+}
+
+// As 方法用于指定作为子查询出现在 From 或 Join 中时的别名
+func (sb *SQLBuilder) As(alias string) *SQLBuilder {
+	sb.alias = alias
+	return sb
+}
+
+// sourceExpr 将表名或子查询转换为数据源，子查询加括号并带上别名
+func sourceExpr(table any) expr {
+
+	switch v := table.(type) {
+	case string:
+		return rawExpr(v)
+	case *SQLBuilder:
+		end := ")"
+		if v.alias != "" {
+			end += " AS " + v.alias
+		}
+		return expr{parts: []string{"(", end}, args: []any{v.Copy()}}
+	default:
+		panic(fmt.Sprintf("Unsupported type %T for table name", v))
+	}
+}
+
+// From 方法用于指定查询的表名，也可以是子查询，子查询的别名通过 As 指定
 func (sb *SQLBuilder) From(tableName any) *SQLBuilder {
 
+	sb.from = sourceExpr(tableName)
+
 	switch v := tableName.(type) {
 	case string:
 		sb.tableName = v
 	case *SQLBuilder:
 		sb.tableName = v.Build()
-	default:
-		panic(fmt.Sprintf("Unsupported type %T for table name", v))
 	}
 
 	return sb
 }
 
+func (sb *SQLBuilder) join(kind string, table any, on string, args ...any) *SQLBuilder {
+	j := join{kind: kind, src: sourceExpr(table)}
+	if on != "" {
+		j.on = argExpr(on, args...)
+	}
+	sb.joins = append(sb.joins, j)
+	return sb
+}
+
+// Join 方法用于添加 JOIN 子句，table 为表名或子查询，on 为连接条件，args 对应 on 中的 ? 占位符
+func (sb *SQLBuilder) Join(table any, on string, args ...any) *SQLBuilder {
+	return sb.join("JOIN", table, on, args...)
+}
+
+// LeftJoin 方法用于添加 LEFT JOIN 子句
+func (sb *SQLBuilder) LeftJoin(table any, on string, args ...any) *SQLBuilder {
+	return sb.join("LEFT JOIN", table, on, args...)
+}
+
+// RightJoin 方法用于添加 RIGHT JOIN 子句
+func (sb *SQLBuilder) RightJoin(table any, on string, args ...any) *SQLBuilder {
+	return sb.join("RIGHT JOIN", table, on, args...)
+}
+
+// With 方法用于添加 WITH 公用表表达式，name 可以带列名，如 t(a, b)
+func (sb *SQLBuilder) With(name string, q *SQLBuilder) *SQLBuilder {
+	sb.ctes = append(sb.ctes, cte{name: name, q: q.Copy()})
+	return sb
+}
+
+// WithRecursive 方法用于添加递归公用表表达式，生成 WITH RECURSIVE，q 通常为 UnionAll 连接的查询
+func (sb *SQLBuilder) WithRecursive(name string, q *SQLBuilder) *SQLBuilder {
+	sb.recursive = true
+	return sb.With(name, q)
+}
+
+// Union 方法用于以 UNION 连接另一个查询，当前查询的 ORDER BY、LIMIT、OFFSET 作用于整个结果
+func (sb *SQLBuilder) Union(q *SQLBuilder) *SQLBuilder {
+	sb.unions = append(sb.unions, union{all: false, q: q.Copy()})
+	return sb
+}
+
+// UnionAll 方法用于以 UNION ALL 连接另一个查询
+func (sb *SQLBuilder) UnionAll(q *SQLBuilder) *SQLBuilder {
+	sb.unions = append(sb.unions, union{all: true, q: q.Copy()})
+	return sb
+}
+
+// Having 方法用于添加 HAVING 子句条件
+func (sb *SQLBuilder) Having(clauses ...string) *SQLBuilder {
+	for _, c := range clauses {
+		sb.having = append(sb.having, rawExpr(c))
+	}
+	return sb
+}
+
+// HavingArgs 方法用于添加带参数的 HAVING 子句条件，args 对应 clause 中引号外的 ? 占位符
+func (sb *SQLBuilder) HavingArgs(clause string, args ...any) *SQLBuilder {
+	sb.having = append(sb.having, clauseExpr(clause, args...))
+	return sb
+}
+
+// Exists 方法用于生成 EXISTS (subquery) 的条件语句
+func (sb *SQLBuilder) Exists(q *SQLBuilder) *SQLBuilder {
+	sb.whereClauses = append(sb.whereClauses, expr{parts: []string{"EXISTS (", ")"}, args: []any{q.Copy()}})
+	return sb
+}
+
+// NotExists 方法用于生成 NOT EXISTS (subquery) 的条件语句
+func (sb *SQLBuilder) NotExists(q *SQLBuilder) *SQLBuilder {
+	sb.whereClauses = append(sb.whereClauses, expr{parts: []string{"NOT EXISTS (", ")"}, args: []any{q.Copy()}})
+	return sb
+}
+
 // Where 方法用于添加 WHERE 子句条件
 func (sb *SQLBuilder) Where(clauses ...string) *SQLBuilder {
-	sb.whereClauses = append(sb.whereClauses, clauses...)
+	for _, c := range clauses {
+		sb.whereClauses = append(sb.whereClauses, rawExpr(c))
+	}
 	return sb
 }
 
-// equal 方法用语添加 等于的条件到where中
-func (sb *SQLBuilder) Eq(field string, value any) *SQLBuilder {
-	switch v := value.(type) {
-	case int, int8, int16, int32, int64, float32, float64:
-		sb.whereClauses = append(sb.whereClauses, fmt.Sprintf("%s = %v", field, v))
-	case string:
-		sb.whereClauses = append(sb.whereClauses, fmt.Sprintf("%s = '%s'", field, v))
+// WhereArgs 方法用于添加带参数的 WHERE 子句条件，args 对应 clause 中引号外的 ? 占位符
+func (sb *SQLBuilder) WhereArgs(clause string, args ...any) *SQLBuilder {
+	sb.whereClauses = append(sb.whereClauses, clauseExpr(clause, args...))
+	return sb
+}
+
+// WhereCond 方法用于添加条件表达式到 WHERE 子句，多个条件以 AND 连接
+func (sb *SQLBuilder) WhereCond(conds ...Cond) *SQLBuilder {
+	for _, c := range conds {
+		sb.whereClauses = append(sb.whereClauses, condExpr(c))
 	}
 	return sb
 }
 
-// unequal 方法用语添加 不等于的条件到where中
-func (sb *SQLBuilder) Uneq(field string, value any) *SQLBuilder {
-	switch v := value.(type) {
-	case int, int8, int16, int32, int64, float32, float64:
-		sb.whereClauses = append(sb.whereClauses, fmt.Sprintf("%s != %v", field, v))
-	case string:
-		sb.whereClauses = append(sb.whereClauses, fmt.Sprintf("%s != '%s'", field, v))
+// HavingCond 方法用于添加条件表达式到 HAVING 子句，多个条件以 AND 连接
+func (sb *SQLBuilder) HavingCond(conds ...Cond) *SQLBuilder {
+	for _, c := range conds {
+		sb.having = append(sb.having, condExpr(c))
 	}
 	return sb
 }
 
+// cmp 添加 field op value 条件，value 作为参数
+func (sb *SQLBuilder) cmp(field, op string, value any) *SQLBuilder {
+	sb.whereClauses = append(sb.whereClauses, expr{parts: []string{field + " " + op + " ", ""}, args: []any{value}})
+	return sb
+}
+
+// equal 方法用语添加 等于的条件到where中
+func (sb *SQLBuilder) Eq(field string, value any) *SQLBuilder {
+	return sb.cmp(field, "=", value)
+}
+
+// unequal 方法用语添加 不等于的条件到where中
+func (sb *SQLBuilder) Uneq(field string, value any) *SQLBuilder {
+	return sb.cmp(field, "!=", value)
+}
+
 // gt 方法用语添加 大于的条件到where中
 func (sb *SQLBuilder) Gt(field string, value any) *SQLBuilder {
-	switch v := value.(type) {
-	case int, int8, int16, int32, int64, float32, float64:
-		sb.whereClauses = append(sb.whereClauses, fmt.Sprintf("%s > %v", field, v))
-	case string:
-		sb.whereClauses = append(sb.whereClauses, fmt.Sprintf("%s > '%s'", field, v))
-	}
-	return sb
+	return sb.cmp(field, ">", value)
 }
 
 // gte 方法用语添加 大于等于的条件到where中
 func (sb *SQLBuilder) Gte(field string, value any) *SQLBuilder {
-	switch v := value.(type) {
-	case int, int8, int16, int32, int64, float32, float64:
-		sb.whereClauses = append(sb.whereClauses, fmt.Sprintf("%s >= %v", field, v))
-	case string:
-		sb.whereClauses = append(sb.whereClauses, fmt.Sprintf("%s >= '%s'", field, v))
-	}
-	return sb
+	return sb.cmp(field, ">=", value)
 }
 
 // lt 方法用语添加 小于的条件到where中
 func (sb *SQLBuilder) Lt(field string, value any) *SQLBuilder {
-	switch v := value.(type) {
-	case int, int8, int16, int32, int64, float32, float64:
-		sb.whereClauses = append(sb.whereClauses, fmt.Sprintf("%s < %v", field, v))
-	case string:
-		sb.whereClauses = append(sb.whereClauses, fmt.Sprintf("%s < '%s'", field, v))
-	}
-	return sb
+	return sb.cmp(field, "<", value)
 }
 
 // lte 方法用语添加 小于等于的条件到where中
 func (sb *SQLBuilder) Lte(field string, value any) *SQLBuilder {
-	switch v := value.(type) {
-	case int, int8, int16, int32, int64, float32, float64:
-		sb.whereClauses = append(sb.whereClauses, fmt.Sprintf("%s <= %v", field, v))
-	case string:
-		sb.whereClauses = append(sb.whereClauses, fmt.Sprintf("%s <= '%s'", field, v))
-	}
-	return sb
+	return sb.cmp(field, "<=", value)
 }
 
 // And 方法用于添加 AND 条件
 func (sb *SQLBuilder) And(clauses ...string) *SQLBuilder {
 	if len(clauses) == 1 {
-		sb.whereClauses = append(sb.whereClauses, clauses[0])
+		sb.whereClauses = append(sb.whereClauses, rawExpr(clauses[0]))
 	} else {
 		andClauses := fmt.Sprintf("(%s)", strings.Join(clauses, " AND "))
-		sb.whereClauses = append(sb.whereClauses, andClauses)
+		sb.whereClauses = append(sb.whereClauses, rawExpr(andClauses))
 	}
 	return sb
 }
@@ -194,57 +357,33 @@ func (sb *SQLBuilder) And(clauses ...string) *SQLBuilder {
 // Or 方法用于添加 OR 条件
 func (sb *SQLBuilder) Or(clauses ...string) *SQLBuilder {
 	if len(clauses) == 1 {
-		sb.whereClauses = append(sb.whereClauses, clauses[0])
+		sb.whereClauses = append(sb.whereClauses, rawExpr(clauses[0]))
 	} else {
 		orClauses := fmt.Sprintf("(%s)", strings.Join(clauses, " OR "))
-		sb.whereClauses = append(sb.whereClauses, orClauses)
+		sb.whereClauses = append(sb.whereClauses, rawExpr(orClauses))
 	}
 	return sb
 }
 
-// In 方法用于生成 field IN (subquery) 或 field IN (value1, value2, ...) 的条件语句
+// In 方法用于生成 field IN (subquery) 或 field IN (value1, value2, ...) 的条件语句，
+// values 可以是任意切片、*SQLBuilder 子查询或单个值，字符串始终作为参数，不会作为子查询拼接
 func (sb *SQLBuilder) In(field string, values any) *SQLBuilder {
 	switch v := values.(type) {
-	case []string:
-		sb.whereClauses = append(sb.whereClauses, fmt.Sprintf("%s IN ('%s')", field, strings.Join(v, "', '")))
-	case []int:
-		var strValues []string
-		for _, val := range v {
-			strValues = append(strValues, fmt.Sprintf("%d", val))
-		}
-		sb.whereClauses = append(sb.whereClauses, fmt.Sprintf("%s IN (%s)", field, strings.Join(strValues, ", ")))
-	case string:
-		// Check if the string is a valid subquery
-		if isValidSubquery(v) {
-			sb.whereClauses = append(sb.whereClauses, fmt.Sprintf("%s IN (%s)", field, v))
-		} else {
-			sb.whereClauses = append(sb.whereClauses, fmt.Sprintf("%s IN ('%s')", field, v))
-		}
 	case *SQLBuilder:
-		sb.whereClauses = append(sb.whereClauses, fmt.Sprintf("%s IN (%s)", field, v.Build()))
+		sb.whereClauses = append(sb.whereClauses, expr{parts: []string{field + " IN (", ")"}, args: []any{v.Copy()}})
 	default:
-		panic(fmt.Sprintf("Unsupported type %T for IN clause", v))
+		list, ok := listArgs(v)
+		if !ok {
+			list = []any{v}
+		}
+		sb.whereClauses = append(sb.whereClauses, inExpr(field, "IN", list))
 	}
 	return sb
 }
 
-// isValidSubquery 检查一个字符串是否是有效的子查询
-func isValidSubquery(s string) bool {
-	// 简单示例：假设有效的子查询以 "SELECT" 开头
-	return strings.HasPrefix(strings.ToUpper(strings.TrimSpace(s)), "SELECT")
-}
-
 // Between 方法用于生成 field BETWEEN lower AND upper 的条件语句
 func (sb *SQLBuilder) Between(field string, lower, upper any) *SQLBuilder {
-	switch v := lower.(type) {
-	case int, int8, int16, int32, int64, float32, float64:
-		sb.whereClauses = append(sb.whereClauses, fmt.Sprintf("%s BETWEEN %v AND %v", field, lower, upper))
-	case string:
-		sb.whereClauses = append(sb.whereClauses, fmt.Sprintf("%s BETWEEN '%s' AND '%s'", field, lower, upper))
-	default:
-		// Add cases for other types as needed
-		panic(fmt.Sprintf("Unsupported type %T for BETWEEN clause", v))
-	}
+	sb.whereClauses = append(sb.whereClauses, expr{parts: []string{field + " BETWEEN ", " AND ", ""}, args: []any{lower, upper}})
 	return sb
 }
 
@@ -272,58 +411,160 @@ func (sb *SQLBuilder) Offset(offset int) *SQLBuilder {
 	return sb
 }
 
-// Build 方法用于构建最终的 SQL 查询语句
+// Build 方法用于构建最终的 SQL 查询语句，参数以字面量的形式写入语句中
 func (sb *SQLBuilder) Build() string {
 
+	w := &sqlWriter{d: sb.dialect}
+	sb.writeTo(w)
+
+	return w.sb.String()
+}
+
+// BuildArgs 方法用于构建参数化的 SQL 查询语句，参数使用占位符表示，按顺序返回
+func (sb *SQLBuilder) BuildArgs() (string, []any) {
+	return sb.BuildArgsFor(nil)
+}
+
+// BuildArgsFor 方法与 BuildArgs 相同，查询没有通过 Dialect 指定方言时使用 d，供数据库连接按自身方言构建查询
+func (sb *SQLBuilder) BuildArgsFor(d Dialect) (string, []any) {
+
+	if sb.dialect != nil {
+		d = sb.dialect
+	}
+
+	ph := sb.placeholder
+	if ph == nil && d != nil {
+		ph = d.Placeholder
+	}
+	if ph == nil {
+		ph = QuestionPlaceholder
+	}
+
+	w := &sqlWriter{ph: ph, d: d}
+	sb.writeTo(w)
+
+	return w.sb.String(), w.args
+}
+
+func (sb *SQLBuilder) writeTo(w *sqlWriter) {
+
 	if sb.sql != "" {
-		return sb.sql
+		w.expr(argExpr(sb.sql, sb.sqlArgs...))
+		return
 	}
 
-	var sql strings.Builder
+	// 构建 WITH 子句
+	if len(sb.ctes) > 0 {
+		w.write("WITH ")
+		if sb.recursive {
+			w.write("RECURSIVE ")
+		}
+		for i, c := range sb.ctes {
+			if i > 0 {
+				w.write(", ")
+			}
+			w.write(c.name, " AS (")
+			c.q.writeTo(w)
+			w.write(")")
+		}
+		w.write(" ")
+	}
 
 	// 构建 SELECT 子句
-	sql.WriteString("SELECT ")
+	w.write("SELECT ")
+	if sb.distinct {
+		w.write("DISTINCT ")
+	}
 	if len(sb.selectFields) > 0 {
-		sql.WriteString(strings.Join(sb.selectFields, ", "))
+		w.write(strings.Join(sb.selectFields, ", "))
 	} else {
-		sql.WriteString("*")
+		w.write("*")
 	}
 
 	// 构建 FROM 子句
 	if sb.tableName != "" {
-		sql.WriteString(" FROM ")
-		sql.WriteString(sb.tableName)
+		w.write(" FROM ")
+		w.expr(sb.from)
+		sb.ck.writeSource(w)
 	}
 
-	// 构建 WHERE 子句
-	if len(sb.whereClauses) > 0 {
-		sql.WriteString(" WHERE ")
-		sql.WriteString(strings.Join(sb.whereClauses, " AND "))
+	// 构建 JOIN 子句
+	for _, j := range sb.joins {
+		w.write(" ", j.kind, " ")
+		w.expr(j.src)
+		if len(j.on.parts) > 0 {
+			w.write(" ON ")
+			w.expr(j.on)
+		}
 	}
 
+	// 构建 PREWHERE、WHERE 子句
+	writeConds(w, " PREWHERE ", sb.ck.prewhere)
+	writeConds(w, " WHERE ", sb.whereClauses)
+
 	// 构建 GROUP BY 子句
 	if len(sb.groupBy) > 0 {
-		sql.WriteString(" GROUP BY ")
-		sql.WriteString(strings.Join(sb.groupBy, ", "))
+		w.write(" GROUP BY ", strings.Join(sb.groupBy, ", "))
+		if sb.ck.withTotals {
+			w.write(" WITH TOTALS")
+		}
+	}
+
+	// 构建 HAVING 子句
+	writeConds(w, " HAVING ", sb.having)
+
+	// 构建 UNION 子句，带 ORDER BY 或 LIMIT 的查询加括号
+	for _, u := range sb.unions {
+		if u.all {
+			w.write(" UNION ALL ")
+		} else {
+			w.write(" UNION ")
+		}
+		if len(u.q.orderBy) > 0 || u.q.limit > 0 || u.q.offset > 0 || u.q.ck.limitBy > 0 || len(u.q.ck.settings) > 0 {
+			w.write("(")
+			u.q.writeTo(w)
+			w.write(")")
+		} else {
+			u.q.writeTo(w)
+		}
 	}
 
 	// 构建 ORDER BY 子句
 	if len(sb.orderBy) > 0 {
-		sql.WriteString(" ORDER BY ")
-		sql.WriteString(strings.Join(sb.orderBy, ", "))
+		w.write(" ORDER BY ", strings.Join(sb.orderBy, ", "))
 	}
 
-	// 构建 LIMIT 子句
-	if sb.limit > 0 {
-		sql.WriteString(fmt.Sprintf(" LIMIT %d", sb.limit))
-	}
+	// 构建 LIMIT n BY 子句
+	sb.ck.writeLimitBy(w)
 
-	// 构建 OFFSET 子句
-	if sb.offset > 0 {
-		sql.WriteString(fmt.Sprintf(" OFFSET %d", sb.offset))
+	// 构建 LIMIT、OFFSET 子句
+	if w.d != nil {
+		w.write(w.d.LimitOffset(sb.limit, sb.offset))
+	} else {
+		if sb.limit > 0 {
+			w.write(fmt.Sprintf(" LIMIT %d", sb.limit))
+		}
+		if sb.offset > 0 {
+			w.write(fmt.Sprintf(" OFFSET %d", sb.offset))
+		}
 	}
 
-	return sql.String()
+	// 构建 SETTINGS 子句
+	sb.ck.writeSettings(w)
+}
+
+// writeConds 写入以 AND 连接的条件
+func writeConds(w *sqlWriter, keyword string, conds []expr) {
+	if len(conds) == 0 {
+		return
+	}
+	w.write(keyword)
+	for i, c := range conds {
+		if i > 0 {
+			w.write(" AND ")
+		}
+		w.expr(c)
+	}
 }
 
 // EsQuery 用于构建 Elasticsearch 查询